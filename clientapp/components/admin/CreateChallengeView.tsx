@@ -276,7 +276,7 @@ export function CreateChallengeView() {
                                                             <span className="text-[12px] font-bold">文字匹配</span>
                                                         </div>
                                                     </SelectItem>
-                                                    <SelectItem value="SCRIPT" disabled>
+                                                    <SelectItem value="SCRIPT">
                                                         <div className="w-full flex gap-2 items-center h-[25px]">
                                                             <FileCode />
                                                             <span className="text-[12px] font-bold">脚本匹配</span>
@@ -745,7 +745,7 @@ export function EditChallengeView({ challenge_info }: { challenge_info: AdminCha
                                                             <span className="text-[12px] font-bold">文字匹配</span>
                                                         </div>
                                                     </SelectItem>
-                                                    <SelectItem value="SCRIPT" disabled>
+                                                    <SelectItem value="SCRIPT">
                                                         <div className="w-full flex gap-2 items-center h-[25px]">
                                                             <FileCode />
                                                             <span className="text-[12px] font-bold">脚本匹配</span>
@@ -839,6 +839,7 @@ export function EditChallengeView({ challenge_info }: { challenge_info: AdminCha
                                                 <span>[game_id] 部分会被替换成比赛ID</span>
                                                 <span>[uuid] 部分会被替换成随机UUID</span>
                                                 <span>[random_string_??] 部分会被替换成随机字符串, 其中??表示字符串长度</span>
+                                                <span>[container_id] 部分会被替换成靶机ID, 仅在每个靶机独立 Flag 时可用, 模板中没有随机部分时会自动追加</span>
                                                 <span>如果你在题目设置中选择了动态Flag, 将会启用Leet进行反作弊</span>
                                                 <span>模板变量部分不会被Leet替换</span>
                                             </div>
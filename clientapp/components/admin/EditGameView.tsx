@@ -55,6 +55,7 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
             description: game_info.description || "",
             poster: game_info.poster || "",
             invite_code: game_info.invite_code || "",
+            flag_prefix: game_info.flag_prefix || "",
             start_time: game_info.start_time ? dayjs(game_info.start_time).toDate() : new Date(),
             end_time: game_info.end_time ? dayjs(game_info.end_time).toDate() : new Date(),
             practice_mode: game_info.practice_mode,
@@ -64,6 +65,7 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
             game_icon_light: game_info.game_icon_light || "",
             game_icon_dark: game_info.game_icon_dark || "",
             wp_expire_time: game_info.wp_expire_time ? dayjs(game_info.wp_expire_time).toDate() : new Date(),
+            freeze_time: game_info.freeze_time ? dayjs(game_info.freeze_time).toDate() : null,
             visible: game_info.visible,
             first_blood_reward: game_info.first_blood_reward,
             second_blood_reward: game_info.second_blood_reward,
@@ -73,6 +75,8 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
                 stage_name: stage.stage_name,
                 start_time: dayjs(stage.start_time).toDate(),
                 end_time: dayjs(stage.end_time).toDate(),
+                carry_over: stage.carry_over ?? false,
+                eligible_teams: stage.eligible_teams,
             })) : [],
             challenges: game_info.challenges?.map((challenge) => ({
                 challenge_id: challenge.challenge_id,
@@ -127,6 +131,7 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
             description: values.description,
             poster: values.poster,
             invite_code: values.invite_code,
+            flag_prefix: values.flag_prefix ? values.flag_prefix : null,
             start_time: format_date(values.start_time ?? new Date()),
             end_time: format_date(values.end_time ?? new Date()),
             practice_mode: values.practice_mode,
@@ -134,6 +139,7 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
             container_number_limit: values.container_number_limit,
             require_wp: values.require_wp,
             wp_expire_time: format_date(values.wp_expire_time ?? new Date()),
+            freeze_time: values.freeze_time ? format_date(values.freeze_time) : null,
             stages: values.stages,
             visible: values.visible,
             team_policy: values.team_policy,
@@ -105,6 +105,25 @@ export function DetailedSettingsModule({
                         )}
                     />
 
+                    {/* Flag 前缀 */}
+                    <FormField
+                        control={form.control}
+                        name="flag_prefix"
+                        render={({ field }) => (
+                            <FormItem>
+                                <div className="flex items-center h-[20px]">
+                                    <FormLabel>Flag 前缀</FormLabel>
+                                    <div className="flex-1" />
+                                    <FormMessage className="text-[14px]" />
+                                </div>
+                                <FormControl>
+                                    <Input {...field} placeholder="flag" />
+                                </FormControl>
+                                <FormDescription>题目没有单独设置前缀时，提交的 Flag 需要符合 前缀{"{...}"} 的格式，不需要请留空</FormDescription>
+                            </FormItem>
+                        )}
+                    />
+
                     {/* 队伍策略 */}
                     <FormField
                         control={form.control}
@@ -155,6 +174,33 @@ export function DetailedSettingsModule({
                         )}
                     />
 
+                    {/* 封榜时间 */}
+                    <FormField
+                        control={form.control}
+                        name={`freeze_time`}
+                        render={({ field }) => (
+                            <FormItem className="flex flex-col">
+                                <FormLabel>封榜时间</FormLabel>
+                                <div className="flex items-center gap-2">
+                                    <DateTimePicker24h
+                                        date={field.value ?? undefined}
+                                        setDate={field.onChange}
+                                    />
+                                    {field.value && (
+                                        <span
+                                            className="text-sm text-muted-foreground cursor-pointer hover:underline"
+                                            onClick={() => field.onChange(null)}
+                                        >
+                                            取消封榜
+                                        </span>
+                                    )}
+                                </div>
+                                <FormDescription>封榜后排行榜只显示封榜前的排名，比赛结束后由管理员揭晓</FormDescription>
+                                <FormMessage />
+                            </FormItem>
+                        )}
+                    />
+
                     {/* 队伍人数限制 */}
                     <FormField
                         control={form.control}
@@ -36,9 +36,14 @@ export const GameChallengeSchema = z.object({
     enable_blood_reward: z.boolean(),
     hints: z.array(
         z.object({
+            hint_id: z.string().optional(),
             content: z.string().optional(),
             create_time: z.string(),
             visible: z.boolean(),
+            cost: z.coerce.number().min(0).optional(),
+            penalty_seconds: z.coerce.number().int().min(0).optional(),
+            release_time: z.string().optional(),
+            release_after_no_solve: z.coerce.number().int().min(0).optional(),
         })
     ),
     visible: z.boolean(),
@@ -59,6 +64,7 @@ export const EditGameFormSchema = z.object({
     description: z.string().optional(),
     poster: z.string().optional(),
     invite_code: z.string().optional(),
+    flag_prefix: z.string().optional(),
     start_time: z.date().optional(),
     end_time: z.date().optional(),
     practice_mode: z.boolean(),
@@ -68,6 +74,7 @@ export const EditGameFormSchema = z.object({
     container_number_limit: z.coerce.number().min(1),
     require_wp: z.boolean(),
     wp_expire_time: z.date().optional(),
+    freeze_time: z.date().nullable().optional(),
     first_blood_reward: z.coerce.number(),
     second_blood_reward: z.coerce.number(),
     third_blood_reward: z.coerce.number(),
@@ -77,6 +84,8 @@ export const EditGameFormSchema = z.object({
             stage_name: z.string().nonempty(),
             start_time: z.date(),
             end_time: z.date(),
+            carry_over: z.boolean().optional(),
+            eligible_teams: z.array(z.number()).optional(),
         })
     ).optional(),
     visible: z.boolean(),
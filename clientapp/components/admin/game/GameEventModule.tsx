@@ -723,15 +723,17 @@ export function GameEventModule(
                                         <div className="flex items-center flex-[2] gap-1 min-w-0" title={cheat.challenge_name}>
                                             <Trophy className="w-4 h-4 flex-shrink-0" />
                                             <span className="truncate">{cheat.challenge_name}</span>
-                                            <Badge
-                                                variant="outline"
-                                                className="text-xs select-none hover:bg-blue/10 hover:border-blue/30 cursor-pointer transition-all duration-200 rounded-md px-2 py-1 font-mono"
-                                                onClick={() => {
-                                                    gotoChallenge(cheat.challenge_id)
-                                                }}
-                                            >
-                                                #{cheat.challenge_id}
-                                            </Badge>
+                                            {cheat.challenge_id !== null && (
+                                                <Badge
+                                                    variant="outline"
+                                                    className="text-xs select-none hover:bg-blue/10 hover:border-blue/30 cursor-pointer transition-all duration-200 rounded-md px-2 py-1 font-mono"
+                                                    onClick={() => {
+                                                        gotoChallenge(cheat.challenge_id!)
+                                                    }}
+                                                >
+                                                    #{cheat.challenge_id}
+                                                </Badge>
+                                            )}
                                         </div>
                                         <div className="flex items-center flex-[2] gap-1 min-w-0">
                                             {(() => {
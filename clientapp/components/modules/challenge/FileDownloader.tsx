@@ -121,7 +121,8 @@ const FileDownloader = (
                 }
             };
 
-            if (attach.attach_type == AttachmentType.STATICFILE) {
+            // attach_url 经过下载记录接口跳转, 静态文件也一样
+            if (attach.attach_type == AttachmentType.STATICFILE && !attach.attach_url) {
                 fetchFile(`/api/file/download/${attach.attach_hash}`)
             } else {
                 fetchFile(attach.attach_url ?? "");
@@ -211,6 +211,33 @@ export interface JudgeConfig {
   flag_template: string;
   judge_script?: string | null;
   judge_type: JudgeType;
+  per_container_flag?: boolean;
+  flag_answers?: string[];
+  flag_regexps?: string[];
+  flag_case_insensitive?: boolean;
+  flag_trim_space?: boolean;
+  flag_normalize_nfkc?: boolean;
+  /** flag 前缀, 为空时使用比赛的默认前缀, 空字符串表示不检查格式 */
+  flag_prefix?: string | null;
+  sub_flags?: SubFlagConfig[];
+  honeypot?: HoneypotConfig;
+}
+
+/** 蜜罐 flag 放入靶机的位置，环境变量和文件至少配置一个 */
+export interface HoneypotConfig {
+  /** 注入的环境变量名 */
+  env_name?: string;
+  /** 写入的文件路径，必须是绝对路径 */
+  file_path?: string;
+  /** 假 flag 的生成模板，为空时使用 <flag 前缀>{[random_string_32]} */
+  template?: string;
+}
+
+export interface SubFlagConfig {
+  name: string;
+  weight: number;
+  flag_type: FlagType;
+  flag_template: string;
 }
 
 export interface EnvironmentItem {
@@ -253,6 +280,62 @@ export interface GameStage {
   start_time: string;
   /** @format date-time */
   end_time: string;
+  /** 阶段排行榜是否累加之前阶段的分数 */
+  carry_over?: boolean;
+  /** 可以参加这个阶段的队伍, 为空时所有队伍都可以参加 */
+  eligible_teams?: number[];
+}
+
+export interface AdminRevealScoreboardPayload {
+  /**
+   * 每一步之间间隔的秒数
+   * @min 0
+   * @max 60
+   * @default 3
+   */
+  step_interval?: number;
+}
+
+/** 揭晓排行榜时的一步, 一次揭晓一支队伍封榜后的全部得分 */
+export interface ScoreboardRevealStep {
+  step: number;
+  total_steps: number;
+  /** @format int64 */
+  team_id: number;
+  team_name: string;
+  prev_rank: number;
+  new_rank: number;
+  /** @format float */
+  prev_score: number;
+  /** @format float */
+  new_score: number;
+  new_solves: SolvedChallenge[];
+  partial_solves: PartialSolvedChallenge[];
+}
+
+export interface AdminAdvanceStagePayload {
+  from_stage: string;
+  to_stage: string;
+  /**
+   * 上一阶段排名前多少的队伍晋级
+   * @min 1
+   */
+  top_n: number;
+}
+
+/** 题目的前置条件, 队伍满足全部条件后才能看到题目 */
+export interface ChallengePrerequisites {
+  /** 需要解出的前置题目 ID */
+  challenges?: number[];
+  /** 为 0 时需要解出全部前置题目, 否则解出其中任意这么多道即可 */
+  min_challenges?: number;
+  /** 队伍分数需要达到的值 */
+  min_score?: number;
+  /** 每个类别需要解出的题目数量 */
+  categories?: {
+    category: ChallengeCategory;
+    min_solves: number;
+  }[];
 }
 
 export interface AdminDetailGameChallenge {
@@ -263,11 +346,37 @@ export interface AdminDetailGameChallenge {
   /** @format double */
   cur_score?: number;
   hints?: {
+    /** 保存题目时自动生成 */
+    hint_id?: string;
     content: string;
     /** @format date-time */
     create_time: string;
     visible: boolean;
+    /** 解锁提示扣除的分数, 大于 0 时需要队伍手动解锁 */
+    cost?: number;
+    /** 解锁提示增加的罚时, 单位秒, 大于 0 时需要队伍手动解锁 */
+    penalty_seconds?: number;
+    /**
+     * 定时发布时间, 发布后清空
+     * @format date-time
+     */
+    release_time?: string;
+    /** 题目持续这么多分钟没有队伍解出时自动发布, 发布后清空 */
+    release_after_no_solve?: number;
   }[];
+  /**
+   * 定时公开题目的时间, 发布后清空
+   * @format date-time
+   */
+  release_time?: string | null;
+  /** 比赛持续这么多分钟没有队伍解题时自动公开题目, 发布后清空 */
+  release_after_no_solve?: number | null;
+  /**
+   * 题目最近一次公开的时间
+   * @format date-time
+   */
+  visible_time?: string | null;
+  prerequisites?: ChallengePrerequisites | null;
   belong_stage?: string;
   solve_count?: number;
   visible?: boolean;
@@ -277,6 +386,60 @@ export interface AdminDetailGameChallenge {
   /** @format double */
   difficulty?: number;
   enable_blood_reward?: boolean;
+  /** 为空时使用比赛的计分方式 */
+  scoring_strategy?: ScoringStrategy | null;
+}
+
+export type ScoringStrategy =
+  | "static"
+  | "exponential"
+  | "linear"
+  | "logarithmic"
+  | "quadratic";
+
+export interface AdminScorePreviewPayload {
+  scoring_strategy?: ScoringStrategy;
+  total_score?: number;
+  minimal_score?: number;
+  difficulty?: number;
+  /**
+   * 预览接下来多少次解题，默认 30
+   * @min 0
+   * @max 1000
+   */
+  solves?: number;
+}
+
+export interface AdminHintUsage {
+  hint_id: string;
+  content: string;
+  visible: boolean;
+  cost: number;
+  penalty_seconds: number;
+  unlock_count: number;
+  unlocks: {
+    unlock_id: string;
+    team_id: number;
+    team_name: string;
+    user_id: string;
+    username: string;
+    cost: number;
+    penalty_seconds: number;
+    /** @format date-time */
+    unlock_time: string;
+  }[];
+}
+
+export interface AdminScorePreview {
+  scoring_strategy: ScoringStrategy;
+  total_score: number;
+  minimal_score: number;
+  difficulty: number;
+  cur_solve_count: number;
+  points: {
+    solve_count: number;
+    score: number;
+  }[];
 }
 
 export interface AddGameChallengePayload {
@@ -310,6 +473,16 @@ export interface AdminFullGameInfo {
   first_blood_reward?: number;
   second_blood_reward?: number;
   third_blood_reward?: number;
+  scoring_strategy?: ScoringStrategy;
+  /**
+   * 封榜时间, 之后的解题不会出现在公开排行榜上, 为空时不封榜
+   * @format date-time
+   */
+  freeze_time?: string | null;
+  /** 管理员是否已经揭晓封榜后的排名 */
+  scoreboard_revealed?: boolean;
+  /** 题目没有单独设置时使用的 flag 前缀, 为空时不检查格式 */
+  flag_prefix?: string | null;
   challenges?: AdminDetailGameChallenge[];
 }
 
@@ -388,6 +561,17 @@ export interface UserAttachmentConfig {
   download_hash?: string | null;
 }
 
+export interface UserHintItem {
+  hint_id: string;
+  /** 未解锁时为空 */
+  content: string;
+  /** @format date-time */
+  create_time: string;
+  cost: number;
+  penalty_seconds: number;
+  locked: boolean;
+}
+
 export interface UserDetailGameChallenge {
   challenge_id: number;
   challenge_name: string;
@@ -396,12 +580,7 @@ export interface UserDetailGameChallenge {
   total_score: number;
   /** @format double */
   cur_score: number;
-  hints?: {
-    content: string;
-    /** @format date-time */
-    create_time: string;
-    visible: boolean;
-  }[];
+  hints?: UserHintItem[];
   belong_stage?: string;
   solve_count?: number;
   category?: ChallengeCategory;
@@ -512,12 +691,28 @@ export interface CreateGameTeamPayload {
   group_id?: number | null;
 }
 
+export interface UserGatewayTokenPayload {
+  container_name: string;
+  port_name: string;
+}
+
+export interface GatewayTokenInfo {
+  token: string;
+  /** WebSocket path of the gateway */
+  path: string;
+  /** Subprotocol to send together with the token */
+  subprotocol: string;
+  /** @format date-time */
+  expire_time: string;
+}
+
 export interface ExposePortInfo {
   container_name: string;
   container_ports: {
     port_name: string;
     port: number;
     ip: string;
+    hostname?: string;
   }[];
 }
 
@@ -539,6 +734,12 @@ export interface GameScoreboardData {
   challenges?: UserSimpleGameChallenge[];
   groups?: GameGroupSimple[];
   current_group?: GameGroupSimple;
+  stages?: string[];
+  current_stage?: string | null;
+  /** 排行榜是否处于封榜状态 */
+  frozen?: boolean;
+  /** @format date-time */
+  freeze_time?: string | null;
   pagination?: PaginationInfo;
 }
 
@@ -568,9 +769,21 @@ export interface TeamScore {
   /** 所属分组名称 */
   group_name?: string | null;
   solved_challenges?: SolvedChallenge[];
+  partial_solves?: PartialSolvedChallenge[];
   score_adjustments?: TeamScoreAdjustment[];
 }
 
+/** 多段 flag 题目还没有完整解出时已经获得的部分分数 */
+export interface PartialSolvedChallenge {
+  challenge_id?: number;
+  challenge_name?: string;
+  sub_flags?: string[];
+  /** @format float */
+  score?: number;
+  /** @format date-time */
+  solve_time?: string;
+}
+
 export interface SolvedChallenge {
   /** @example 1 */
   challenge_id?: number;
@@ -599,8 +812,8 @@ export interface SolvedChallenge {
 export interface TeamScoreAdjustment {
   /** 分数修正ID */
   adjustment_id: number;
-  /** 修正类型 */
-  adjustment_type: "cheat" | "reward" | "other";
+  /** 修正类型, hint 为解锁提示扣分, 只在积分榜中出现 */
+  adjustment_type: "cheat" | "reward" | "other" | "hint";
   /** 分数变化量 */
   score_change: number;
   /** 修正原因 */
@@ -754,6 +967,7 @@ export interface AdminContainerItem {
     port_name: string;
     port: number;
     ip: string;
+    hostname?: string;
   }[];
   team_name: string;
   game_name: string;
@@ -1105,6 +1319,7 @@ export interface AdminListSubmitsPayload {
     | "JudgeTimeout"
     | "JudgeQueueing"
     | "JudgeRunning"
+    | "JudgePartialAC"
   )[];
   /**
    * 开始时间（可选）
@@ -1138,7 +1353,8 @@ export interface AdminSubmitItem {
     | "JudgeError"
     | "JudgeTimeout"
     | "JudgeQueueing"
-    | "JudgeRunning";
+    | "JudgeRunning"
+    | "JudgePartialAC";
   /**
    * 判题时间
    * @format date-time
@@ -1166,7 +1382,13 @@ export interface AdminListCheatsPayload {
     | "SubmitSomeonesFlag"
     | "SubmitWithoutDownloadAttachments"
     | "SubmitWithoutStartContainer"
+    | "SharedIPAcrossTeams"
+    | "SameRegisterIPAcrossTeams"
+    | "SolveTimingCorrelation"
+    | "SubmitHoneypotFlag"
   )[];
+  /** 审核状态列表（可选，OR 关系） */
+  review_statuses?: ("Pending" | "Confirmed" | "Dismissed")[];
   /**
    * 开始时间（可选）
    * @format date-time
@@ -1186,23 +1408,27 @@ export interface AdminCheatItem {
   cheat_type:
     | "SubmitSomeonesFlag"
     | "SubmitWithoutDownloadAttachments"
-    | "SubmitWithoutStartContainer";
+    | "SubmitWithoutStartContainer"
+    | "SharedIPAcrossTeams"
+    | "SameRegisterIPAcrossTeams"
+    | "SolveTimingCorrelation"
+    | "SubmitHoneypotFlag";
   /** 作弊者用户名 */
   username: string;
   /** 作弊者队伍名 */
   team_name: string;
   /** 队伍ID */
   team_id: number;
-  /** 题目ID */
-  challenge_id: number;
+  /** 题目ID, 队伍级别的作弊记录为空 */
+  challenge_id: number | null;
   /** 题目名称 */
   challenge_name: string;
-  /** 相关判题ID */
-  judge_id: string;
+  /** 相关判题ID, 队伍级别的作弊记录为空 */
+  judge_id: string | null;
   /** 相关FLAG ID */
   flag_id?: number | null;
   /** 额外数据 */
-  extra_data: object;
+  extra_data: CheatExtraData;
   /**
    * 作弊时间
    * @format date-time
@@ -1210,6 +1436,78 @@ export interface AdminCheatItem {
   cheat_time: string;
   /** 提交者IP地址 */
   submiter_ip?: string | null;
+  /** 审核状态 */
+  review_status: "Pending" | "Confirmed" | "Dismissed";
+  /** 审核人ID */
+  reviewer_id?: string | null;
+  /** 审核人用户名 */
+  reviewer_name?: string | null;
+  /** 审核备注 */
+  review_note?: string | null;
+  /**
+   * 审核时间
+   * @format date-time
+   */
+  review_time?: string | null;
+  /** 确认作弊时创建的分数修正ID */
+  adjustment_id?: number | null;
+}
+
+export interface AdminReviewCheatPayload {
+  /** 审核结论 */
+  review_status: "Pending" | "Confirmed" | "Dismissed";
+  /** 审核备注 */
+  review_note?: string | null;
+  /**
+   * 扣除的分数，大于 0 时创建一条 cheat 类型的分数修正（仅确认时）
+   * @min 0
+   */
+  score_penalty?: number;
+  /** 删除这条记录涉及到的解题记录（仅确认时） */
+  revoke_solves?: boolean;
+  /** 禁赛该队伍（仅确认时） */
+  ban_team?: boolean;
+}
+
+/** IP 关联分析的证据 */
+export interface CheatEvidence {
+  ip: string;
+  source: "Submit" | "Container" | "Login" | "Register";
+  team_id: number;
+  team_name: string;
+  user_id: string;
+  user_name: string;
+  /** @format date-time */
+  time: string;
+}
+
+/** 两个队伍在同一道题上的解题时间 */
+export interface CheatSolveEvidence {
+  challenge_id: number;
+  challenge_name: string;
+  /** @format date-time */
+  solve_time: string;
+  /** @format date-time */
+  relevant_solve_time: string;
+  gap_seconds: number;
+}
+
+/** 额外数据 */
+export interface CheatExtraData {
+  /** 相关队伍ID */
+  relevant_team: number;
+  /** 相关队伍名称 */
+  relevant_teamname: string;
+  /** 判定原因 */
+  reason?: string;
+  /** 没有下载的附件 */
+  attachments?: string[];
+  /** 多个队伍共用的 IP */
+  ip?: string;
+  evidence?: CheatEvidence[];
+  /** 解题时间关联分析的相似度, 0 到 1 */
+  correlation_score?: number;
+  solves?: CheatSolveEvidence[];
 }
 
 /** 系统设置完整结构体 */
@@ -2081,6 +2379,33 @@ export class Api<
         ...params,
       }),
 
+    /**
+     * @description Unlock a hint of a game challenge, the hint cost and time penalty are applied to the team
+     *
+     * @tags user
+     * @name UserUnlockGameHint
+     * @summary Unlock a hint
+     * @request POST:/api/game/{game_id}/challenge/{challenge_id}/hint/{hint_id}/unlock
+     */
+    userUnlockGameHint: (
+      gameId: number,
+      challengeId: number,
+      hintId: string,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          data: UserHintItem;
+        },
+        ErrorMessage
+      >({
+        path: `/api/game/${gameId}/challenge/${challengeId}/hint/${hintId}/unlock`,
+        method: "POST",
+        format: "json",
+        ...params,
+      }),
+
     /**
      * @description Get game notices
      *
@@ -2188,7 +2513,10 @@ export class Api<
               | "JudgeError"
               | "JudgeWA"
               | "JudgeAC"
-              | "JudgeTimeout";
+              | "JudgeTimeout"
+              | "JudgePartialAC";
+            /** Message returned by the judge script */
+            judge_result?: string;
           };
         },
         void | ErrorMessage
@@ -2297,6 +2625,50 @@ export class Api<
         ...params,
       }),
 
+    /**
+     * @description Get a token for connecting to a container port through the TCP over WebSocket gateway, the token expires with the container
+     *
+     * @tags user
+     * @name UserGetContainerGatewayToken
+     * @summary Get a gateway token for a container port
+     * @request POST:/api/game/{game_id}/container/{challenge_id}/gateway
+     */
+    userGetContainerGatewayToken: (
+      gameId: number,
+      challengeId: number,
+      data: UserGatewayTokenPayload,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          data: GatewayTokenInfo;
+        },
+        void | ErrorMessage
+      >({
+        path: `/api/game/${gameId}/container/${challengeId}/gateway`,
+        method: "POST",
+        body: data,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description Upgrade to a WebSocket connection forwarded to the container port, binary messages carry the TCP stream. Browsers pass the subprotocols `a1ctf-gateway` and the token, other clients can use `Authorization: Bearer <token>`.
+     *
+     * @tags user
+     * @name UserConnectContainerGateway
+     * @summary Connect to a container port over WebSocket
+     * @request GET:/api/gateway/tcp
+     */
+    userConnectContainerGateway: (params: RequestParams = {}) =>
+      this.request<any, ErrorMessage>({
+        path: `/api/gateway/tcp`,
+        method: "GET",
+        ...params,
+      }),
+
     /**
      * No description
      *
@@ -2310,6 +2682,8 @@ export class Api<
       query?: {
         /** 分组ID，如果不传则显示所有队伍 */
         group_id?: number;
+        /** 阶段名称，如果不传则显示总榜 */
+        stage?: string;
         /**
          * 页码，从1开始
          * @default 1
@@ -2764,6 +3138,124 @@ export class Api<
         ...params,
       }),
 
+    /**
+     * @description Show the score of the challenge for the next N solves, unsaved scoring parameters can be passed in
+     *
+     * @tags admin
+     * @name PreviewGameChallengeScore
+     * @summary Preview the score curve of a game challenge
+     * @request POST:/api/admin/game/{game_id}/challenge/{challenge_id}/score-preview
+     */
+    previewGameChallengeScore: (
+      gameId: number,
+      challengeId: number,
+      data: AdminScorePreviewPayload,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          data: AdminScorePreview;
+        },
+        ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/challenge/${challengeId}/score-preview`,
+        method: "POST",
+        body: data,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description Reveal the teams' post-freeze results step by step after the game ends, every step is also pushed over the game websocket
+     *
+     * @tags admin
+     * @name RevealGameScoreboard
+     * @summary Reveal the frozen scoreboard
+     * @request POST:/api/admin/game/{game_id}/scoreboard/reveal
+     */
+    revealGameScoreboard: (
+      gameId: number,
+      data: AdminRevealScoreboardPayload,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          message: string;
+          data: ScoreboardRevealStep[];
+        },
+        ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/scoreboard/reveal`,
+        method: "POST",
+        body: data,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description Only the top N teams of from_stage can take part in to_stage
+     *
+     * @tags admin
+     * @name AdvanceGameStage
+     * @summary Advance top teams to the next stage
+     * @request POST:/api/admin/game/{game_id}/stages/advance
+     */
+    advanceGameStage: (
+      gameId: number,
+      data: AdminAdvanceStagePayload,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          message: string;
+          data: {
+            from_stage?: string;
+            to_stage?: string;
+            top_n?: number;
+            eligible_teams?: number[];
+          };
+        },
+        ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/stages/advance`,
+        method: "POST",
+        body: data,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description List every hint of the challenge with the teams that unlocked it
+     *
+     * @tags admin
+     * @name GetGameChallengeHintUsage
+     * @summary Get hint usage of a game challenge
+     * @request GET:/api/admin/game/{game_id}/challenge/{challenge_id}/hints/unlocks
+     */
+    getGameChallengeHintUsage: (
+      gameId: number,
+      challengeId: number,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          data: AdminHintUsage[];
+        },
+        ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/challenge/${challengeId}/hints/unlocks`,
+        method: "GET",
+        format: "json",
+        ...params,
+      }),
+
     /**
      * @description Get all score adjustments for a specific game
      *
@@ -3676,6 +4168,36 @@ export class Api<
         format: "json",
         ...params,
       }),
+
+    /**
+     * @description 设置作弊记录的审核结论，确认作弊时可以同时扣分、删除相关解题记录和禁赛队伍
+     *
+     * @tags admin
+     * @name AdminReviewCheat
+     * @summary 审核作弊记录
+     * @request PUT:/api/admin/game/{game_id}/cheats/{cheat_id}/review
+     */
+    adminReviewCheat: (
+      gameId: number,
+      cheatId: string,
+      data: AdminReviewCheatPayload,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          message: string;
+          data?: object;
+        },
+        void
+      >({
+        path: `/api/admin/game/${gameId}/cheats/${cheatId}/review`,
+        method: "PUT",
+        body: data,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
   };
   file = {
     /**
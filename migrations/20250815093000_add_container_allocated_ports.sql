@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE containers ADD COLUMN allocated_ports jsonb NOT NULL DEFAULT '[]'::jsonb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE containers DROP COLUMN allocated_ports;
+-- +goose StatementEnd
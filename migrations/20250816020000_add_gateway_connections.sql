@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "gateway_connections" (
+    "connection_id" uuid NOT NULL,
+    "game_id" bigint NOT NULL,
+    "team_id" bigint NOT NULL,
+    "user_id" uuid NOT NULL,
+    "container_id" uuid NOT NULL,
+    "challenge_id" bigint NOT NULL,
+    "container_name" text NOT NULL,
+    "port_name" text NOT NULL,
+    "client_ip" text NOT NULL,
+    "start_time" timestamp NOT NULL,
+    "end_time" timestamp,
+    "bytes_in" bigint NOT NULL DEFAULT 0,
+    "bytes_out" bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (connection_id),
+    CONSTRAINT gateway_connections_game_id_fkey FOREIGN KEY (game_id)
+        REFERENCES games(game_id) ON DELETE CASCADE,
+    CONSTRAINT gateway_connections_team_id_fkey FOREIGN KEY (team_id)
+        REFERENCES teams(team_id) ON DELETE CASCADE,
+    CONSTRAINT gateway_connections_container_id_fkey FOREIGN KEY (container_id)
+        REFERENCES containers(container_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_gateway_connections_game_team ON gateway_connections(game_id, team_id);
+CREATE INDEX idx_gateway_connections_client_ip ON gateway_connections(client_ip);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS gateway_connections;
+-- +goose StatementEnd
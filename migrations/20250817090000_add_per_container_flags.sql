@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE containers ADD COLUMN container_flag text;
+ALTER TABLE judges ADD COLUMN container_id uuid;
+
+CREATE INDEX idx_containers_container_flag ON containers(container_flag) WHERE container_flag IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_containers_container_flag;
+ALTER TABLE judges DROP COLUMN container_id;
+ALTER TABLE containers DROP COLUMN container_flag;
+-- +goose StatementEnd
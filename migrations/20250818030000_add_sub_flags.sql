@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "team_sub_flags" (
+    "team_id" bigint NOT NULL,
+    "ingame_id" bigint NOT NULL,
+    "sub_flag" text NOT NULL,
+    "game_id" bigint NOT NULL,
+    "flag_content" text NOT NULL,
+    PRIMARY KEY (team_id, ingame_id, sub_flag),
+    CONSTRAINT team_sub_flags_team_id_fkey FOREIGN KEY (team_id)
+        REFERENCES teams(team_id) ON DELETE CASCADE,
+    CONSTRAINT team_sub_flags_ingame_id_fkey FOREIGN KEY (ingame_id)
+        REFERENCES game_challenges(ingame_id) ON DELETE CASCADE
+);
+
+CREATE TABLE "sub_flag_solves" (
+    "team_id" bigint NOT NULL,
+    "ingame_id" bigint NOT NULL,
+    "sub_flag" text NOT NULL,
+    "game_id" bigint NOT NULL,
+    "challenge_id" bigint NOT NULL,
+    "judge_id" uuid NOT NULL,
+    "solver_id" uuid NOT NULL,
+    "container_id" uuid,
+    "solve_time" timestamp NOT NULL,
+    PRIMARY KEY (team_id, ingame_id, sub_flag),
+    CONSTRAINT sub_flag_solves_team_id_fkey FOREIGN KEY (team_id)
+        REFERENCES teams(team_id) ON DELETE CASCADE,
+    CONSTRAINT sub_flag_solves_ingame_id_fkey FOREIGN KEY (ingame_id)
+        REFERENCES game_challenges(ingame_id) ON DELETE CASCADE,
+    CONSTRAINT sub_flag_solves_judge_id_fkey FOREIGN KEY (judge_id)
+        REFERENCES judges(judge_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sub_flag_solves_game_id ON sub_flag_solves(game_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sub_flag_solves;
+DROP TABLE IF EXISTS team_sub_flags;
+-- +goose StatementEnd
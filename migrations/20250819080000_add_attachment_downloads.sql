@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "attachment_downloads" (
+    "download_id" uuid NOT NULL,
+    "game_id" bigint NOT NULL,
+    "ingame_id" bigint NOT NULL,
+    "challenge_id" bigint NOT NULL,
+    "team_id" bigint NOT NULL,
+    "user_id" uuid NOT NULL,
+    "attach_name" text NOT NULL,
+    "download_time" timestamp NOT NULL,
+    "client_ip" text,
+    PRIMARY KEY (download_id),
+    CONSTRAINT attachment_downloads_team_id_fkey FOREIGN KEY (team_id)
+        REFERENCES teams(team_id) ON DELETE CASCADE,
+    CONSTRAINT attachment_downloads_ingame_id_fkey FOREIGN KEY (ingame_id)
+        REFERENCES game_challenges(ingame_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_attachment_downloads_team_ingame ON attachment_downloads(team_id, ingame_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS attachment_downloads;
+-- +goose StatementEnd
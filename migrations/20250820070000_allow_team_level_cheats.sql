@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- IP 关联分析得到的作弊记录是队伍级别的, 不对应具体的题目和判题
+ALTER TABLE "cheats" ALTER COLUMN "ingame_id" DROP NOT NULL;
+ALTER TABLE "cheats" ALTER COLUMN "challenge_id" DROP NOT NULL;
+ALTER TABLE "cheats" ALTER COLUMN "judge_id" DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_cheats_game_type ON cheats(game_id, cheat_type);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_cheats_game_type;
+
+DELETE FROM "cheats" WHERE ingame_id IS NULL OR challenge_id IS NULL OR judge_id IS NULL;
+ALTER TABLE "cheats" ALTER COLUMN "ingame_id" SET NOT NULL;
+ALTER TABLE "cheats" ALTER COLUMN "challenge_id" SET NOT NULL;
+ALTER TABLE "cheats" ALTER COLUMN "judge_id" SET NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "cheats" ADD COLUMN "review_status" text NOT NULL DEFAULT 'Pending';
+ALTER TABLE "cheats" ADD COLUMN "reviewer_id" uuid;
+ALTER TABLE "cheats" ADD COLUMN "review_note" text;
+ALTER TABLE "cheats" ADD COLUMN "review_time" timestamp;
+ALTER TABLE "cheats" ADD COLUMN "adjustment_id" bigint;
+
+ALTER TABLE "cheats" ADD CONSTRAINT cheats_reviewer_id_fkey FOREIGN KEY (reviewer_id)
+    REFERENCES users(user_id) ON DELETE SET NULL;
+ALTER TABLE "cheats" ADD CONSTRAINT cheats_adjustment_id_fkey FOREIGN KEY (adjustment_id)
+    REFERENCES score_adjustments(adjustment_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_cheats_game_review_status ON cheats(game_id, review_status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_cheats_game_review_status;
+ALTER TABLE "cheats" DROP CONSTRAINT IF EXISTS cheats_adjustment_id_fkey;
+ALTER TABLE "cheats" DROP CONSTRAINT IF EXISTS cheats_reviewer_id_fkey;
+ALTER TABLE "cheats" DROP COLUMN IF EXISTS "adjustment_id";
+ALTER TABLE "cheats" DROP COLUMN IF EXISTS "review_time";
+ALTER TABLE "cheats" DROP COLUMN IF EXISTS "review_note";
+ALTER TABLE "cheats" DROP COLUMN IF EXISTS "reviewer_id";
+ALTER TABLE "cheats" DROP COLUMN IF EXISTS "review_status";
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "containers" ADD COLUMN "decoy_flag" text;
+
+CREATE INDEX idx_containers_decoy_flag ON containers(decoy_flag) WHERE decoy_flag IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_containers_decoy_flag;
+ALTER TABLE "containers" DROP COLUMN IF EXISTS "decoy_flag";
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "games" ADD COLUMN "scoring_strategy" text NOT NULL DEFAULT 'exponential';
+ALTER TABLE "game_challenges" ADD COLUMN "scoring_strategy" text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "game_challenges" DROP COLUMN IF EXISTS "scoring_strategy";
+ALTER TABLE "games" DROP COLUMN IF EXISTS "scoring_strategy";
+-- +goose StatementEnd
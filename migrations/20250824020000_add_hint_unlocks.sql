@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "hint_unlocks" (
+    "unlock_id" uuid NOT NULL,
+    "game_id" bigint NOT NULL,
+    "ingame_id" bigint NOT NULL,
+    "challenge_id" bigint NOT NULL,
+    "team_id" bigint NOT NULL,
+    "user_id" uuid NOT NULL,
+    "hint_id" text NOT NULL,
+    "cost" double precision NOT NULL DEFAULT 0,
+    "penalty_seconds" bigint NOT NULL DEFAULT 0,
+    "unlock_time" timestamp NOT NULL,
+    PRIMARY KEY (unlock_id),
+    CONSTRAINT hint_unlocks_team_id_fkey FOREIGN KEY (team_id)
+        REFERENCES teams(team_id) ON DELETE CASCADE,
+    CONSTRAINT hint_unlocks_ingame_id_fkey FOREIGN KEY (ingame_id)
+        REFERENCES game_challenges(ingame_id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_hint_unlocks_team_hint ON hint_unlocks(team_id, ingame_id, hint_id);
+CREATE INDEX idx_hint_unlocks_game_ingame ON hint_unlocks(game_id, ingame_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS hint_unlocks;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "game_challenges" ADD COLUMN "release_time" timestamp;
+ALTER TABLE "game_challenges" ADD COLUMN "release_after_no_solve" bigint;
+ALTER TABLE "game_challenges" ADD COLUMN "visible_time" timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "game_challenges" DROP COLUMN IF EXISTS "visible_time";
+ALTER TABLE "game_challenges" DROP COLUMN IF EXISTS "release_after_no_solve";
+ALTER TABLE "game_challenges" DROP COLUMN IF EXISTS "release_time";
+-- +goose StatementEnd
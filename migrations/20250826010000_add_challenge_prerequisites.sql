@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "game_challenges" ADD COLUMN "prerequisites" jsonb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "game_challenges" DROP COLUMN IF EXISTS "prerequisites";
+-- +goose StatementEnd
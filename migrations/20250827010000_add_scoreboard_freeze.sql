@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "games" ADD COLUMN "freeze_time" timestamp;
+ALTER TABLE "games" ADD COLUMN "scoreboard_revealed" boolean NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "games" DROP COLUMN IF EXISTS "scoreboard_revealed";
+ALTER TABLE "games" DROP COLUMN IF EXISTS "freeze_time";
+-- +goose StatementEnd
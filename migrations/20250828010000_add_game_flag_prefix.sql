@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "games" ADD COLUMN "flag_prefix" text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "games" DROP COLUMN IF EXISTS "flag_prefix";
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- 允许出网的题目本来就不限制 DNS, 和实际行为保持一致
+UPDATE challenges SET allow_dns = TRUE WHERE allow_wan = TRUE AND allow_dns = FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 1;
+-- +goose StatementEnd
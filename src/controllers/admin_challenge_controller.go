@@ -16,6 +16,7 @@ import (
 	dbtool "a1ctf/src/utils/db_tool"
 	dockertool "a1ctf/src/utils/docker_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
 	"a1ctf/src/utils/ristretto_tool"
 	"a1ctf/src/webmodels"
 )
@@ -129,6 +130,23 @@ func AdminCreateChallenge(c *gin.Context) {
 		return
 	}
 
+	// 允许出网时不会限制 DNS, 不允许这种配置避免误以为 DNS 被禁用
+	if payload.AllowWAN && !payload.AllowDNS {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "WANRequiresDNS"}),
+		})
+		return
+	}
+
+	if err := judgetool.ValidJudgeConfig(payload.JudgeConfig); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	payload.CreateTime = time.Now().UTC()
 	payload.ChallengeID = nil
 
@@ -222,6 +240,23 @@ func AdminUpdateChallenge(c *gin.Context) {
 		}
 	}
 
+	// 允许出网时不会限制 DNS, 不允许这种配置避免误以为 DNS 被禁用
+	if payload.AllowWAN && !payload.AllowDNS {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "WANRequiresDNS"}),
+		})
+		return
+	}
+
+	if err := judgetool.ValidJudgeConfig(payload.JudgeConfig); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	var existingChallenge models.Challenge
 	if err := dbtool.DB().Where("challenge_id = ?", payload.ChallengeID).First(&existingChallenge).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
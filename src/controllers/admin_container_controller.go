@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"a1ctf/src/db/models"
+	"a1ctf/src/jobs"
+	containerbackend "a1ctf/src/modules/container_backend"
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
 	"a1ctf/src/webmodels"
@@ -314,3 +316,58 @@ func AdminGetContainerFlag(c *gin.Context) {
 		},
 	})
 }
+
+// AdminGetPortPoolUsage 获取宿主机端口池使用情况
+func AdminGetPortPoolUsage(c *gin.Context) {
+	usage, err := containerbackend.GetPortPoolUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadPortPool"}),
+		})
+		return
+	}
+
+	allocations := make([]webmodels.AdminPortAllocationItem, 0, len(usage.Containers))
+	for _, container := range usage.Containers {
+		allocations = append(allocations, webmodels.AdminPortAllocationItem{
+			ContainerID:     container.ContainerID,
+			GameID:          container.GameID,
+			TeamID:          container.TeamID,
+			TeamHash:        container.TeamHash,
+			ChallengeName:   container.ChallengeName,
+			ContainerStatus: container.ContainerStatus,
+			Ports:           container.AllocatedPorts,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": webmodels.AdminPortPoolUsage{
+			Backend:     containerbackend.Backend.Name(),
+			RangeStart:  usage.Range.Start,
+			RangeEnd:    usage.Range.End,
+			Total:       usage.Range.Size(),
+			Used:        usage.Used,
+			Free:        usage.Range.Size() - usage.Used,
+			Allocations: allocations,
+		},
+	})
+}
+
+// AdminPreviewContainerGC 预览容器回收, 列出将要删除的孤儿实例和已经消失的容器
+func AdminPreviewContainerGC(c *gin.Context) {
+	report, err := jobs.PreviewContainerGC()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": report,
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,16 +17,23 @@ import (
 	"gorm.io/gorm"
 
 	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	"a1ctf/src/utils/general"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
 	noticetool "a1ctf/src/utils/notice_tool"
+	prerequisitetool "a1ctf/src/utils/prerequisite_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	scoringtool "a1ctf/src/utils/scoring_tool"
+	"a1ctf/src/utils/zaphelper"
 	"a1ctf/src/webmodels"
 	"mime"
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
 // helper: convert slice of strings to LIKE patterns for ILIKE ANY
@@ -183,6 +191,10 @@ func AdminGetGame(c *gin.Context) {
 		"second_blood_reward":    game.SecondBloodReward,
 		"third_blood_reward":     game.ThirdBloodReward,
 		"team_policy":            game.TeamPolicy,
+		"scoring_strategy":       scoringtool.Resolve(&game, nil),
+		"freeze_time":            game.FreezeTime,
+		"scoreboard_revealed":    game.ScoreboardRevealed,
+		"flag_prefix":            game.FlagPrefix,
 		"challenges":             make([]gin.H, 0),
 	}
 
@@ -212,18 +224,23 @@ func AdminGetGame(c *gin.Context) {
 		}
 
 		result["challenges"] = append(result["challenges"].([]gin.H), gin.H{
-			"challenge_id":        gc.Challenge.ChallengeID,
-			"challenge_name":      gc.Challenge.Name,
-			"total_score":         gc.TotalScore,
-			"cur_score":           gc.CurScore,
-			"hints":               gc.Hints,
-			"solve_count":         gc.SolveCount,
-			"category":            gc.Challenge.Category,
-			"judge_config":        judgeConfig,
-			"belong_stage":        gc.BelongStage,
-			"visible":             gc.Visible,
-			"minimal_score":       gc.MinimalScore,
-			"enable_blood_reward": gc.BloodRewardEnabled,
+			"challenge_id":           gc.Challenge.ChallengeID,
+			"challenge_name":         gc.Challenge.Name,
+			"total_score":            gc.TotalScore,
+			"cur_score":              gc.CurScore,
+			"hints":                  gc.Hints,
+			"solve_count":            gc.SolveCount,
+			"category":               gc.Challenge.Category,
+			"judge_config":           judgeConfig,
+			"belong_stage":           gc.BelongStage,
+			"visible":                gc.Visible,
+			"minimal_score":          gc.MinimalScore,
+			"enable_blood_reward":    gc.BloodRewardEnabled,
+			"scoring_strategy":       gc.ScoringStrategy,
+			"release_time":           gc.ReleaseTime,
+			"release_after_no_solve": gc.ReleaseAfterNoSolve,
+			"visible_time":           gc.VisibleTime,
+			"prerequisites":          gc.Prerequisites,
 		})
 	}
 
@@ -243,19 +260,24 @@ func AdminGetGameChallenge(c *gin.Context) {
 	}
 
 	result := gin.H{
-		"challenge_id":        gc.Challenge.ChallengeID,
-		"challenge_name":      gc.Challenge.Name,
-		"total_score":         gc.TotalScore,
-		"cur_score":           gc.CurScore,
-		"hints":               gc.Hints,
-		"solve_count":         gc.SolveCount,
-		"category":            gc.Challenge.Category,
-		"judge_config":        judgeConfig,
-		"belong_stage":        gc.BelongStage,
-		"visible":             gc.Visible,
-		"minimal_score":       gc.MinimalScore,
-		"difficulty":          gc.Difficulty,
-		"enable_blood_reward": gc.BloodRewardEnabled,
+		"challenge_id":           gc.Challenge.ChallengeID,
+		"challenge_name":         gc.Challenge.Name,
+		"total_score":            gc.TotalScore,
+		"cur_score":              gc.CurScore,
+		"hints":                  gc.Hints,
+		"solve_count":            gc.SolveCount,
+		"category":               gc.Challenge.Category,
+		"judge_config":           judgeConfig,
+		"belong_stage":           gc.BelongStage,
+		"visible":                gc.Visible,
+		"minimal_score":          gc.MinimalScore,
+		"difficulty":             gc.Difficulty,
+		"enable_blood_reward":    gc.BloodRewardEnabled,
+		"scoring_strategy":       gc.ScoringStrategy,
+		"release_time":           gc.ReleaseTime,
+		"release_after_no_solve": gc.ReleaseAfterNoSolve,
+		"visible_time":           gc.VisibleTime,
+		"prerequisites":          gc.Prerequisites,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -349,6 +371,7 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 		var hints models.Hints
 		if hintsBytes, err := sonic.Marshal(hintsData); err == nil {
 			if err := sonic.Unmarshal(hintsBytes, &hints); err == nil {
+				hints.AssignIDs()
 				updateData["hints"] = hints
 				updateFields = append(updateFields, "hints")
 			}
@@ -359,6 +382,13 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 		var judgeConfig models.JudgeConfig
 		if judgeConfigBytes, err := sonic.Marshal(judgeConfigData); err == nil {
 			if err := sonic.Unmarshal(judgeConfigBytes, &judgeConfig); err == nil {
+				if err := judgetool.ValidJudgeConfig(&judgeConfig); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"code":    400,
+						"message": err.Error(),
+					})
+					return
+				}
 				updateData["judge_config"] = judgeConfig
 				updateFields = append(updateFields, "judge_config")
 			}
@@ -367,6 +397,40 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 	if visible, ok := payload["visible"]; ok {
 		updateData["visible"] = visible
 		updateFields = append(updateFields, "visible")
+
+		// 记录题目公开的时间, 用于计算提示的定时发布
+		if isVisible, _ := visible.(bool); isVisible && !existingGameChallenge.Visible {
+			updateData["visible_time"] = time.Now().UTC()
+			updateFields = append(updateFields, "visible_time")
+		}
+	}
+	if releaseTime, ok := payload["release_time"]; ok {
+		// null 或者空字符串表示取消定时发布
+		releaseTimeStr, _ := releaseTime.(string)
+		if releaseTimeStr == "" {
+			updateData["release_time"] = nil
+		} else {
+			parsedTime, err := time.Parse(time.RFC3339, releaseTimeStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidReleaseTime"}),
+				})
+				return
+			}
+			updateData["release_time"] = parsedTime.UTC()
+		}
+		updateFields = append(updateFields, "release_time")
+	}
+	if releaseAfterNoSolve, ok := payload["release_after_no_solve"]; ok {
+		// null 或者不大于 0 表示取消
+		minutes, _ := releaseAfterNoSolve.(float64)
+		if minutes <= 0 {
+			updateData["release_after_no_solve"] = nil
+		} else {
+			updateData["release_after_no_solve"] = int64(minutes)
+		}
+		updateFields = append(updateFields, "release_after_no_solve")
 	}
 	if belongStage, ok := payload["belong_stage"]; ok {
 		updateData["belong_stage"] = belongStage
@@ -384,6 +448,72 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 		updateData["enable_blood_reward"] = bloodRewardEnabled
 		updateFields = append(updateFields, "enable_blood_reward")
 	}
+	if scoringStrategy, ok := payload["scoring_strategy"]; ok {
+		// null 或者空字符串表示使用比赛的计分方式
+		strategy, _ := scoringStrategy.(string)
+		if strategy == "" {
+			updateData["scoring_strategy"] = nil
+		} else {
+			if err := scoringtool.Valid(models.ScoringStrategy(strategy)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidScoringStrategy", TemplateData: map[string]interface{}{"Strategy": strategy}}),
+				})
+				return
+			}
+			updateData["scoring_strategy"] = strategy
+		}
+		updateFields = append(updateFields, "scoring_strategy")
+	}
+
+	if prerequisitesData, ok := payload["prerequisites"]; ok {
+		// null 表示取消前置条件
+		var prerequisites *models.ChallengePrerequisites
+		if prerequisitesData != nil {
+			prerequisites = &models.ChallengePrerequisites{}
+			prerequisitesBytes, _ := sonic.Marshal(prerequisitesData)
+			if err := sonic.Unmarshal(prerequisitesBytes, prerequisites); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidPrerequisites", TemplateData: map[string]interface{}{"Error": err.Error()}}),
+				})
+				return
+			}
+		}
+
+		// 用比赛中所有题目的前置题目检查引用和环
+		var gameChallenges []models.GameChallenge
+		if err := dbtool.DB().Select("challenge_id", "prerequisites").Where("game_id = ?", gameID).Find(&gameChallenges).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadChallenges"}),
+			})
+			return
+		}
+
+		graph := make(map[int64][]int64, len(gameChallenges))
+		for _, gc := range gameChallenges {
+			graph[gc.ChallengeID] = nil
+			if gc.Prerequisites != nil {
+				graph[gc.ChallengeID] = gc.Prerequisites.Challenges
+			}
+		}
+
+		if err := prerequisitetool.Validate(challengeID, prerequisites, graph); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidPrerequisites", TemplateData: map[string]interface{}{"Error": err.Error()}}),
+			})
+			return
+		}
+
+		if prerequisites.Empty() {
+			updateData["prerequisites"] = nil
+		} else {
+			updateData["prerequisites"] = *prerequisites
+		}
+		updateFields = append(updateFields, "prerequisites")
+	}
 
 	// 如果没有要更新的字段，直接返回
 	if len(updateFields) == 0 {
@@ -415,6 +545,75 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 	})
 }
 
+// AdminPreviewChallengeScore 预览题目在接下来 N 次解题中的分数变化, 可以传入未保存的参数
+func AdminPreviewChallengeScore(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	gc := c.MustGet("game_challenge").(models.GameChallenge)
+
+	var payload webmodels.AdminScorePreviewPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestData", TemplateData: map[string]interface{}{"Error": err.Error()}}),
+		})
+		return
+	}
+
+	strategy := scoringtool.Resolve(&game, &gc)
+	if payload.ScoringStrategy != nil && *payload.ScoringStrategy != "" {
+		if err := scoringtool.Valid(*payload.ScoringStrategy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidScoringStrategy", TemplateData: map[string]interface{}{"Strategy": *payload.ScoringStrategy}}),
+			})
+			return
+		}
+		strategy = *payload.ScoringStrategy
+	}
+
+	params := scoringtool.ScoreParams{
+		TotalScore:   gc.TotalScore,
+		MinimalScore: gc.MinimalScore,
+		Difficulty:   gc.Difficulty,
+	}
+	if payload.TotalScore != nil {
+		params.TotalScore = *payload.TotalScore
+	}
+	if payload.MinimalScore != nil {
+		params.MinimalScore = *payload.MinimalScore
+	}
+	if payload.Difficulty != nil {
+		params.Difficulty = *payload.Difficulty
+	}
+
+	solves := payload.Solves
+	if solves == 0 {
+		solves = 30
+	}
+
+	// 从当前解题人数开始往后预览, 比赛开始前解题人数为 0
+	preview := webmodels.AdminScorePreview{
+		ScoringStrategy: strategy,
+		TotalScore:      params.TotalScore,
+		MinimalScore:    params.MinimalScore,
+		Difficulty:      params.Difficulty,
+		CurSolveCount:   gc.SolveCount,
+		Points:          make([]webmodels.ScorePreviewPoint, 0, solves),
+	}
+	for i := 1; i <= solves; i++ {
+		solveCount := gc.SolveCount + int32(i)
+		preview.Points = append(preview.Points, webmodels.ScorePreviewPoint{
+			SolveCount: solveCount,
+			Score:      scoringtool.Score(strategy, params, solveCount),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": preview,
+	})
+}
+
 func AdminUpdateGame(c *gin.Context) {
 	game := c.MustGet("game").(models.Game)
 
@@ -447,6 +646,31 @@ func AdminUpdateGame(c *gin.Context) {
 	game.FirstBloodReward = payload.FirstBloodReward
 	game.SecondBloodReward = payload.SecondBloodReward
 	game.ThirdBloodReward = payload.ThirdBloodReward
+	// 没有传计分方式时保持不变
+	if payload.ScoringStrategy != "" {
+		if err := scoringtool.Valid(payload.ScoringStrategy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidScoringStrategy", TemplateData: map[string]interface{}{"Strategy": payload.ScoringStrategy}}),
+			})
+			return
+		}
+		game.ScoringStrategy = payload.ScoringStrategy
+	}
+	// 封榜时间需要在比赛时间内, 修改封榜时间后需要重新揭晓排名
+	if payload.FreezeTime != nil && (!payload.FreezeTime.After(payload.StartTime) || !payload.FreezeTime.Before(payload.EndTime)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidFreezeTime"}),
+		})
+		return
+	}
+	if (game.FreezeTime == nil) != (payload.FreezeTime == nil) ||
+		(game.FreezeTime != nil && !game.FreezeTime.Equal(*payload.FreezeTime)) {
+		game.ScoreboardRevealed = false
+	}
+	game.FreezeTime = payload.FreezeTime
+	game.FlagPrefix = payload.FlagPrefix
 
 	// 更新 Belong stage
 	for _, chal := range payload.Challenges {
@@ -551,6 +775,16 @@ func AdminDeleteGameChallenge(c *gin.Context) {
 		}
 	}
 
+	// 从其他题目的前置题目中去掉被删除的题目, 避免这些题目永远无法解锁
+	var dependents []models.GameChallenge
+	if err := dbtool.DB().Select("ingame_id", "prerequisites").Where("game_id = ? AND prerequisites IS NOT NULL", gameID).Find(&dependents).Error; err == nil {
+		for _, gc := range dependents {
+			if prerequisitetool.RemoveChallenge(gc.Prerequisites, challengeID) {
+				dbtool.DB().Model(&models.GameChallenge{}).Where("ingame_id = ?", gc.IngameID).Update("prerequisites", gc.Prerequisites)
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 	})
@@ -1715,6 +1949,7 @@ func AdminGetCheats(c *gin.Context) {
 		TeamIDs        []int64  `json:"team_ids"`        // 多个队伍ID
 		TeamNames      []string `json:"team_names"`      // 多个队伍名称
 		CheatTypes     []string `json:"cheat_types"`     // 多个作弊类型
+		ReviewStatuses []string `json:"review_statuses"` // 多个审核状态
 		StartTime      *string  `json:"start_time"`      // 起始时间 (ISO8601)
 		EndTime        *string  `json:"end_time"`        // 结束时间 (ISO8601)
 	}
@@ -1790,11 +2025,24 @@ func AdminGetCheats(c *gin.Context) {
 				coveredTypes = append(coveredTypes, models.CheatSubmitWithoutDownloadAttachments)
 			case "SubmitWithoutStartContainer":
 				coveredTypes = append(coveredTypes, models.CheatSubmitWithoutStartContainer)
+			case "SharedIPAcrossTeams":
+				coveredTypes = append(coveredTypes, models.CheatSharedIPAcrossTeams)
+			case "SameRegisterIPAcrossTeams":
+				coveredTypes = append(coveredTypes, models.CheatSameRegisterIPAcrossTeams)
+			case "SolveTimingCorrelation":
+				coveredTypes = append(coveredTypes, models.CheatSolveTimingCorrelation)
+			case "SubmitHoneypotFlag":
+				coveredTypes = append(coveredTypes, models.CheatSubmitHoneypotFlag)
 			}
 		}
 		baseQuery = baseQuery.Where("cheat_type IN ?", coveredTypes)
 	}
 
+	// 审核状态过滤
+	if len(payload.ReviewStatuses) > 0 {
+		baseQuery = baseQuery.Where("review_status IN ?", payload.ReviewStatuses)
+	}
+
 	// 时间范围过滤
 	if payload.StartTime != nil && strings.TrimSpace(*payload.StartTime) != "" {
 		if t, err := time.Parse(time.RFC3339, *payload.StartTime); err == nil {
@@ -1819,7 +2067,7 @@ func AdminGetCheats(c *gin.Context) {
 
 	// 查询具体记录
 	var cheats []models.Cheat
-	query := baseQuery.Preload("Team").Preload("Challenge").Preload("Submiter").Order("cheat_time DESC").Offset(payload.Offset)
+	query := baseQuery.Preload("Team").Preload("Challenge").Preload("Submiter").Preload("Reviewer").Order("cheat_time DESC").Offset(payload.Offset)
 	if payload.Size > 0 {
 		query = query.Limit(payload.Size)
 	}
@@ -1846,6 +2094,10 @@ func AdminGetCheats(c *gin.Context) {
 		if cheat.Challenge.Name != "" {
 			challengeName = cheat.Challenge.Name
 		}
+		var reviewerName *string
+		if cheat.Reviewer != nil {
+			reviewerName = &cheat.Reviewer.Username
+		}
 
 		data = append(data, gin.H{
 			"cheat_id":       cheat.CheatID,
@@ -1860,6 +2112,12 @@ func AdminGetCheats(c *gin.Context) {
 			"extra_data":     cheat.ExtraData,
 			"cheat_time":     cheat.CheatTime,
 			"submiter_ip":    cheat.SubmiterIP,
+			"review_status":  cheat.ReviewStatus,
+			"reviewer_id":    cheat.ReviewerID,
+			"reviewer_name":  reviewerName,
+			"review_note":    cheat.ReviewNote,
+			"review_time":    cheat.ReviewTime,
+			"adjustment_id":  cheat.AdjustmentID,
 		})
 	}
 
@@ -1870,3 +2128,449 @@ func AdminGetCheats(c *gin.Context) {
 		"total": total,
 	})
 }
+
+// 找出作弊记录涉及到的解题记录
+// 针对单道题的记录对应这道题的解题, 解题时间关联分析的记录对应证据中的题目, 其他队伍级别的记录没有涉及具体的解题
+func affectedSolvesQuery(tx *gorm.DB, cheat *models.Cheat) *gorm.DB {
+	query := tx.Model(&models.Solve{}).Where("game_id = ? AND team_id = ?", cheat.GameID, cheat.TeamID)
+
+	if cheat.IngameID != nil {
+		return query.Where("ingame_id = ?", *cheat.IngameID)
+	}
+
+	challengeIDs := make([]int64, 0, len(cheat.ExtraData.Solves))
+	for _, solve := range cheat.ExtraData.Solves {
+		challengeIDs = append(challengeIDs, solve.ChallengeID)
+	}
+	if len(challengeIDs) == 0 {
+		return nil
+	}
+
+	return query.Where("challenge_id IN ?", challengeIDs)
+}
+
+// AdminReviewCheat 审核作弊记录, 确认作弊时可以同时扣分、删除相关解题记录和禁赛队伍
+// 撤销确认不会回滚已经执行的处罚
+func AdminReviewCheat(c *gin.Context) {
+	gameID, err := strconv.ParseInt(c.Param("game_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidGameID"}),
+		})
+		return
+	}
+
+	cheatID := c.Param("cheat_id")
+
+	var payload webmodels.AdminReviewCheatPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestData", TemplateData: map[string]interface{}{"Error": err.Error()}}),
+		})
+		return
+	}
+
+	reviewStatus := models.CheatReviewStatus(payload.ReviewStatus)
+	if reviewStatus != models.CheatReviewConfirmed && (payload.ScorePenalty > 0 || payload.RevokeSolves || payload.BanTeam) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "CheatActionsRequireConfirmed"}),
+		})
+		return
+	}
+
+	var cheat models.Cheat
+	if err := dbtool.DB().Where("cheat_id = ? AND game_id = ?", cheatID, gameID).Preload("Team").First(&cheat).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "CheatNotFound"}),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadCheats"}),
+			})
+		}
+		return
+	}
+
+	if payload.ScorePenalty > 0 && cheat.AdjustmentID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "CheatAlreadyPenalized"}),
+		})
+		return
+	}
+
+	users, _ := c.Get("UserID")
+	userClaims := users.(*models.JWTUser)
+	reviewerID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidUserID"}),
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	reviewerIDStr := reviewerID.String()
+	details := map[string]interface{}{
+		"cheat_id":      cheat.CheatID,
+		"cheat_type":    cheat.CheatType,
+		"game_id":       gameID,
+		"team_id":       cheat.TeamID,
+		"team_name":     cheat.Team.TeamName,
+		"old_status":    cheat.ReviewStatus,
+		"review_status": reviewStatus,
+		"review_note":   payload.ReviewNote,
+		"score_penalty": payload.ScorePenalty,
+		"revoke_solves": payload.RevokeSolves,
+		"ban_team":      payload.BanTeam,
+	}
+
+	err = dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"review_status": reviewStatus,
+			"reviewer_id":   reviewerIDStr,
+			"review_note":   payload.ReviewNote,
+			"review_time":   now,
+		}
+
+		if payload.ScorePenalty > 0 {
+			reason := fmt.Sprintf("Cheat %s (%s) confirmed", cheat.CheatID, cheat.CheatType)
+			if payload.ReviewNote != nil && strings.TrimSpace(*payload.ReviewNote) != "" {
+				reason = fmt.Sprintf("%s: %s", reason, strings.TrimSpace(*payload.ReviewNote))
+			}
+
+			adjustment := models.ScoreAdjustment{
+				TeamID:         cheat.TeamID,
+				GameID:         gameID,
+				AdjustmentType: models.AdjustmentTypeCheat,
+				ScoreChange:    -payload.ScorePenalty,
+				Reason:         reason,
+				CreatedBy:      reviewerID,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			if err := tx.Create(&adjustment).Error; err != nil {
+				return fmt.Errorf("failed to create score adjustment: %w", err)
+			}
+			if err := tx.Model(&models.Team{}).Where("team_id = ?", cheat.TeamID).
+				Update("team_score", gorm.Expr("team_score + ?", adjustment.ScoreChange)).Error; err != nil {
+				return fmt.Errorf("failed to update team score: %w", err)
+			}
+
+			updates["adjustment_id"] = adjustment.AdjustmentID
+			details["adjustment_id"] = adjustment.AdjustmentID
+		}
+
+		if payload.RevokeSolves {
+			var revokedCount int64
+			if query := affectedSolvesQuery(tx, &cheat); query != nil {
+				var ingameIDs []int64
+				if err := query.Distinct("ingame_id").Order("ingame_id ASC").Pluck("ingame_id", &ingameIDs).Error; err != nil {
+					return fmt.Errorf("failed to load revoked solves: %w", err)
+				}
+
+				// 先按 ingame_id 顺序拿到排名锁, 避免和正在插入解题记录的评测交错
+				for _, ingameID := range ingameIDs {
+					if err := tasks.LockSolveRank(tx, ingameID); err != nil {
+						return fmt.Errorf("failed to lock solve rank: %w", err)
+					}
+				}
+
+				result := affectedSolvesQuery(tx, &cheat).Delete(&models.Solve{})
+				if result.Error != nil {
+					return fmt.Errorf("failed to revoke solves: %w", result.Error)
+				}
+				revokedCount = result.RowsAffected
+
+				// 删除后其他队伍的一二三血等排名需要前移
+				for _, ingameID := range ingameIDs {
+					if err := tasks.ReRankSolves(tx, ingameID); err != nil {
+						return fmt.Errorf("failed to re-rank solves: %w", err)
+					}
+				}
+			}
+			details["revoked_solves"] = revokedCount
+		}
+
+		if payload.BanTeam {
+			if err := tx.Model(&models.Team{}).Where("team_id = ?", cheat.TeamID).
+				Update("team_status", models.ParticipateBanned).Error; err != nil {
+				return fmt.Errorf("failed to ban team: %w", err)
+			}
+		}
+
+		return tx.Model(&models.Cheat{}).Where("cheat_id = ?", cheat.CheatID).Updates(updates).Error
+	})
+
+	if err != nil {
+		tasks.LogAdminOperationWithError(c, models.ActionReview, models.ResourceTypeCheat, &cheat.CheatID, details, err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToReviewCheat"}),
+		})
+		return
+	}
+
+	tasks.LogAdminOperation(c, models.ActionReview, models.ResourceTypeCheat, &cheat.CheatID, details)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "CheatReviewed"}),
+		"data":    details,
+	})
+}
+
+// AdminGetChallengeHintUsage 查看题目每条提示的解锁情况
+func AdminGetChallengeHintUsage(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	gc := c.MustGet("game_challenge").(models.GameChallenge)
+
+	var unlocks []models.HintUnlock
+	if err := dbtool.DB().Where("game_id = ? AND ingame_id = ?", game.GameID, gc.IngameID).
+		Preload("Team").Preload("User").Order("unlock_time ASC").Find(&unlocks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadHintUnlocks"}),
+		})
+		return
+	}
+
+	unlockMap := make(map[string][]webmodels.AdminHintUnlockItem)
+	for _, unlock := range unlocks {
+		unlockMap[unlock.HintID] = append(unlockMap[unlock.HintID], webmodels.AdminHintUnlockItem{
+			UnlockID:       unlock.UnlockID,
+			TeamID:         unlock.TeamID,
+			TeamName:       unlock.Team.TeamName,
+			UserID:         unlock.UserID,
+			Username:       unlock.User.Username,
+			Cost:           unlock.Cost,
+			PenaltySeconds: unlock.PenaltySeconds,
+			UnlockTime:     unlock.UnlockTime,
+		})
+	}
+
+	result := make([]webmodels.AdminHintUsage, 0)
+	if gc.Hints != nil {
+		for _, hint := range *gc.Hints {
+			hintUnlocks, ok := unlockMap[hint.HintID]
+			if !ok || hint.HintID == "" {
+				hintUnlocks = make([]webmodels.AdminHintUnlockItem, 0)
+			}
+			result = append(result, webmodels.AdminHintUsage{
+				HintID:         hint.HintID,
+				Content:        hint.Content,
+				Visible:        hint.Visible,
+				Cost:           hint.Cost,
+				PenaltySeconds: hint.PenaltySeconds,
+				UnlockCount:    int64(len(hintUnlocks)),
+				Unlocks:        hintUnlocks,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
+// AdminAdvanceGameStage 按上一阶段的排名选出前 N 支队伍, 只有它们可以参加下一阶段
+func AdminAdvanceGameStage(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+
+	var payload webmodels.AdminAdvanceStagePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestPayload"}),
+		})
+		return
+	}
+
+	if game.Stages == nil || payload.FromStage == payload.ToStage {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StageNotFound"}),
+		})
+		return
+	}
+
+	fromStage := game.Stages.Find(payload.FromStage)
+	toStage := game.Stages.Find(payload.ToStage)
+	if fromStage == nil || toStage == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StageNotFound"}),
+		})
+		return
+	}
+
+	// 直接计算最新的真实排名, 不使用缓存里的排行榜, 封榜后的解题也要算进去
+	scoreBoard, err := ristretto_tool.CalculateRevealedGameScoreBoard(game.GameID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToCalculateScoreboard"}),
+		})
+		return
+	}
+
+	advancedTeams := make([]int64, 0, payload.TopN)
+	for _, team := range scoreBoard.StageRankings[fromStage.StageName] {
+		if len(advancedTeams) >= payload.TopN {
+			break
+		}
+		advancedTeams = append(advancedTeams, team.TeamID)
+	}
+
+	// 名单为空表示所有队伍都可以参加, 这里不能写入空名单
+	if len(advancedTeams) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "NoTeamsToAdvance"}),
+		})
+		return
+	}
+
+	toStage.EligibleTeams = advancedTeams
+
+	details := map[string]interface{}{
+		"from_stage":     fromStage.StageName,
+		"to_stage":       toStage.StageName,
+		"top_n":          payload.TopN,
+		"eligible_teams": advancedTeams,
+	}
+	gameIDStr := strconv.FormatInt(game.GameID, 10)
+
+	if err := dbtool.DB().Model(&models.Game{}).Where("game_id = ?", game.GameID).Update("stages", game.Stages).Error; err != nil {
+		tasks.LogAdminOperationWithError(c, models.ActionUpdate, models.ResourceTypeGame, &gameIDStr, details, err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToSaveGame"}),
+		})
+		return
+	}
+
+	tasks.LogAdminOperation(c, models.ActionUpdate, models.ResourceTypeGame, &gameIDStr, details)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StageAdvanced", TemplateData: map[string]interface{}{"Count": len(advancedTeams), "Stage": toStage.StageName}}),
+		"data":    details,
+	})
+}
+
+// 正在揭晓排行榜的比赛, 同一场比赛同时只能进行一次揭晓
+var scoreboardReveals sync.Map
+
+// AdminRevealScoreboard 比赛结束后逐步揭晓封榜后的排名, 每一步通过 WebSocket 推送给比赛中的所有连接
+func AdminRevealScoreboard(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+
+	var payload webmodels.AdminRevealScoreboardPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestPayload"}),
+		})
+		return
+	}
+
+	if game.FreezeTime == nil || game.ScoreboardRevealed {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ScoreboardNotFrozen"}),
+		})
+		return
+	}
+
+	if time.Now().UTC().Before(game.EndTime) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "GameNotEndedYet"}),
+		})
+		return
+	}
+
+	if _, running := scoreboardReveals.LoadOrStore(game.GameID, true); running {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ScoreboardRevealInProgress"}),
+		})
+		return
+	}
+
+	frozenScoreBoard, err := ristretto_tool.CalculateGameScoreBoard(game.GameID)
+	if err != nil {
+		scoreboardReveals.Delete(game.GameID)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToCalculateScoreboard"}),
+		})
+		return
+	}
+
+	revealedScoreBoard, err := ristretto_tool.CalculateRevealedGameScoreBoard(game.GameID)
+	if err != nil {
+		scoreboardReveals.Delete(game.GameID)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToCalculateScoreboard"}),
+		})
+		return
+	}
+
+	steps := ristretto_tool.BuildScoreboardRevealSteps(frozenScoreBoard.TeamRankings, revealedScoreBoard.TeamRankings)
+
+	stepInterval := 3 * time.Second
+	if payload.StepInterval != nil {
+		stepInterval = time.Duration(*payload.StepInterval) * time.Second
+	}
+
+	gameIDStr := strconv.FormatInt(game.GameID, 10)
+	tasks.LogAdminOperation(c, models.ActionUpdate, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+		"scoreboard_reveal": true,
+		"steps":             len(steps),
+		"step_interval":     stepInterval.Seconds(),
+	})
+
+	go runScoreboardReveal(game.GameID, steps, stepInterval)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ScoreboardRevealStarted"}),
+		"data":    steps,
+	})
+}
+
+// 按顺序推送每一步, 全部推送完后公开真实的排行榜
+func runScoreboardReveal(gameID int64, steps []webmodels.ScoreboardRevealStep, stepInterval time.Duration) {
+	defer scoreboardReveals.Delete(gameID)
+
+	for idx, step := range steps {
+		if idx > 0 {
+			time.Sleep(stepInterval)
+		}
+		noticetool.PushScoreboardRevealStep(gameID, step)
+	}
+
+	if err := dbtool.DB().Model(&models.Game{}).Where("game_id = ?", gameID).Update("scoreboard_revealed", true).Error; err != nil {
+		zaphelper.Logger.Error("Failed to mark scoreboard revealed", zap.Error(err), zap.Int64("game_id", gameID))
+		return
+	}
+
+	if err := ristretto_tool.MakeGameScoreBoardCache(gameID); err != nil {
+		zaphelper.Logger.Error("Failed to make game scoreboard cache", zap.Error(err), zap.Int64("game_id", gameID))
+	}
+
+	noticetool.PushScoreboardRevealFinished(gameID)
+}
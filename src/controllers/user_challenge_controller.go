@@ -5,8 +5,11 @@ import (
 	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
 	"a1ctf/src/utils/ristretto_tool"
+	"a1ctf/src/utils/zaphelper"
 	"a1ctf/src/webmodels"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,6 +17,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
 )
 
 func UserGetGameChallenges(c *gin.Context) {
@@ -36,6 +41,48 @@ func UserGetGameChallenges(c *gin.Context) {
 			return
 		}
 
+		// 去掉队伍还没有满足前置条件和没有晋级的阶段的题目，缓存里的切片是共享的，这里复制一份
+		lockedChallenges, err := ristretto_tool.CachedTeamLockedChallenges(game.GameID, team.TeamID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameChallenges"}),
+			})
+			return
+		}
+
+		ineligibleStages := make(map[string]bool)
+		if game.Stages != nil {
+			for _, stage := range *game.Stages {
+				if !stage.TeamEligible(team.TeamID) {
+					ineligibleStages[stage.StageName] = true
+				}
+			}
+		}
+
+		if len(lockedChallenges) > 0 || len(ineligibleStages) > 0 {
+			unlockedChallenges := make([]webmodels.UserSimpleGameChallenge, 0, len(simpleGameChallenges))
+			for _, challenge := range simpleGameChallenges {
+				if lockedChallenges[challenge.ChallengeID] {
+					continue
+				}
+				if challenge.BelongStage != nil && ineligibleStages[*challenge.BelongStage] {
+					continue
+				}
+				unlockedChallenges = append(unlockedChallenges, challenge)
+			}
+			simpleGameChallenges = unlockedChallenges
+		}
+
+		simpleGameChallenges, err = ristretto_tool.FrozenSimpleChallenges(game.GameID, simpleGameChallenges)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameChallenges"}),
+			})
+			return
+		}
+
 		// Cache all solves to redis
 
 		solveMap, err := ristretto_tool.CachedSolvedChallengesForGame(game.GameID)
@@ -52,14 +99,29 @@ func UserGetGameChallenges(c *gin.Context) {
 			solves = make([]models.Solve, 0)
 		}
 
+		scoreBoard, err := ristretto_tool.CachedGameScoreBoard(game.GameID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadSolves"}),
+			})
+			return
+		}
+
 		var solved_challenges []webmodels.UserSimpleGameSolvedChallenge = make([]webmodels.UserSimpleGameSolvedChallenge, 0, len(solves))
 
 		for _, solve := range solves {
+			rank := solve.Rank
+			// 封榜后的解题排名会暴露其他队伍封榜后的解题情况
+			if scoreBoard.Frozen && scoreBoard.FreezeTime != nil && solve.SolveTime.After(*scoreBoard.FreezeTime) {
+				rank = 0
+			}
+
 			solved_challenges = append(solved_challenges, webmodels.UserSimpleGameSolvedChallenge{
 				ChallengeID:   solve.ChallengeID,
 				ChallengeName: solve.Challenge.Name,
 				SolveTime:     solve.SolveTime,
-				Rank:          solve.Rank,
+				Rank:          rank,
 			})
 		}
 
@@ -95,6 +157,13 @@ func UserGetGameChallenge(c *gin.Context) {
 		}
 	}
 
+	// 动态子 flag 和队伍 flag 一样在第一次查看题目时生成, 没有靶机的题目也能拿到
+	if hasDynamicSubFlags(gameChallenge.JudgeConfig) {
+		if _, err := tasks.EnsureTeamSubFlags(team.TeamID, gameChallenge.IngameID); err != nil {
+			zaphelper.Logger.Error("Failed to create team sub flags", zap.Error(err), zap.Int64("team_id", team.TeamID), zap.Int64("ingame_id", gameChallenge.IngameID))
+		}
+	}
+
 	// 3. 使用缓存获取附件信息
 	userAttachments, err := ristretto_tool.CachedChallengeAttachments(*gameChallenge.Challenge.ChallengeID)
 	if err != nil {
@@ -115,13 +184,51 @@ func UserGetGameChallenge(c *gin.Context) {
 		return
 	}
 
+	// 需要解锁的提示只返回给已经解锁的队伍
+	unlockedHints, err := loadTeamUnlockedHints(team.TeamID, gameChallenge.IngameID, visibleHints)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadChallengeHints"}),
+		})
+		return
+	}
+
+	userHints := make([]webmodels.UserHintItem, 0, len(visibleHints))
+	for _, hint := range visibleHints {
+		hintItem := webmodels.UserHintItem{
+			HintID:         hint.HintID,
+			Content:        hint.Content,
+			CreateTime:     hint.CreateTime,
+			Cost:           hint.Cost,
+			PenaltySeconds: hint.PenaltySeconds,
+		}
+		if hint.Locked() && !unlockedHints[hint.HintID] {
+			hintItem.Content = ""
+			hintItem.Locked = true
+		}
+		userHints = append(userHints, hintItem)
+	}
+
+	// 附件经过下载记录接口跳转，用于检查没有下载附件就提交正确 flag 的情况，缓存里的切片是共享的，这里复制一份
+	// 静态文件也会返回 attach_url，前端通过它下载
+	trackedAttachments := make([]webmodels.UserAttachmentConfig, 0, len(userAttachments))
+	for idx, attachment := range userAttachments {
+		if attachmentDownloadURL(attachment.AttachType, attachment.AttachURL, attachment.AttachHash) != "" {
+			trackedURL := fmt.Sprintf("/api/game/%d/challenge/%d/attachment/%d", game.GameID, gameChallenge.ChallengeID, idx)
+			attachment.AttachURL = &trackedURL
+		}
+		trackedAttachments = append(trackedAttachments, attachment)
+	}
+	userAttachments = trackedAttachments
+
 	result := webmodels.UserDetailGameChallenge{
 		ChallengeID:         *gameChallenge.Challenge.ChallengeID,
 		ChallengeName:       gameChallenge.Challenge.Name,
 		Description:         gameChallenge.Challenge.Description,
 		TotalScore:          gameChallenge.TotalScore,
 		CurScore:            gameChallenge.CurScore,
-		Hints:               visibleHints,
+		Hints:               userHints,
 		BelongStage:         gameChallenge.BelongStage,
 		SolveCount:          gameChallenge.SolveCount,
 		Category:            gameChallenge.Challenge.Category,
@@ -132,6 +239,14 @@ func UserGetGameChallenge(c *gin.Context) {
 		Visible:             gameChallenge.Visible,
 	}
 
+	// 封榜期间只显示封榜前的解题人数和分数
+	if scoreBoard, err := ristretto_tool.CachedGameScoreBoard(game.GameID); err == nil && scoreBoard.Frozen {
+		if frozenChallenge, ok := scoreBoard.FrozenChallenges[result.ChallengeID]; ok {
+			result.SolveCount = frozenChallenge.SolveCount
+			result.CurScore = frozenChallenge.CurScore
+		}
+	}
+
 	// 6. 容器状态处理 - 使用短时缓存（200ms）平衡性能和实时性
 	containers, err := ristretto_tool.CachedContainerStatus(game.GameID, *gameChallenge.Challenge.ChallengeID, team.TeamID)
 	if err != nil {
@@ -209,6 +324,16 @@ func UserGameChallengeSubmitFlag(c *gin.Context) {
 		return
 	}
 
+	// flag 格式不对的提交直接拒绝，不记录为错误提交
+	flagPrefix := judgetool.FlagPrefix(&game, gameChallenge.JudgeConfig)
+	if !judgetool.CheckFlagFormat(gameChallenge.JudgeConfig, flagPrefix, payload.FlagContent) {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidFlagFormat", TemplateData: map[string]interface{}{"Prefix": flagPrefix}}),
+		})
+		return
+	}
+
 	clientIP := c.ClientIP()
 
 	// 插入 Judge 队列
@@ -261,9 +386,10 @@ func UserGameChallengeSubmitFlag(c *gin.Context) {
 		return
 	}
 
-	// 启动一个检查作弊任务
-
-	tasks.NewFlagAntiCheatTask(newJudge)
+	// 入队评测任务，入队失败的评测会由 FlagJudgeJob 重新入队，评测完成后会启动检查作弊任务
+	if err := tasks.NewJudgeFlagTask(newJudge); err != nil {
+		zaphelper.Logger.Error("Failed to enqueue judge task", zap.Error(err), zap.String("judge_id", newJudge.JudgeID))
+	}
 
 	tasks.LogUserOperation(c, models.ActionSubmitFlag, models.ResourceTypeChallenge, &challengeIDStr, map[string]interface{}{
 		"game_id":        game.GameID,
@@ -274,17 +400,6 @@ func UserGameChallengeSubmitFlag(c *gin.Context) {
 		"flag_content":   payload.FlagContent, // 只记录前50个字符
 	})
 
-	// dbtool.DB().Model(&models.Judge{}).Preload("TeamFlag").Where("judge_id = ?", newJudge.JudgeID).First(&newJudge)
-
-	// err = tasks.NewJudgeFlagTask(newJudge)
-	// if err != nil {
-	// 	c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
-	// 		Code:    400,
-	// 		Message: "You have a judge in queue, please wait for a moment",
-	// 	})
-	// 	return
-	// }
-
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"data": gin.H{
@@ -330,6 +445,204 @@ func UserGameGetJudgeResult(c *gin.Context) {
 		"data": gin.H{
 			"judge_id":     judge.JudgeID,
 			"judge_status": judge.JudgeStatus,
+			"judge_result": judge.JudgeResult,
+		},
+	})
+}
+
+func UserDownloadGameAttachment(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+	user := c.MustGet("user").(models.User)
+	gameChallenge := c.MustGet("game_challenge").(models.GameChallenge)
+
+	attachIndex, err := strconv.Atoi(c.Param("attach_index"))
+	if err != nil || attachIndex < 0 || attachIndex >= len(gameChallenge.Challenge.Attachments) {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "AttachmentNotFound"}),
+		})
+		return
+	}
+
+	attachment := gameChallenge.Challenge.Attachments[attachIndex]
+	downloadURL := attachmentDownloadURL(attachment.AttachType, attachment.AttachURL, attachment.AttachHash)
+	if downloadURL == "" {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "AttachmentNotFound"}),
+		})
+		return
+	}
+
+	clientIP := c.ClientIP()
+
+	// 记录下载失败不影响选手下载附件
+	if err := dbtool.DB().Create(&models.AttachmentDownload{
+		DownloadID:   uuid.NewString(),
+		GameID:       game.GameID,
+		IngameID:     gameChallenge.IngameID,
+		ChallengeID:  gameChallenge.ChallengeID,
+		TeamID:       team.TeamID,
+		UserID:       user.UserID,
+		AttachName:   attachment.AttachName,
+		DownloadTime: time.Now().UTC(),
+		ClientIP:     &clientIP,
+	}).Error; err != nil {
+		zaphelper.Logger.Error("Failed to record attachment download", zap.Error(err), zap.Int64("team_id", team.TeamID), zap.Int64("ingame_id", gameChallenge.IngameID))
+	}
+
+	c.Redirect(http.StatusFound, downloadURL)
+}
+
+// 附件实际的下载地址，静态文件通过文件下载接口下载
+func attachmentDownloadURL(attachType models.AttachmentType, attachURL *string, attachHash *string) string {
+	if attachType == models.AttachmentTypeStaticFile && attachHash != nil && *attachHash != "" {
+		return fmt.Sprintf("/api/file/download/%s", *attachHash)
+	}
+	if attachURL != nil {
+		return *attachURL
+	}
+	return ""
+}
+
+func hasDynamicSubFlags(config *models.JudgeConfig) bool {
+	if config == nil {
+		return false
+	}
+	for _, subFlag := range config.SubFlags {
+		if subFlag.FlagType == models.FlagTypeDynamic {
+			return true
+		}
+	}
+	return false
+}
+
+// 队伍已经解锁的提示，没有需要解锁的提示时不查询数据库
+func loadTeamUnlockedHints(teamID int64, ingameID int64, hints models.Hints) (map[string]bool, error) {
+	unlocked := make(map[string]bool)
+
+	hasLockedHint := false
+	for _, hint := range hints {
+		if hint.Locked() {
+			hasLockedHint = true
+			break
+		}
+	}
+	if !hasLockedHint {
+		return unlocked, nil
+	}
+
+	var hintIDs []string
+	if err := dbtool.DB().Model(&models.HintUnlock{}).Where("team_id = ? AND ingame_id = ?", teamID, ingameID).Pluck("hint_id", &hintIDs).Error; err != nil {
+		return nil, err
+	}
+
+	for _, hintID := range hintIDs {
+		unlocked[hintID] = true
+	}
+	return unlocked, nil
+}
+
+func UserUnlockGameHint(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+	user := c.MustGet("user").(models.User)
+	gameChallenge := c.MustGet("game_challenge").(models.GameChallenge)
+
+	visibleHints, err := ristretto_tool.CachedChallengeVisibleHints(game.GameID, gameChallenge.ChallengeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadChallengeHints"}),
+		})
+		return
+	}
+
+	hintID := c.Param("hint_id")
+	var hint *models.Hint
+	for idx := range visibleHints {
+		if visibleHints[idx].HintID != "" && visibleHints[idx].HintID == hintID {
+			hint = &visibleHints[idx]
+			break
+		}
+	}
+
+	if hint == nil {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "HintNotFound"}),
+		})
+		return
+	}
+
+	// 不需要解锁的提示直接返回内容
+	if !hint.Locked() {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 200,
+			"data": webmodels.UserHintItem{
+				HintID:     hint.HintID,
+				Content:    hint.Content,
+				CreateTime: hint.CreateTime,
+			},
+		})
+		return
+	}
+
+	unlock := models.HintUnlock{
+		UnlockID:       uuid.NewString(),
+		GameID:         game.GameID,
+		IngameID:       gameChallenge.IngameID,
+		ChallengeID:    gameChallenge.ChallengeID,
+		TeamID:         team.TeamID,
+		UserID:         user.UserID,
+		HintID:         hint.HintID,
+		Cost:           hint.Cost,
+		PenaltySeconds: hint.PenaltySeconds,
+		UnlockTime:     time.Now().UTC(),
+	}
+
+	challengeIDStr := strconv.FormatInt(gameChallenge.ChallengeID, 10)
+	logDetails := map[string]interface{}{
+		"game_id":         game.GameID,
+		"team_id":         team.TeamID,
+		"user_id":         user.UserID,
+		"challenge_name":  gameChallenge.Challenge.Name,
+		"hint_id":         hint.HintID,
+		"cost":            hint.Cost,
+		"penalty_seconds": hint.PenaltySeconds,
+	}
+
+	// 同一个队伍的成员同时解锁时只记录一次
+	result := dbtool.DB().Clauses(clause.OnConflict{DoNothing: true}).Create(&unlock)
+	if result.Error != nil {
+		tasks.LogUserOperationWithError(c, models.ActionUnlockHint, models.ResourceTypeChallenge, &challengeIDStr, logDetails, result.Error)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToUnlockHint"}),
+		})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "HintAlreadyUnlocked"}),
+		})
+		return
+	}
+
+	tasks.LogUserOperation(c, models.ActionUnlockHint, models.ResourceTypeChallenge, &challengeIDStr, logDetails)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": webmodels.UserHintItem{
+			HintID:         hint.HintID,
+			Content:        hint.Content,
+			CreateTime:     hint.CreateTime,
+			Cost:           hint.Cost,
+			PenaltySeconds: hint.PenaltySeconds,
 		},
 	})
 }
@@ -2,15 +2,19 @@ package controllers
 
 import (
 	"a1ctf/src/db/models"
+	trafficgateway "a1ctf/src/modules/traffic_gateway"
 	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
+	"a1ctf/src/utils/general"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
 	redistool "a1ctf/src/utils/redis_tool"
 	"a1ctf/src/webmodels"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -90,6 +94,7 @@ func UserCreateGameContainer(c *gin.Context) {
 		StartTime:            time.Now().UTC(),
 		ExpireTime:           time.Now().Add(time.Duration(2) * time.Hour).UTC(),
 		ContainerExposeInfos: make(models.ContainerExposeInfos, 0),
+		AllocatedPorts:       make(models.AllocatedPorts, 0),
 		ContainerStatus:      models.ContainerQueueing,
 		ContainerConfig:      *gameChallenge.Challenge.ContainerConfig,
 		ChallengeName:        gameChallenge.Challenge.Name,
@@ -97,6 +102,38 @@ func UserCreateGameContainer(c *gin.Context) {
 		SubmiterIP:           &clientIP,
 	}
 
+	// 每个靶机单独生成 flag，之前启动的靶机里拿到的 flag 不再有效
+	if gameChallenge.Challenge.FlagType == models.FlagTypeDynamic && gameChallenge.JudgeConfig != nil &&
+		gameChallenge.JudgeConfig.PerContainerFlag && gameChallenge.JudgeConfig.FlagTemplate != nil {
+		// 模板里没有随机部分时追加靶机 ID, 保证两次启动的 flag 一定不同
+		flagTemplate := *gameChallenge.JudgeConfig.FlagTemplate
+		if !general.HasPerLaunchTemplate(flagTemplate) {
+			flagTemplate = general.AppendFlagBody(flagTemplate, "_[container_id]")
+		}
+
+		containerFlag := general.ProcessFlag(flagTemplate, map[string]string{
+			"team_id":      fmt.Sprintf("%d", team.TeamID),
+			"game_id":      fmt.Sprintf("%d", game.GameID),
+			"challenge_id": fmt.Sprintf("%d", *gameChallenge.Challenge.ChallengeID),
+			"team_hash":    team.TeamHash,
+			"team_name":    team.TeamName,
+			"container_id": strings.ReplaceAll(newContainer.ContainerID, "-", ""),
+		}, true)
+		newContainer.ContainerFlag = &containerFlag
+	}
+
+	// 蜜罐 flag, 别的队伍提交时可以定位到泄露的队伍
+	if gameChallenge.JudgeConfig != nil && gameChallenge.JudgeConfig.Honeypot != nil {
+		decoyFlag := judgetool.GenerateDecoyFlag(gameChallenge.JudgeConfig, judgetool.FlagPrefix(&game, gameChallenge.JudgeConfig), map[string]string{
+			"team_id":      fmt.Sprintf("%d", team.TeamID),
+			"game_id":      fmt.Sprintf("%d", game.GameID),
+			"challenge_id": fmt.Sprintf("%d", *gameChallenge.Challenge.ChallengeID),
+			"team_hash":    team.TeamHash,
+			"team_name":    team.TeamName,
+		})
+		newContainer.DecoyFlag = &decoyFlag
+	}
+
 	// 用户操作靶机的 60 秒 CD
 	operationName := fmt.Sprintf("%s:containerOperation", user.UserID)
 	locked := redistool.LockForATime(operationName, time.Minute)
@@ -453,3 +490,85 @@ func UserGetGameChallengeContainerInfo(c *gin.Context) {
 		"data": result,
 	})
 }
+
+// UserGetContainerGatewayToken 获取通过网关连接容器端口的令牌
+func UserGetContainerGatewayToken(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+	user := c.MustGet("user").(models.User)
+
+	challengeID, err := strconv.ParseInt(c.Param("challenge_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidChallengeID"}),
+		})
+		return
+	}
+
+	var payload webmodels.UserGatewayTokenPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestPayload"}),
+		})
+		return
+	}
+
+	var container models.Container
+	if err := dbtool.DB().Where("game_id = ? AND challenge_id = ? AND team_id = ? AND container_status = ?", game.GameID, challengeID, team.TeamID, models.ContainerRunning).First(&container).Error; err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "LaunchContainerFirst"}),
+		})
+		return
+	}
+
+	portExists := false
+	for _, exposeInfo := range container.ContainerExposeInfos {
+		if exposeInfo.ContainerName != payload.ContainerName {
+			continue
+		}
+		for _, port := range exposeInfo.ExposePorts {
+			if port.PortName == payload.PortName {
+				portExists = true
+			}
+		}
+	}
+
+	if !portExists {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ContainerPortNotFound"}),
+		})
+		return
+	}
+
+	// 令牌和容器同时过期
+	token, err := trafficgateway.GenerateToken(&trafficgateway.TokenClaims{
+		GameID:        game.GameID,
+		TeamID:        team.TeamID,
+		UserID:        user.UserID,
+		ContainerID:   container.ContainerID,
+		ContainerName: payload.ContainerName,
+		PortName:      payload.PortName,
+		ExpiresAt:     container.ExpireTime.Unix(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"token":       token,
+			"path":        "/api/gateway/tcp",
+			"subprotocol": trafficgateway.GatewaySubprotocol,
+			"expire_time": container.ExpireTime,
+		},
+	})
+}
@@ -185,6 +185,28 @@ func UserGetGameDetailWithTeamInfo(c *gin.Context) {
 				}
 			}
 
+			// 封榜期间实时分数会随着题目分数衰减暴露其他队伍的解题, 使用封榜时的分数加上自己封榜后的解题
+			if cachedData.Frozen {
+				solveMap, err := ristretto_tool.CachedSolvedChallengesForGame(game.GameID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+						Code:    500,
+						Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+					})
+					return
+				}
+
+				users, err := ristretto_tool.CachedMemberMap()
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+						Code:    500,
+						Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+					})
+					return
+				}
+
+				teamInfo["team_score"] = withOwnSolvesAfterFreeze(game, myTeamInfo, cachedData, solveMap[curTeam.TeamID], users).Score
+			}
 		}
 
 		gameInfo["team_info"] = teamInfo
@@ -240,6 +262,7 @@ func UserGameGetScoreBoard(c *gin.Context) {
 
 	// 解析查询参数
 	groupIDStr := c.Query("group_id")
+	stageStr := c.Query("stage")
 	pageStr := c.DefaultQuery("page", "1")
 	sizeStr := c.DefaultQuery("size", "20")
 
@@ -250,6 +273,18 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		}
 	}
 
+	// 只接受比赛中存在的阶段, 其它情况显示总榜
+	var stageName *string
+	stageNames := make([]string, 0)
+	if game.Stages != nil {
+		for _, stage := range *game.Stages {
+			stageNames = append(stageNames, stage.StageName)
+			if stage.StageName == stageStr {
+				stageName = &stage.StageName
+			}
+		}
+	}
+
 	page, err := strconv.ParseInt(pageStr, 10, 64)
 	if err != nil || page < 1 {
 		page = 1
@@ -307,6 +342,16 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		return
 	}
 
+	// 封榜期间题目只显示封榜前的解题人数和分数
+	simpleGameChallenges, err = ristretto_tool.FrozenSimpleChallenges(game.GameID, simpleGameChallenges)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameChallengesBoard"}),
+		})
+		return
+	}
+
 	// 获取带队伍数量的分组信息（已缓存）
 	simpleGameGroups, err := ristretto_tool.CachedGameGroupsWithTeamCount(game.GameID)
 	if err != nil {
@@ -329,7 +374,7 @@ func UserGameGetScoreBoard(c *gin.Context) {
 	}
 
 	// 获取过滤后的排行榜数据（已缓存）
-	filteredData, err := ristretto_tool.CachedFilteredGameScoreBoard(game.GameID, groupID)
+	filteredData, err := ristretto_tool.CachedFilteredGameScoreBoard(game.GameID, groupID, stageName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
 			Code:    500,
@@ -360,11 +405,39 @@ func UserGameGetScoreBoard(c *gin.Context) {
 
 	// 设置当前用户的队伍信息
 	if logined {
-		if myTeamScoreItem, ok := scoreBoard.FinalScoreBoardMap[curTeam.TeamID]; ok {
+		myScoreBoardMap := scoreBoard.FinalScoreBoardMap
+		if stageName != nil {
+			myScoreBoardMap = scoreBoard.StageScoreBoardMaps[*stageName]
+		}
+		if myTeamScoreItem, ok := myScoreBoardMap[curTeam.TeamID]; ok {
 			curTeamScoreItem = &myTeamScoreItem
 		}
 	}
 
+	// 封榜期间队伍仍然可以看到自己封榜后的解题
+	if curTeamScoreItem != nil && scoreBoard.Frozen {
+		solveMap, err := ristretto_tool.CachedSolvedChallengesForGame(game.GameID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+			})
+			return
+		}
+
+		users, err := ristretto_tool.CachedMemberMap()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+			})
+			return
+		}
+
+		myTeamScoreItem := withOwnSolvesAfterFreeze(game, *curTeamScoreItem, scoreBoard, solveMap[curTeam.TeamID], users)
+		curTeamScoreItem = &myTeamScoreItem
+	}
+
 	curStartIdx := (page - 1) * size
 	curEndIdx := min(curStartIdx+size, totalCachedTeamsCount)
 
@@ -406,6 +479,10 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		SimpleGameChallenges: simpleGameChallenges,
 		Groups:               simpleGameGroups,
 		CurrentGroup:         currentGroup,
+		Stages:               stageNames,
+		CurrentStage:         stageName,
+		Frozen:               scoreBoard.Frozen,
+		FreezeTime:           scoreBoard.FreezeTime,
 		Pagination:           &pagination,
 	}
 
@@ -418,3 +495,40 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		"data": result,
 	})
 }
+
+// 把队伍封榜后的解题加到队伍自己的排行榜数据上, 分数按照封榜时的题目分数计算, 排名保持封榜时的排名
+// 缓存里的切片是共享的, 这里复制一份
+func withOwnSolvesAfterFreeze(game models.Game, teamScoreItem webmodels.TeamScoreItem, scoreBoard *webmodels.CachedGameScoreBoardData, solves []models.Solve, users map[string]models.User) webmodels.TeamScoreItem {
+	solved := make(map[int64]bool, len(teamScoreItem.SolvedChallenges))
+	for _, solve := range teamScoreItem.SolvedChallenges {
+		solved[solve.ChallengeID] = true
+	}
+
+	solvedChallenges := make([]webmodels.TeamSolveItem, 0, len(teamScoreItem.SolvedChallenges)+len(solves))
+	solvedChallenges = append(solvedChallenges, teamScoreItem.SolvedChallenges...)
+
+	for _, solve := range solves {
+		if !solve.SolveTime.After(*scoreBoard.FreezeTime) || solve.SolveTime.After(game.EndTime) || solved[solve.ChallengeID] {
+			continue
+		}
+
+		frozenChallenge, ok := scoreBoard.FrozenChallenges[solve.ChallengeID]
+		if !ok {
+			continue
+		}
+
+		// 解题名次会暴露其他队伍封榜后的解题, 这里不返回
+		solvedChallenges = append(solvedChallenges, webmodels.TeamSolveItem{
+			ChallengeID:   solve.ChallengeID,
+			ChallengeName: solve.Challenge.Name,
+			Score:         frozenChallenge.CurScore,
+			Solver:        users[solve.SolverID].Username,
+			SolveTime:     solve.SolveTime,
+		})
+		teamScoreItem.Score += frozenChallenge.CurScore
+		solved[solve.ChallengeID] = true
+	}
+
+	teamScoreItem.SolvedChallenges = solvedChallenges
+	return teamScoreItem
+}
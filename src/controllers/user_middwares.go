@@ -288,6 +288,36 @@ func ChallengeStatusCheckMiddleWare(accessableAfterStageEnded bool) gin.HandlerF
 			return
 		}
 
+		// 没有满足前置条件的题目对队伍不可见
+		if team, ok := c.Get("team"); ok {
+			lockedChallenges, err := ristretto_tool.CachedTeamLockedChallenges(game.GameID, team.(models.Team).TeamID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+					Code:    500,
+					Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadChallengeDetails"}),
+				})
+				c.Abort()
+				return
+			}
+
+			// 没有晋级到题目所属阶段的队伍也看不到题目
+			stageEligible := true
+			if game.Stages != nil && gameChallenge.BelongStage != nil {
+				if stage := game.Stages.Find(*gameChallenge.BelongStage); stage != nil {
+					stageEligible = stage.TeamEligible(team.(models.Team).TeamID)
+				}
+			}
+
+			if lockedChallenges[challengeID] || !stageEligible {
+				c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+					Code:    400,
+					Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidChallengeID"}),
+				})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+const TableNameAttachmentDownload = "attachment_downloads"
+
+// AttachmentDownload mapped from table <attachment_downloads>
+type AttachmentDownload struct {
+	DownloadID   string    `gorm:"column:download_id;primaryKey" json:"download_id"`
+	GameID       int64     `gorm:"column:game_id;not null" json:"game_id"`
+	IngameID     int64     `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	ChallengeID  int64     `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	TeamID       int64     `gorm:"column:team_id;not null" json:"team_id"`
+	UserID       string    `gorm:"column:user_id;not null" json:"user_id"`
+	AttachName   string    `gorm:"column:attach_name;not null" json:"attach_name"`
+	DownloadTime time.Time `gorm:"column:download_time;not null" json:"download_time"`
+	ClientIP     *string   `gorm:"column:client_ip" json:"client_ip"`
+}
+
+// TableName AttachmentDownload's table name
+func (*AttachmentDownload) TableName() string {
+	return TableNameAttachmentDownload
+}
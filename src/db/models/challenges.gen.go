@@ -65,6 +65,45 @@ type JudgeConfig struct {
 	JudgeType    JudgeType `json:"judge_type"`
 	JudgeScript  *string   `json:"judge_script,omitempty"`
 	FlagTemplate *string   `json:"flag_template,omitempty"`
+	// 动态 flag 的题目每次启动靶机都用模板生成新的 flag, 只有队伍最近一次启动的靶机的 flag 有效
+	PerContainerFlag bool `json:"per_container_flag,omitempty"`
+
+	// 静态 flag 额外接受的答案
+	FlagAnswers []string `json:"flag_answers,omitempty"`
+	// 静态 flag 接受的正则表达式, 匹配时会加上 ^ 和 $ 锚定整个提交
+	FlagRegexps []string `json:"flag_regexps,omitempty"`
+	// 比较前的规范化选项, 对提交和答案同时生效
+	FlagCaseInsensitive bool `json:"flag_case_insensitive,omitempty"`
+	FlagTrimSpace       bool `json:"flag_trim_space,omitempty"`
+	FlagNormalizeNFKC   bool `json:"flag_normalize_nfkc,omitempty"`
+	// flag 的前缀, 比如 flag 表示提交必须是 flag{...} 的形式, 不符合的提交直接拒绝并提示, 不会记录为错误提交
+	FlagPrefix *string `json:"flag_prefix,omitempty"`
+
+	// 多段 flag, 配置后题目由多个子 flag 组成, 每个子 flag 按权重获得部分分数, 全部提交后才算解出
+	SubFlags []SubFlagConfig `json:"sub_flags,omitempty"`
+
+	// 蜜罐 flag, 每次启动靶机都会放入一个队伍唯一的假 flag, 别的队伍提交它时记录为作弊
+	Honeypot *HoneypotConfig `json:"honeypot,omitempty"`
+}
+
+// HoneypotConfig 蜜罐 flag 放入靶机的位置, 环境变量和文件至少配置一个
+type HoneypotConfig struct {
+	// 注入的环境变量名
+	EnvName string `json:"env_name,omitempty"`
+	// 写入的文件路径, 必须是绝对路径
+	FilePath string `json:"file_path,omitempty"`
+	// 假 flag 的生成模板, 支持和 flag 模板一样的占位符, 为空时使用 <flag 前缀>{[random_string_32]}
+	Template string `json:"template,omitempty"`
+}
+
+// SubFlagConfig 多段 flag 中的一个子 flag
+type SubFlagConfig struct {
+	// 子 flag 名称, 只能包含字母数字和下划线, 动态 flag 会以 A1CTF_FLAG_<NAME> 注入到靶机中
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	// 动态 flag 时为生成模板, 静态 flag 时为答案
+	FlagType     FlagType `json:"flag_type"`
+	FlagTemplate string   `json:"flag_template"`
 }
 
 func (e JudgeConfig) Value() (driver.Value, error) {
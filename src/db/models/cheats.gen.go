@@ -14,11 +14,87 @@ const (
 	CheatSubmitSomeonesFlag               = "SubmitSomeonesFlag"
 	CheatSubmitWithoutDownloadAttachments = "SubmitWithoutDownloadAttachments"
 	CheatSubmitWithoutStartContainer      = "SubmitWithoutStartContainer"
+	// 不同队伍在时间窗口内使用了同一个 IP 提交 flag、启动靶机或者登录
+	CheatSharedIPAcrossTeams = "SharedIPAcrossTeams"
+	// 同一个 IP 注册的账号出现在了不同的队伍中
+	CheatSameRegisterIPAcrossTeams = "SameRegisterIPAcrossTeams"
+	// 两个队伍解题的顺序和时间间隔高度相似, 可能在共享 flag
+	CheatSolveTimingCorrelation = "SolveTimingCorrelation"
+	// 提交了别的队伍靶机中的蜜罐 flag
+	CheatSubmitHoneypotFlag = "SubmitHoneypotFlag"
 )
 
+// 管理员对作弊记录的审核结论
+type CheatReviewStatus string
+
+const (
+	CheatReviewPending   CheatReviewStatus = "Pending"
+	CheatReviewConfirmed CheatReviewStatus = "Confirmed"
+	CheatReviewDismissed CheatReviewStatus = "Dismissed"
+)
+
+func (e CheatReviewStatus) Value() (driver.Value, error) {
+	return string(e), nil
+}
+
+func (e *CheatReviewStatus) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*e = CheatReviewStatus(v)
+	case []byte:
+		*e = CheatReviewStatus(v)
+	case nil:
+		*e = CheatReviewPending
+	default:
+		return errors.New("cannot scan value into CheatReviewStatus")
+	}
+	return nil
+}
+
+type CheatEvidenceSource string
+
+const (
+	CheatEvidenceSubmit    CheatEvidenceSource = "Submit"
+	CheatEvidenceContainer CheatEvidenceSource = "Container"
+	CheatEvidenceLogin     CheatEvidenceSource = "Login"
+	CheatEvidenceRegister  CheatEvidenceSource = "Register"
+)
+
+// 两个队伍在同一道题上的解题时间, 作为解题时间关联分析的证据
+type CheatSolveEvidence struct {
+	ChallengeID       int64     `json:"challenge_id"`
+	ChallengeName     string    `json:"challenge_name"`
+	SolveTime         time.Time `json:"solve_time"`
+	RelevantSolveTime time.Time `json:"relevant_solve_time"`
+	GapSeconds        float64   `json:"gap_seconds"`
+}
+
+// 一条 IP 使用记录, 作为 IP 关联分析的证据
+type CheatEvidence struct {
+	IP       string              `json:"ip"`
+	Source   CheatEvidenceSource `json:"source"`
+	TeamID   int64               `json:"team_id"`
+	TeamName string              `json:"team_name"`
+	UserID   string              `json:"user_id"`
+	UserName string              `json:"user_name"`
+	Time     time.Time           `json:"time"`
+}
+
 type CheatExtraData struct {
 	RelevantTeam     int64  `json:"relevant_team"`
 	RelevantTeamName string `json:"relevant_teamname"`
+	// 判定为作弊的原因, 给管理员审核时参考
+	Reason string `json:"reason,omitempty"`
+	// 没有下载的附件名称
+	Attachments []string `json:"attachments,omitempty"`
+	// 多个队伍共用的 IP
+	IP string `json:"ip,omitempty"`
+	// 涉及到的 IP、用户和时间
+	Evidence []CheatEvidence `json:"evidence,omitempty"`
+	// 解题时间关联分析的相似度, 0 到 1
+	CorrelationScore float64 `json:"correlation_score,omitempty"`
+	// 时间相近的解题记录
+	Solves []CheatSolveEvidence `json:"solves,omitempty"`
 }
 
 func (e CheatExtraData) Value() (driver.Value, error) {
@@ -53,21 +129,30 @@ type Cheat struct {
 	CheatType     CheatType      `gorm:"column:cheat_type;not null" json:"cheat_type"`
 	GameID        int64          `gorm:"column:game_id;not null" json:"game_id"`
 	Game          Game           `gorm:"foreignKey:GameID;references:game_id" json:"-"`
-	IngameID      int64          `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	IngameID      *int64         `gorm:"column:ingame_id" json:"ingame_id"`
 	GameChallenge GameChallenge  `gorm:"foreignKey:IngameID;references:ingame_id" json:"-"`
-	ChallengeID   int64          `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	ChallengeID   *int64         `gorm:"column:challenge_id" json:"challenge_id"`
 	Challenge     Challenge      `gorm:"foreignKey:ChallengeID;references:challenge_id" json:"-"`
 	TeamID        int64          `gorm:"column:team_id;not null" json:"team_id"`
 	Team          Team           `gorm:"foreignKey:TeamID;references:team_id" json:"-"`
 	FlagID        *int64         `gorm:"column:flag_id" json:"flag_id"`
 	TeamFlag      *TeamFlag      `gorm:"foreignKey:FlagID;references:flag_id" json:"-"`
-	JudgeID       string         `gorm:"column:judge_id;not null" json:"judge_id"`
+	JudgeID       *string        `gorm:"column:judge_id" json:"judge_id"`
 	Judge         Judge          `gorm:"foreignKey:JudgeID;references:judge_id" json:"-"`
 	SubmiterID    string         `gorm:"column:submiter_id;not null" json:"submiter_id"`
 	Submiter      User           `gorm:"foreignKey:SubmiterID;references:user_id" json:"-"`
 	ExtraData     CheatExtraData `gorm:"column:extra_data;type:jsonb" json:"extra_data"`
 	CheatTime     time.Time      `gorm:"column:cheat_time;not null" json:"cheat_time"`
 	SubmiterIP    *string        `gorm:"column:submiter_ip" json:"submiter_ip"`
+
+	// 审核
+	ReviewStatus    CheatReviewStatus `gorm:"column:review_status;not null;default:Pending" json:"review_status"`
+	ReviewerID      *string           `gorm:"column:reviewer_id" json:"reviewer_id"`
+	Reviewer        *User             `gorm:"foreignKey:ReviewerID;references:user_id" json:"-"`
+	ReviewNote      *string           `gorm:"column:review_note" json:"review_note"`
+	ReviewTime      *time.Time        `gorm:"column:review_time" json:"review_time"`
+	AdjustmentID    *int64            `gorm:"column:adjustment_id" json:"adjustment_id"`
+	ScoreAdjustment *ScoreAdjustment  `gorm:"foreignKey:AdjustmentID;references:adjustment_id" json:"-"`
 }
 
 // TableName Cheat's table name
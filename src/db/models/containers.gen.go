@@ -15,6 +15,8 @@ type ExposePort struct {
 	PortName string `json:"port_name"`
 	Port     int32  `json:"port"`
 	IP       string `json:"ip"`
+	// WEB 题目通过网关反向代理访问的域名
+	Hostname string `json:"hostname,omitempty"`
 }
 
 type ExposePorts []ExposePort
@@ -26,6 +28,31 @@ type ContainerExposeInfo struct {
 
 type ContainerExposeInfos []ContainerExposeInfo
 
+// AllocatedPort 为容器分配的宿主机端口
+type AllocatedPort struct {
+	ContainerName string `json:"container_name"`
+	PortName      string `json:"port_name"`
+	Port          int32  `json:"port"`
+	HostPort      int32  `json:"host_port"`
+}
+
+type AllocatedPorts []AllocatedPort
+
+func (e AllocatedPorts) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return sonic.Marshal(e)
+}
+
+func (e *AllocatedPorts) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return sonic.Unmarshal(b, e)
+}
+
 func (e ExposePorts) Value() (driver.Value, error) {
 	return sonic.Marshal(e)
 }
@@ -88,12 +115,23 @@ type Container struct {
 	StartTime            time.Time            `gorm:"column:start_time;not null" json:"start_time"`
 	ExpireTime           time.Time            `gorm:"column:expire_time;not null" json:"expire_time"`
 	ContainerExposeInfos ContainerExposeInfos `gorm:"column:expose_ports;not null" json:"expose_ports"`
+	AllocatedPorts       AllocatedPorts       `gorm:"column:allocated_ports;not null" json:"allocated_ports"`
 	ContainerStatus      ContainerStatus      `gorm:"column:container_status;not null" json:"container_status"`
 	TeamFlag             TeamFlag             `gorm:"foreignKey:FlagID;references:flag_id" json:"-"`
 	ContainerConfig      dockertool.A1Containers `gorm:"column:container_config" json:"container_config"`
 	ChallengeName        string               `gorm:"column:challenge_name;not null" json:"challenge_name"`
 	TeamHash             string               `gorm:"column:team_hash;not null" json:"team_hash"`
 	SubmiterIP           *string              `gorm:"column:submiter_ip" json:"submiter_ip"`
+	ContainerFlag        *string              `gorm:"column:container_flag" json:"-"`
+	DecoyFlag            *string              `gorm:"column:decoy_flag" json:"-"`
+}
+
+// InstanceFlag 返回注入到靶机中的 flag, 每个靶机单独生成了 flag 时优先使用, 需要预加载 TeamFlag
+func (c *Container) InstanceFlag() string {
+	if c.ContainerFlag != nil {
+		return *c.ContainerFlag
+	}
+	return c.TeamFlag.FlagContent
 }
 
 // TableName Container's table name
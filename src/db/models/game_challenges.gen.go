@@ -6,14 +6,34 @@ import (
 	"time"
 
 	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
 )
 
 const TableNameGameChallenge = "game_challenges"
 
 type Hint struct {
+	// 用于记录队伍解锁了哪条提示, 保存题目时自动生成
+	HintID     string    `json:"hint_id,omitempty"`
 	Content    string    `json:"content"`
 	CreateTime time.Time `json:"create_time"`
 	Visible    bool      `json:"visible"`
+	// 解锁提示扣除的分数
+	Cost float64 `json:"cost,omitempty"`
+	// 解锁提示增加的罚时, 单位秒
+	PenaltySeconds int64 `json:"penalty_seconds,omitempty"`
+	// 定时发布, 到达发布时间或者题目持续这么多分钟没有队伍解出时自动公开, 发布后清空
+	ReleaseTime         *time.Time `json:"release_time,omitempty"`
+	ReleaseAfterNoSolve int64      `json:"release_after_no_solve,omitempty"`
+}
+
+// ScheduledRelease 提示是否设置了定时发布
+func (h Hint) ScheduledRelease() bool {
+	return h.ReleaseTime != nil || h.ReleaseAfterNoSolve > 0
+}
+
+// Locked 提示是否需要队伍手动解锁
+func (h Hint) Locked() bool {
+	return h.Cost > 0 || h.PenaltySeconds > 0
 }
 
 type Hints []Hint
@@ -30,6 +50,50 @@ func (e *Hints) Scan(value interface{}) error {
 	return sonic.Unmarshal(b, e)
 }
 
+// AssignIDs 给没有 ID 的提示生成 ID
+func (e Hints) AssignIDs() {
+	for idx := range e {
+		if e[idx].HintID == "" {
+			e[idx].HintID = uuid.NewString()
+		}
+	}
+}
+
+// CategoryRequirement 需要在某个类别中解出的题目数量
+type CategoryRequirement struct {
+	Category  ChallengeCategory `json:"category"`
+	MinSolves int               `json:"min_solves"`
+}
+
+// ChallengePrerequisites 题目的前置条件, 队伍满足全部条件后才能看到题目
+type ChallengePrerequisites struct {
+	// 需要解出的前置题目 ID
+	Challenges []int64 `json:"challenges,omitempty"`
+	// 为 0 时需要解出全部前置题目, 否则解出其中任意这么多道即可
+	MinChallenges int `json:"min_challenges,omitempty"`
+	// 队伍分数需要达到的值
+	MinScore float64 `json:"min_score,omitempty"`
+	// 每个类别需要解出的题目数量
+	Categories []CategoryRequirement `json:"categories,omitempty"`
+}
+
+func (e ChallengePrerequisites) Value() (driver.Value, error) {
+	return sonic.Marshal(e)
+}
+
+func (e *ChallengePrerequisites) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return sonic.Unmarshal(b, e)
+}
+
+// Empty 没有设置任何前置条件
+func (e *ChallengePrerequisites) Empty() bool {
+	return e == nil || (len(e.Challenges) == 0 && e.MinScore <= 0 && len(e.Categories) == 0)
+}
+
 type GameChallenge struct {
 	IngameID     int64        `gorm:"column:ingame_id;primaryKey;autoIncrement:true" json:"ingame_id"`
 	GameID       int64        `gorm:"column:game_id;not null" json:"game_id"`
@@ -47,6 +111,17 @@ type GameChallenge struct {
 	Visible      bool         `gorm:"column:visible" json:"visible"`
 
 	BloodRewardEnabled bool `gorm:"column:enable_blood_reward" json:"enable_blood_reward"`
+	// 为空时使用比赛的计分方式
+	ScoringStrategy *ScoringStrategy `gorm:"column:scoring_strategy" json:"scoring_strategy"`
+
+	// 定时发布, 到达发布时间或者比赛持续这么多分钟没有队伍解题时自动公开, 发布后清空
+	ReleaseTime         *time.Time `gorm:"column:release_time" json:"release_time"`
+	ReleaseAfterNoSolve *int64     `gorm:"column:release_after_no_solve" json:"release_after_no_solve"`
+	// 题目最近一次公开的时间
+	VisibleTime *time.Time `gorm:"column:visible_time" json:"visible_time"`
+
+	// 为空时所有队伍都可以看到题目
+	Prerequisites *ChallengePrerequisites `gorm:"column:prerequisites" json:"prerequisites"`
 	// Challenge Challenge `gorm:"foreignKey:challenge_id;references:challenges.challenge_id"`
 }
 
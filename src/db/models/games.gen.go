@@ -14,10 +14,37 @@ type GameStage struct {
 	StageName string    `json:"stage_name"`
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
+	// 阶段排行榜是否累加之前阶段的分数
+	CarryOver bool `json:"carry_over"`
+	// 可以参加这个阶段的队伍, 为空时所有队伍都可以参加
+	EligibleTeams []int64 `json:"eligible_teams,omitempty"`
+}
+
+// TeamEligible 队伍是否可以参加这个阶段
+func (s GameStage) TeamEligible(teamID int64) bool {
+	if len(s.EligibleTeams) == 0 {
+		return true
+	}
+	for _, eligibleTeamID := range s.EligibleTeams {
+		if eligibleTeamID == teamID {
+			return true
+		}
+	}
+	return false
 }
 
 type GameStages []GameStage
 
+// Find 按名称查找阶段
+func (e GameStages) Find(stageName string) *GameStage {
+	for idx := range e {
+		if e[idx].StageName == stageName {
+			return &e[idx]
+		}
+	}
+	return nil
+}
+
 func (e GameStages) Value() (driver.Value, error) {
 	return sonic.Marshal(e)
 }
@@ -49,6 +76,40 @@ func (e *TeamPolicy) Scan(value interface{}) error {
 	return sonic.Unmarshal(b, e)
 }
 
+// 题目分数随解题人数变化的方式
+type ScoringStrategy string
+
+const (
+	// 固定分数
+	ScoringStatic ScoringStrategy = "static"
+	// 指数衰减, 原来的动态分数公式
+	ScoringExponential ScoringStrategy = "exponential"
+	// 线性衰减, difficulty 次解题后降到最低分
+	ScoringLinear ScoringStrategy = "linear"
+	// 对数衰减, difficulty 次解题后降到最低分
+	ScoringLogarithmic ScoringStrategy = "logarithmic"
+	// CTFd 的抛物线衰减, difficulty 次解题后降到最低分
+	ScoringQuadratic ScoringStrategy = "quadratic"
+)
+
+func (e ScoringStrategy) Value() (driver.Value, error) {
+	return string(e), nil
+}
+
+func (e *ScoringStrategy) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*e = ScoringStrategy(v)
+	case []byte:
+		*e = ScoringStrategy(v)
+	case nil:
+		*e = ""
+	default:
+		return errors.New("cannot scan value into ScoringStrategy")
+	}
+	return nil
+}
+
 // Game mapped from table <games>
 type Game struct {
 	GameID               int64       `gorm:"column:game_id;primaryKey;autoIncrement:true" json:"game_id"`
@@ -73,6 +134,25 @@ type Game struct {
 	FirstBloodReward  int64 `gorm:"column:first_blood_reward" json:"first_blood_reward"`
 	SecondBloodReward int64 `gorm:"column:second_blood_reward" json:"second_blood_reward"`
 	ThirdBloodReward  int64 `gorm:"column:third_blood_reward" json:"third_blood_reward"`
+
+	// 题目没有单独设置时使用的计分方式
+	ScoringStrategy ScoringStrategy `gorm:"column:scoring_strategy;not null;default:exponential" json:"scoring_strategy"`
+
+	// 封榜时间, 之后的解题不会出现在公开排行榜上, 为空时不封榜
+	FreezeTime *time.Time `gorm:"column:freeze_time" json:"freeze_time"`
+	// 管理员是否已经揭晓封榜后的排名
+	ScoreboardRevealed bool `gorm:"column:scoreboard_revealed;not null;default:false" json:"scoreboard_revealed"`
+
+	// 题目没有单独设置时使用的 flag 前缀, 为空时不检查格式
+	FlagPrefix *string `gorm:"column:flag_prefix" json:"flag_prefix"`
+}
+
+// ScoreboardFrozen 公开排行榜是否处于封榜状态, 封榜会一直持续到管理员揭晓排名
+func (g Game) ScoreboardFrozen(now time.Time) bool {
+	if g.FreezeTime == nil || g.ScoreboardRevealed {
+		return false
+	}
+	return !now.Before(*g.FreezeTime) && g.FreezeTime.Before(g.EndTime)
 }
 
 // TableName Game's table name
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+const TableNameGatewayConnection = "gateway_connections"
+
+// GatewayConnection mapped from table <gateway_connections>
+type GatewayConnection struct {
+	ConnectionID  string     `gorm:"column:connection_id;primaryKey" json:"connection_id"`
+	GameID        int64      `gorm:"column:game_id;not null" json:"game_id"`
+	TeamID        int64      `gorm:"column:team_id;not null" json:"team_id"`
+	UserID        string     `gorm:"column:user_id;not null" json:"user_id"`
+	ContainerID   string     `gorm:"column:container_id;not null" json:"container_id"`
+	ChallengeID   int64      `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	ContainerName string     `gorm:"column:container_name;not null" json:"container_name"`
+	PortName      string     `gorm:"column:port_name;not null" json:"port_name"`
+	ClientIP      string     `gorm:"column:client_ip;not null" json:"client_ip"`
+	StartTime     time.Time  `gorm:"column:start_time;not null" json:"start_time"`
+	EndTime       *time.Time `gorm:"column:end_time" json:"end_time"`
+	BytesIn       int64      `gorm:"column:bytes_in;not null" json:"bytes_in"`
+	BytesOut      int64      `gorm:"column:bytes_out;not null" json:"bytes_out"`
+}
+
+// TableName GatewayConnection's table name
+func (*GatewayConnection) TableName() string {
+	return TableNameGatewayConnection
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+const TableNameHintUnlock = "hint_unlocks"
+
+// HintUnlock mapped from table <hint_unlocks>
+type HintUnlock struct {
+	UnlockID    string    `gorm:"column:unlock_id;primaryKey" json:"unlock_id"`
+	GameID      int64     `gorm:"column:game_id;not null" json:"game_id"`
+	IngameID    int64     `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	ChallengeID int64     `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	Challenge   Challenge `gorm:"foreignKey:ChallengeID;references:challenge_id" json:"-"`
+	TeamID      int64     `gorm:"column:team_id;not null" json:"team_id"`
+	Team        Team      `gorm:"foreignKey:TeamID;references:team_id" json:"-"`
+	UserID      string    `gorm:"column:user_id;not null" json:"user_id"`
+	User        User      `gorm:"foreignKey:UserID;references:user_id" json:"-"`
+	HintID      string    `gorm:"column:hint_id;not null" json:"hint_id"`
+	// 解锁时提示的分数和罚时, 之后修改提示不影响已经解锁的队伍
+	Cost           float64   `gorm:"column:cost;not null" json:"cost"`
+	PenaltySeconds int64     `gorm:"column:penalty_seconds;not null" json:"penalty_seconds"`
+	UnlockTime     time.Time `gorm:"column:unlock_time;not null" json:"unlock_time"`
+}
+
+// TableName HintUnlock's table name
+func (*HintUnlock) TableName() string {
+	return TableNameHintUnlock
+}
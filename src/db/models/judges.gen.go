@@ -17,6 +17,8 @@ const (
 	JudgeWA       JudgeStatus = "JudgeWA"
 	JudgeAC       JudgeStatus = "JudgeAC"
 	JudgeTimeout  JudgeStatus = "JudgeTimeout"
+	// 多段 flag 题目中提交了一个子 flag, 题目还没有全部完成
+	JudgePartialAC JudgeStatus = "JudgePartialAC"
 )
 
 func (e JudgeStatus) Value() (driver.Value, error) {
@@ -53,6 +55,7 @@ type Judge struct {
 	JudgeTime     time.Time     `gorm:"column:judge_time;not null" json:"judge_time"`
 	JudgeContent  string        `gorm:"column:judge_content;not null" json:"judge_content"`
 	SubmiterIP    *string       `gorm:"column:submiter_ip" json:"submiter_ip"`
+	ContainerID   *string       `gorm:"column:container_id" json:"container_id"`
 }
 
 // TableName Judge's table name
@@ -16,6 +16,7 @@ const (
 	AdjustmentTypeCheat  AdjustmentType = "cheat"  // 作弊扣分
 	AdjustmentTypeReward AdjustmentType = "reward" // 奖励加分
 	AdjustmentTypeOther  AdjustmentType = "other"  // 其他调整
+	AdjustmentTypeHint   AdjustmentType = "hint"   // 解锁提示扣分, 只在积分榜中展示, 不写入数据库
 )
 
 func (e AdjustmentType) Value() (driver.Value, error) {
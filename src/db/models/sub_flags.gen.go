@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+const TableNameTeamSubFlag = "team_sub_flags"
+
+// TeamSubFlag mapped from table <team_sub_flags>
+// 多段 flag 题目中队伍的动态子 flag
+type TeamSubFlag struct {
+	TeamID      int64  `gorm:"column:team_id;primaryKey" json:"team_id"`
+	IngameID    int64  `gorm:"column:ingame_id;primaryKey" json:"ingame_id"`
+	SubFlag     string `gorm:"column:sub_flag;primaryKey" json:"sub_flag"`
+	GameID      int64  `gorm:"column:game_id;not null" json:"game_id"`
+	FlagContent string `gorm:"column:flag_content;not null" json:"flag_content"`
+}
+
+// TableName TeamSubFlag's table name
+func (*TeamSubFlag) TableName() string {
+	return TableNameTeamSubFlag
+}
+
+const TableNameSubFlagSolve = "sub_flag_solves"
+
+// SubFlagSolve mapped from table <sub_flag_solves>
+// 多段 flag 题目中队伍提交正确的子 flag, 全部子 flag 都提交后会再插入一条 Solve
+type SubFlagSolve struct {
+	TeamID      int64     `gorm:"column:team_id;primaryKey" json:"team_id"`
+	IngameID    int64     `gorm:"column:ingame_id;primaryKey" json:"ingame_id"`
+	SubFlag     string    `gorm:"column:sub_flag;primaryKey" json:"sub_flag"`
+	GameID      int64     `gorm:"column:game_id;not null" json:"game_id"`
+	Game        Game      `gorm:"foreignKey:GameID;references:game_id" json:"-"`
+	ChallengeID int64     `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	JudgeID     string    `gorm:"column:judge_id;not null" json:"judge_id"`
+	SolverID    string    `gorm:"column:solver_id;not null" json:"solver_id"`
+	ContainerID *string   `gorm:"column:container_id" json:"container_id"`
+	SolveTime   time.Time `gorm:"column:solve_time;not null" json:"solve_time"`
+}
+
+// TableName SubFlagSolve's table name
+func (*SubFlagSolve) TableName() string {
+	return TableNameSubFlagSolve
+}
+
+// 计算多段 flag 题目中已经提交的子 flag 占总权重的比例, 不在配置里的子 flag 不计分
+func SubFlagCreditRatio(config *JudgeConfig, solvedSubFlags []string) float64 {
+	if config == nil || len(config.SubFlags) == 0 {
+		return 0
+	}
+
+	totalWeight := 0.0
+	solvedWeight := 0.0
+	for _, subFlag := range config.SubFlags {
+		totalWeight += subFlag.Weight
+		for _, solved := range solvedSubFlags {
+			if solved == subFlag.Name {
+				solvedWeight += subFlag.Weight
+				break
+			}
+		}
+	}
+
+	if totalWeight <= 0 {
+		return 0
+	}
+
+	return solvedWeight / totalWeight
+}
@@ -75,6 +75,7 @@ const (
 	ResourceTypeSystem    = "SYSTEM"
 	ResourceTypeScore     = "SCORE"
 	ResourceTypeFile      = "FILE"
+	ResourceTypeCheat     = "CHEAT"
 )
 
 // 操作类型常量
@@ -93,6 +94,8 @@ const (
 	ActionDownload      = "DOWNLOAD"
 	ActionSubmitFlag    = "SUBMIT_FLAG"
 	ActionJudge         = "JUDGE"
+	ActionReview        = "REVIEW"
+	ActionUnlockHint    = "UNLOCK_HINT"
 
 	// 容器任务
 	ActionContainerStarting  = "CONTAINER_STARTING"
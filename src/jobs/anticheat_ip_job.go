@@ -0,0 +1,320 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"a1ctf/src/utils/zaphelper"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// 每个队伍对最多保留的证据条数, 避免 extra_data 过大
+const maxCheatEvidence = 20
+
+// 一次 IP 使用记录
+type ipEvent struct {
+	IP     string
+	Source models.CheatEvidenceSource
+	TeamID int64
+	UserID string
+	Time   time.Time
+}
+
+// 两个队伍在同一个 IP 上的关联, teamA < teamB
+type ipPairKey struct {
+	CheatType models.CheatType
+	TeamA     int64
+	TeamB     int64
+	IP        string
+}
+
+type ipPairFinding struct {
+	Events []ipEvent
+}
+
+func getIPCorrelationWindow() time.Duration {
+	window := viper.GetDuration("anti-cheat.ip-window")
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	return window
+}
+
+// IPCorrelationJob 分析正在进行的比赛中不同队伍之间的 IP 关联
+// 1. 不同队伍在时间窗口内使用同一个 IP 提交 flag、启动靶机或者登录
+// 2. 同一个 IP 注册的账号加入了不同的队伍
+func IPCorrelationJob() {
+	now := time.Now().UTC()
+	window := getIPCorrelationWindow()
+
+	var games []models.Game
+	if err := dbtool.DB().Where("start_time <= ? AND end_time >= ?", now, now.Add(-window)).Find(&games).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load running games for ip correlation", zap.Error(err))
+		return
+	}
+
+	for _, game := range games {
+		if err := analyseGameIPCorrelation(game.GameID, window); err != nil {
+			zaphelper.Logger.Error("Failed to analyse ip correlation", zap.Error(err), zap.Int64("game_id", game.GameID))
+		}
+	}
+}
+
+func analyseGameIPCorrelation(gameID int64, window time.Duration) error {
+	var teams []models.Team
+	if err := dbtool.DB().Where("game_id = ? AND team_type = ?", gameID, models.TeamTypePlayer).Find(&teams).Error; err != nil {
+		return fmt.Errorf("failed to load teams: %w", err)
+	}
+
+	teamMap := make(map[int64]models.Team, len(teams))
+	userTeamMap := make(map[string]int64)
+	userIDs := make([]string, 0)
+	for _, team := range teams {
+		teamMap[team.TeamID] = team
+		for _, member := range team.TeamMembers {
+			userTeamMap[member] = team.TeamID
+			userIDs = append(userIDs, member)
+		}
+	}
+
+	if len(teamMap) < 2 {
+		return nil
+	}
+
+	var users []models.User
+	if len(userIDs) > 0 {
+		if err := dbtool.DB().Where("user_id IN ?", userIDs).Find(&users).Error; err != nil {
+			return fmt.Errorf("failed to load users: %w", err)
+		}
+	}
+
+	userMap := make(map[string]models.User, len(users))
+	for _, user := range users {
+		userMap[user.UserID] = user
+	}
+
+	// 收集提交 flag、启动靶机和登录时使用的 IP
+	events := make([]ipEvent, 0)
+
+	var judges []models.Judge
+	if err := dbtool.DB().Select("team_id", "submiter_id", "submiter_ip", "judge_time").
+		Where("game_id = ? AND submiter_ip IS NOT NULL AND submiter_ip != ''", gameID).Find(&judges).Error; err != nil {
+		return fmt.Errorf("failed to load judges: %w", err)
+	}
+	for _, judge := range judges {
+		if _, ok := teamMap[judge.TeamID]; !ok {
+			continue
+		}
+		events = append(events, ipEvent{IP: *judge.SubmiterIP, Source: models.CheatEvidenceSubmit, TeamID: judge.TeamID, UserID: judge.SubmiterID, Time: judge.JudgeTime})
+	}
+
+	var containers []models.Container
+	if err := dbtool.DB().Select("team_id", "container_id", "submiter_ip", "start_time").
+		Where("game_id = ? AND submiter_ip IS NOT NULL AND submiter_ip != ''", gameID).Find(&containers).Error; err != nil {
+		return fmt.Errorf("failed to load containers: %w", err)
+	}
+	for _, container := range containers {
+		if _, ok := teamMap[container.TeamID]; !ok {
+			continue
+		}
+		events = append(events, ipEvent{IP: *container.SubmiterIP, Source: models.CheatEvidenceContainer, TeamID: container.TeamID, Time: container.StartTime})
+	}
+
+	for _, user := range users {
+		if user.LastLoginIP == nil || *user.LastLoginIP == "" {
+			continue
+		}
+		events = append(events, ipEvent{IP: *user.LastLoginIP, Source: models.CheatEvidenceLogin, TeamID: userTeamMap[user.UserID], UserID: user.UserID, Time: user.LastLoginTime})
+	}
+
+	findings := make(map[ipPairKey]*ipPairFinding)
+	collectSharedIPFindings(events, window, findings)
+	collectRegisterIPFindings(users, userTeamMap, findings)
+
+	if len(findings) == 0 {
+		return nil
+	}
+
+	return saveIPCorrelationCheats(gameID, teamMap, userMap, findings)
+}
+
+func addPairEvidence(findings map[ipPairKey]*ipPairFinding, cheatType models.CheatType, a, b ipEvent) {
+	key := ipPairKey{CheatType: cheatType, TeamA: a.TeamID, TeamB: b.TeamID, IP: a.IP}
+	if key.TeamA > key.TeamB {
+		key.TeamA, key.TeamB = key.TeamB, key.TeamA
+	}
+
+	finding, ok := findings[key]
+	if !ok {
+		finding = &ipPairFinding{}
+		findings[key] = finding
+	}
+
+	for _, event := range []ipEvent{a, b} {
+		if len(finding.Events) >= maxCheatEvidence {
+			return
+		}
+		duplicated := false
+		for _, existing := range finding.Events {
+			if existing == event {
+				duplicated = true
+				break
+			}
+		}
+		if !duplicated {
+			finding.Events = append(finding.Events, event)
+		}
+	}
+}
+
+// 同一个 IP 下按时间排序, 时间窗口内出现了不同的队伍就记录下来
+func collectSharedIPFindings(events []ipEvent, window time.Duration, findings map[ipPairKey]*ipPairFinding) {
+	eventsByIP := make(map[string][]ipEvent)
+	for _, event := range events {
+		eventsByIP[event.IP] = append(eventsByIP[event.IP], event)
+	}
+
+	for _, ipEvents := range eventsByIP {
+		sort.Slice(ipEvents, func(i, j int) bool {
+			return ipEvents[i].Time.Before(ipEvents[j].Time)
+		})
+
+		for i := range ipEvents {
+			for j := i + 1; j < len(ipEvents); j++ {
+				if ipEvents[j].Time.Sub(ipEvents[i].Time) > window {
+					break
+				}
+				if ipEvents[i].TeamID != ipEvents[j].TeamID {
+					addPairEvidence(findings, models.CheatSharedIPAcrossTeams, ipEvents[i], ipEvents[j])
+				}
+			}
+		}
+	}
+}
+
+// 注册 IP 相同的账号不在同一个队伍里
+func collectRegisterIPFindings(users []models.User, userTeamMap map[string]int64, findings map[ipPairKey]*ipPairFinding) {
+	eventsByIP := make(map[string][]ipEvent)
+	for _, user := range users {
+		if user.RegisterIP == nil || *user.RegisterIP == "" {
+			continue
+		}
+		eventsByIP[*user.RegisterIP] = append(eventsByIP[*user.RegisterIP], ipEvent{
+			IP:     *user.RegisterIP,
+			Source: models.CheatEvidenceRegister,
+			TeamID: userTeamMap[user.UserID],
+			UserID: user.UserID,
+			Time:   user.RegisterTime,
+		})
+	}
+
+	for _, ipEvents := range eventsByIP {
+		for i := range ipEvents {
+			for j := i + 1; j < len(ipEvents); j++ {
+				if ipEvents[i].TeamID != ipEvents[j].TeamID {
+					addPairEvidence(findings, models.CheatSameRegisterIPAcrossTeams, ipEvents[i], ipEvents[j])
+				}
+			}
+		}
+	}
+}
+
+func cheatDedupKey(cheatType models.CheatType, teamID int64, relevantTeam int64, ip string) string {
+	return fmt.Sprintf("%s|%d|%d|%s", cheatType, teamID, relevantTeam, ip)
+}
+
+// 每个队伍对给双方各写一条作弊记录, 已经记录过的队伍对和 IP 不再重复写入
+func saveIPCorrelationCheats(gameID int64, teamMap map[int64]models.Team, userMap map[string]models.User, findings map[ipPairKey]*ipPairFinding) error {
+	var existingCheats []models.Cheat
+	if err := dbtool.DB().Where("game_id = ? AND cheat_type IN ?", gameID, []models.CheatType{models.CheatSharedIPAcrossTeams, models.CheatSameRegisterIPAcrossTeams}).
+		Find(&existingCheats).Error; err != nil {
+		return fmt.Errorf("failed to load existing cheats: %w", err)
+	}
+
+	existing := make(map[string]struct{}, len(existingCheats))
+	for _, cheat := range existingCheats {
+		existing[cheatDedupKey(cheat.CheatType, cheat.TeamID, cheat.ExtraData.RelevantTeam, cheat.ExtraData.IP)] = struct{}{}
+	}
+
+	newCheats := make([]models.Cheat, 0)
+	for key, finding := range findings {
+		evidence := make([]models.CheatEvidence, 0, len(finding.Events))
+		for _, event := range finding.Events {
+			evidence = append(evidence, models.CheatEvidence{
+				IP:       event.IP,
+				Source:   event.Source,
+				TeamID:   event.TeamID,
+				TeamName: teamMap[event.TeamID].TeamName,
+				UserID:   event.UserID,
+				UserName: userMap[event.UserID].Username,
+				Time:     event.Time,
+			})
+		}
+
+		for _, pair := range [][2]int64{{key.TeamA, key.TeamB}, {key.TeamB, key.TeamA}} {
+			teamID, relevantTeam := pair[0], pair[1]
+			if _, ok := existing[cheatDedupKey(key.CheatType, teamID, relevantTeam, key.IP)]; ok {
+				continue
+			}
+
+			// 用这个队伍在证据中最后出现的用户和时间作为作弊者和作弊时间
+			var submiterID string
+			var cheatTime time.Time
+			for _, event := range finding.Events {
+				if event.TeamID != teamID || event.UserID == "" {
+					continue
+				}
+				if submiterID == "" || event.Time.After(cheatTime) {
+					submiterID = event.UserID
+					cheatTime = event.Time
+				}
+			}
+			// 只有靶机启动记录的情况下没有用户, 用队伍的第一个成员代替
+			if submiterID == "" {
+				members := teamMap[teamID].TeamMembers
+				if len(members) == 0 {
+					continue
+				}
+				submiterID = members[0]
+				for _, event := range finding.Events {
+					if event.TeamID == teamID && event.Time.After(cheatTime) {
+						cheatTime = event.Time
+					}
+				}
+			}
+
+			ip := key.IP
+			newCheats = append(newCheats, models.Cheat{
+				CheatID:    uuid.NewString(),
+				CheatType:  key.CheatType,
+				GameID:     gameID,
+				TeamID:     teamID,
+				SubmiterID: submiterID,
+				SubmiterIP: &ip,
+				CheatTime:  cheatTime,
+				ExtraData: models.CheatExtraData{
+					RelevantTeam:     relevantTeam,
+					RelevantTeamName: teamMap[relevantTeam].TeamName,
+					IP:               key.IP,
+					Evidence:         evidence,
+				},
+			})
+		}
+	}
+
+	if len(newCheats) == 0 {
+		return nil
+	}
+
+	if err := dbtool.DB().CreateInBatches(&newCheats, 100).Error; err != nil {
+		return fmt.Errorf("failed to save ip correlation cheats: %w", err)
+	}
+
+	zaphelper.Logger.Info("IP correlation found suspicious teams", zap.Int64("game_id", gameID), zap.Int("cheats", len(newCheats)))
+	return nil
+}
@@ -0,0 +1,284 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"a1ctf/src/utils/zaphelper"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type solveCorrelationConfig struct {
+	// 两个队伍解出同一道题的时间间隔在这个范围内才算相近
+	SolveGap time.Duration
+	// 至少有这么多道题时间相近才参与评分
+	MinCloseSolves int
+	// 相似度超过这个值判定为可疑
+	Threshold float64
+}
+
+func getSolveCorrelationConfig() solveCorrelationConfig {
+	config := solveCorrelationConfig{
+		SolveGap:       viper.GetDuration("anti-cheat.solve-gap"),
+		MinCloseSolves: viper.GetInt("anti-cheat.solve-min-close"),
+		Threshold:      viper.GetFloat64("anti-cheat.solve-threshold"),
+	}
+	if config.SolveGap <= 0 {
+		config.SolveGap = 2 * time.Minute
+	}
+	if config.MinCloseSolves <= 0 {
+		config.MinCloseSolves = 3
+	}
+	if config.Threshold <= 0 || config.Threshold > 1 {
+		config.Threshold = 0.8
+	}
+	return config
+}
+
+type solveCorrelationResult struct {
+	Score  float64
+	Solves []models.CheatSolveEvidence
+	// 每个队伍在证据中最后一次解题的记录, 用来填写作弊者和作弊时间
+	LastSolveA models.Solve
+	LastSolveB models.Solve
+}
+
+// SolveCorrelationJob 分析正在进行的比赛中解题顺序和时间间隔高度相似的队伍
+func SolveCorrelationJob() {
+	now := time.Now().UTC()
+	config := getSolveCorrelationConfig()
+
+	var games []models.Game
+	if err := dbtool.DB().Where("start_time <= ? AND end_time >= ?", now, now.Add(-config.SolveGap)).Find(&games).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load running games for solve correlation", zap.Error(err))
+		return
+	}
+
+	for _, game := range games {
+		if err := analyseGameSolveCorrelation(game.GameID, config); err != nil {
+			zaphelper.Logger.Error("Failed to analyse solve correlation", zap.Error(err), zap.Int64("game_id", game.GameID))
+		}
+	}
+}
+
+func analyseGameSolveCorrelation(gameID int64, config solveCorrelationConfig) error {
+	var teams []models.Team
+	if err := dbtool.DB().Where("game_id = ? AND team_type = ?", gameID, models.TeamTypePlayer).Find(&teams).Error; err != nil {
+		return fmt.Errorf("failed to load teams: %w", err)
+	}
+
+	teamMap := make(map[int64]models.Team, len(teams))
+	for _, team := range teams {
+		teamMap[team.TeamID] = team
+	}
+
+	var solves []models.Solve
+	if err := dbtool.DB().Where("game_id = ? AND solve_status = ?", gameID, models.SolveCorrect).
+		Preload("Challenge").Order("solve_time ASC").Find(&solves).Error; err != nil {
+		return fmt.Errorf("failed to load solves: %w", err)
+	}
+
+	// 每个队伍的解题记录, 以及每道题的解出队伍数
+	teamSolves := make(map[int64]map[int64]models.Solve)
+	solveCount := make(map[int64]int)
+	for _, solve := range solves {
+		if _, ok := teamMap[solve.TeamID]; !ok {
+			continue
+		}
+		if _, ok := teamSolves[solve.TeamID]; !ok {
+			teamSolves[solve.TeamID] = make(map[int64]models.Solve)
+		}
+		teamSolves[solve.TeamID][solve.IngameID] = solve
+		solveCount[solve.IngameID]++
+	}
+
+	teamIDs := make([]int64, 0, len(teamSolves))
+	for teamID, solved := range teamSolves {
+		if len(solved) >= config.MinCloseSolves {
+			teamIDs = append(teamIDs, teamID)
+		}
+	}
+	sort.Slice(teamIDs, func(i, j int) bool { return teamIDs[i] < teamIDs[j] })
+
+	findings := make(map[[2]int64]solveCorrelationResult)
+	for i := range teamIDs {
+		for j := i + 1; j < len(teamIDs); j++ {
+			result, ok := scoreSolveCorrelation(teamSolves[teamIDs[i]], teamSolves[teamIDs[j]], solveCount, config)
+			if ok && result.Score >= config.Threshold {
+				findings[[2]int64{teamIDs[i], teamIDs[j]}] = result
+			}
+		}
+	}
+
+	if len(findings) == 0 {
+		return nil
+	}
+
+	return saveSolveCorrelationCheats(gameID, teamMap, findings)
+}
+
+// 计算两个队伍解题记录的相似度
+// 时间相近程度: 每道共同解出的题按 1 - 间隔/窗口 计分, 解出人数越少的题权重越高
+// 顺序相似程度: 共同解出的题目按解题时间排序后的 Kendall tau, 归一化到 0 到 1
+// 最终相似度 = 时间相近程度 * (0.5 + 0.5 * 顺序相似程度)
+func scoreSolveCorrelation(solvesA, solvesB map[int64]models.Solve, solveCount map[int64]int, config solveCorrelationConfig) (solveCorrelationResult, bool) {
+	result := solveCorrelationResult{}
+
+	common := make([]int64, 0)
+	for ingameID := range solvesA {
+		if _, ok := solvesB[ingameID]; ok {
+			common = append(common, ingameID)
+		}
+	}
+	if len(common) < config.MinCloseSolves {
+		return result, false
+	}
+
+	var weightedCloseness, totalWeight float64
+	for _, ingameID := range common {
+		solveA, solveB := solvesA[ingameID], solvesB[ingameID]
+		gap := math.Abs(solveA.SolveTime.Sub(solveB.SolveTime).Seconds())
+		weight := 1 / float64(solveCount[ingameID])
+
+		totalWeight += weight
+		if gap > config.SolveGap.Seconds() {
+			continue
+		}
+
+		weightedCloseness += weight * (1 - gap/config.SolveGap.Seconds())
+		result.Solves = append(result.Solves, models.CheatSolveEvidence{
+			ChallengeID:       solveA.ChallengeID,
+			ChallengeName:     solveA.Challenge.Name,
+			SolveTime:         solveA.SolveTime,
+			RelevantSolveTime: solveB.SolveTime,
+			GapSeconds:        gap,
+		})
+
+		if solveA.SolveTime.After(result.LastSolveA.SolveTime) {
+			result.LastSolveA = solveA
+		}
+		if solveB.SolveTime.After(result.LastSolveB.SolveTime) {
+			result.LastSolveB = solveB
+		}
+	}
+
+	if len(result.Solves) < config.MinCloseSolves || totalWeight == 0 {
+		return result, false
+	}
+
+	// 按队伍 A 的解题时间排序, 统计队伍 B 中顺序一致的题目对
+	sort.Slice(common, func(i, j int) bool {
+		return solvesA[common[i]].SolveTime.Before(solvesA[common[j]].SolveTime)
+	})
+	var concordant, pairs int
+	for i := range common {
+		for j := i + 1; j < len(common); j++ {
+			pairs++
+			if !solvesB[common[i]].SolveTime.After(solvesB[common[j]].SolveTime) {
+				concordant++
+			}
+		}
+	}
+	orderSimilarity := 1.0
+	if pairs > 0 {
+		orderSimilarity = float64(concordant) / float64(pairs)
+	}
+
+	sort.Slice(result.Solves, func(i, j int) bool {
+		return result.Solves[i].SolveTime.Before(result.Solves[j].SolveTime)
+	})
+	result.Score = math.Round(weightedCloseness/totalWeight*(0.5+0.5*orderSimilarity)*1000) / 1000
+	return result, true
+}
+
+// 每个可疑的队伍对给双方各写一条作弊记录, 已经存在的记录在证据变化时更新
+func saveSolveCorrelationCheats(gameID int64, teamMap map[int64]models.Team, findings map[[2]int64]solveCorrelationResult) error {
+	var existingCheats []models.Cheat
+	if err := dbtool.DB().Where("game_id = ? AND cheat_type = ?", gameID, models.CheatType(models.CheatSolveTimingCorrelation)).
+		Find(&existingCheats).Error; err != nil {
+		return fmt.Errorf("failed to load existing cheats: %w", err)
+	}
+
+	existing := make(map[[2]int64]models.Cheat, len(existingCheats))
+	for _, cheat := range existingCheats {
+		existing[[2]int64{cheat.TeamID, cheat.ExtraData.RelevantTeam}] = cheat
+	}
+
+	newCheats := make([]models.Cheat, 0)
+	for pair, result := range findings {
+		sides := []struct {
+			TeamID       int64
+			RelevantTeam int64
+			LastSolve    models.Solve
+			Solves       []models.CheatSolveEvidence
+		}{
+			{pair[0], pair[1], result.LastSolveA, result.Solves},
+			{pair[1], pair[0], result.LastSolveB, swapSolveEvidence(result.Solves)},
+		}
+
+		for _, side := range sides {
+			extraData := models.CheatExtraData{
+				RelevantTeam:     side.RelevantTeam,
+				RelevantTeamName: teamMap[side.RelevantTeam].TeamName,
+				Reason:           "Solve order and solve times are highly similar to another team",
+				CorrelationScore: result.Score,
+				Solves:           side.Solves,
+			}
+
+			if cheat, ok := existing[[2]int64{side.TeamID, side.RelevantTeam}]; ok {
+				if cheat.ExtraData.CorrelationScore == result.Score && len(cheat.ExtraData.Solves) == len(side.Solves) {
+					continue
+				}
+				if err := dbtool.DB().Model(&models.Cheat{}).Where("cheat_id = ?", cheat.CheatID).Updates(map[string]interface{}{
+					"extra_data": extraData,
+					"cheat_time": side.LastSolve.SolveTime,
+				}).Error; err != nil {
+					zaphelper.Logger.Error("Failed to update solve correlation cheat", zap.Error(err), zap.String("cheat_id", cheat.CheatID))
+				}
+				continue
+			}
+
+			judgeID := side.LastSolve.JudgeID
+			newCheats = append(newCheats, models.Cheat{
+				CheatID:    uuid.NewString(),
+				CheatType:  models.CheatSolveTimingCorrelation,
+				GameID:     gameID,
+				TeamID:     side.TeamID,
+				JudgeID:    &judgeID,
+				SubmiterID: side.LastSolve.SolverID,
+				CheatTime:  side.LastSolve.SolveTime,
+				ExtraData:  extraData,
+			})
+		}
+	}
+
+	if len(newCheats) == 0 {
+		return nil
+	}
+
+	if err := dbtool.DB().CreateInBatches(&newCheats, 100).Error; err != nil {
+		return fmt.Errorf("failed to save solve correlation cheats: %w", err)
+	}
+
+	zaphelper.Logger.Info("Solve correlation found suspicious teams", zap.Int64("game_id", gameID), zap.Int("cheats", len(newCheats)))
+	return nil
+}
+
+// 站在另一个队伍的角度交换两边的解题时间
+func swapSolveEvidence(solves []models.CheatSolveEvidence) []models.CheatSolveEvidence {
+	swapped := make([]models.CheatSolveEvidence, 0, len(solves))
+	for _, solve := range solves {
+		solve.SolveTime, solve.RelevantSolveTime = solve.RelevantSolveTime, solve.SolveTime
+		swapped = append(swapped, solve)
+	}
+	sort.Slice(swapped, func(i, j int) bool {
+		return swapped[i].SolveTime.Before(swapped[j].SolveTime)
+	})
+	return swapped
+}
@@ -0,0 +1,221 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	containerbackend "a1ctf/src/modules/container_backend"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	"fmt"
+	"sync"
+	"time"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// OrphanInstance 后端中存在但是数据库中没有存活记录的实例
+type OrphanInstance struct {
+	Name      string    `json:"name"`
+	TeamHash  string    `json:"team_hash"`
+	InGameID  int64     `json:"ingame_id"`
+	FirstSeen time.Time `json:"first_seen"`
+	Deletable bool      `json:"deletable"`
+}
+
+// VanishedContainer 数据库中是运行状态但是后端中已经不存在的容器
+type VanishedContainer struct {
+	ContainerID   string    `json:"container_id"`
+	ChallengeName string    `json:"challenge_name"`
+	TeamHash      string    `json:"team_hash"`
+	InGameID      int64     `json:"ingame_id"`
+	FirstSeen     time.Time `json:"first_seen"`
+	Deletable     bool      `json:"deletable"`
+}
+
+type ContainerGCReport struct {
+	GracePeriod        string              `json:"grace_period"`
+	OrphanInstances    []OrphanInstance    `json:"orphan_instances"`
+	VanishedContainers []VanishedContainer `json:"vanished_containers"`
+}
+
+// 第一次发现异常的时间, 持续超过宽限期才处理
+// 刚标记为停止的容器还在等待删除任务, 刚启动的容器后端可能还没有同步, 都需要宽限期
+var (
+	gcMutex           sync.Mutex
+	orphanFirstSeen   = make(map[string]time.Time)
+	vanishedFirstSeen = make(map[string]time.Time)
+)
+
+func getGCGracePeriod() time.Duration {
+	gracePeriod := viper.GetDuration("container-gc.grace-period")
+	if gracePeriod <= 0 {
+		gracePeriod = 5 * time.Minute
+	}
+	return gracePeriod
+}
+
+// 一次扫描的结果, 只有 ContainerGCJob 会把第一次发现的时间写回 orphanFirstSeen 和 vanishedFirstSeen
+type containerGCScan struct {
+	report             *ContainerGCReport
+	vanishedContainers []models.Container
+	orphanFirstSeen    map[string]time.Time
+	vanishedFirstSeen  map[string]time.Time
+}
+
+// 找出异常的实例和容器, 不修改第一次发现的时间
+func scanContainerGarbage(now time.Time) (*containerGCScan, error) {
+	gracePeriod := getGCGracePeriod()
+
+	var containers []models.Container
+	if err := dbtool.DB().Where("container_status NOT IN ?", []models.ContainerStatus{models.ContainerError, models.ContainerStopped}).
+		Preload("Challenge").Preload("TeamFlag").Find(&containers).Error; err != nil {
+		return nil, fmt.Errorf("failed to find living containers: %v", err)
+	}
+
+	instances, err := containerbackend.Backend.ListInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ContainerGCReport{
+		GracePeriod:        gracePeriod.String(),
+		OrphanInstances:    make([]OrphanInstance, 0),
+		VanishedContainers: make([]VanishedContainer, 0),
+	}
+
+	existingInstances := make(map[string]bool)
+	currentOrphans := make(map[string]time.Time)
+
+	for _, instance := range instances {
+		existingInstances[instance.Name] = true
+
+		if findExistContainer(containers, instance.TeamHash, instance.InGameID) != nil {
+			continue
+		}
+
+		firstSeen, ok := orphanFirstSeen[instance.Name]
+		if !ok {
+			firstSeen = now
+		}
+		currentOrphans[instance.Name] = firstSeen
+
+		report.OrphanInstances = append(report.OrphanInstances, OrphanInstance{
+			Name:      instance.Name,
+			TeamHash:  instance.TeamHash,
+			InGameID:  instance.InGameID,
+			FirstSeen: firstSeen,
+			Deletable: now.Sub(firstSeen) >= gracePeriod,
+		})
+	}
+
+	currentVanished := make(map[string]time.Time)
+	vanishedContainers := make([]models.Container, 0)
+
+	for _, container := range containers {
+		if container.ContainerStatus != models.ContainerRunning {
+			continue
+		}
+
+		if existingInstances[containerbackend.InstanceName(container.InGameID, container.TeamHash)] {
+			continue
+		}
+
+		firstSeen, ok := vanishedFirstSeen[container.ContainerID]
+		if !ok {
+			firstSeen = now
+		}
+		currentVanished[container.ContainerID] = firstSeen
+
+		deletable := now.Sub(firstSeen) >= gracePeriod
+		if deletable {
+			vanishedContainers = append(vanishedContainers, container)
+		}
+
+		report.VanishedContainers = append(report.VanishedContainers, VanishedContainer{
+			ContainerID:   container.ContainerID,
+			ChallengeName: container.ChallengeName,
+			TeamHash:      container.TeamHash,
+			InGameID:      container.InGameID,
+			FirstSeen:     firstSeen,
+			Deletable:     deletable,
+		})
+	}
+
+	return &containerGCScan{
+		report:             report,
+		vanishedContainers: vanishedContainers,
+		orphanFirstSeen:    currentOrphans,
+		vanishedFirstSeen:  currentVanished,
+	}, nil
+}
+
+// PreviewContainerGC 只返回将要清理的实例和容器, 不做任何修改
+func PreviewContainerGC() (*ContainerGCReport, error) {
+	gcMutex.Lock()
+	defer gcMutex.Unlock()
+
+	scan, err := scanContainerGarbage(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scan.report, nil
+}
+
+// ContainerGCJob 清理超过宽限期的孤儿实例, 以及后端中已经消失的运行中容器
+func ContainerGCJob() {
+	gcMutex.Lock()
+	defer gcMutex.Unlock()
+
+	scan, err := scanContainerGarbage(time.Now().UTC())
+	if err != nil {
+		zaphelper.Logger.Error("Failed to scan container garbage", zap.Error(err))
+		return
+	}
+
+	// 已经恢复正常的不再跟踪
+	orphanFirstSeen = scan.orphanFirstSeen
+	vanishedFirstSeen = scan.vanishedFirstSeen
+
+	for _, orphan := range scan.report.OrphanInstances {
+		if !orphan.Deletable {
+			continue
+		}
+
+		zaphelper.Logger.Info("Deleting orphan container", zap.Any("instance", orphan))
+		if err := containerbackend.Backend.ForceDeleteInstance(orphan.Name); err != nil {
+			zaphelper.Logger.Error("Failed to delete orphan container", zap.Error(err), zap.Any("instance", orphan))
+			continue
+		}
+		delete(orphanFirstSeen, orphan.Name)
+	}
+
+	for _, container := range scan.vanishedContainers {
+		zaphelper.Logger.Info("Cleaning vanished container", zap.Any("container", container))
+
+		// 清理可能残留的网络 / Service 等附属资源
+		containerInfo := containerbackend.NewInstanceInfo(&container)
+		if err := containerbackend.Backend.DeleteInstance(containerInfo); err != nil {
+			zaphelper.Logger.Error("Failed to delete vanished container", zap.Error(err), zap.Any("container", container))
+			continue
+		}
+
+		if err := dbtool.DB().Model(&container).Updates(map[string]interface{}{
+			"container_status": models.ContainerError,
+			"allocated_ports":  make(models.AllocatedPorts, 0),
+		}).Error; err != nil {
+			zaphelper.Logger.Error("failed to update container status", zap.Error(err), zap.Any("container", container))
+			continue
+		}
+		delete(vanishedFirstSeen, container.ContainerID)
+
+		tasks.LogContainerOperation(nil, nil, models.ActionContainerFailed, container.ContainerID, map[string]interface{}{
+			"team_hash":      container.TeamHash,
+			"ingame_id":      container.InGameID,
+			"container_name": containerInfo.Name,
+			"container_id":   container.ContainerID,
+			"reason":         "container vanished from backend",
+		}, fmt.Errorf("container vanished"))
+	}
+}
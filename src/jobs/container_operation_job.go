@@ -2,18 +2,17 @@ package jobs
 
 import (
 	"a1ctf/src/db/models"
+	containerbackend "a1ctf/src/modules/container_backend"
+	trafficgateway "a1ctf/src/modules/traffic_gateway"
 	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
-	dockertool "a1ctf/src/utils/docker_tool"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
 	"a1ctf/src/utils/zaphelper"
 
 	"go.uber.org/zap"
-	"github.com/docker/docker/api/types"
 )
 
 func findExistContainer(containers []models.Container, teamHash string, inGameID int64) *models.Container {
@@ -25,42 +24,44 @@ func findExistContainer(containers []models.Container, teamHash string, inGameID
 	return nil
 }
 
-func findExistDockerContainer(containers []types.Container, teamHash string, inGameID int64) *types.Container {
-	for _, container := range containers {
-		if container.Labels["a1ctf.team_hash"] == teamHash && 
-		   container.Labels["a1ctf.ingame_id"] == fmt.Sprintf("%d", inGameID) {
-			return &container
-		}
-	}
-	return nil
-}
-
-func getContainerPorts(containerInfo dockertool.ContainerInfo, task *models.Container) error {
-	ports, err := dockertool.GetContainerPorts(&containerInfo)
+func getContainerPorts(containerInfo *containerbackend.InstanceInfo, task *models.Container) error {
+	ports, err := containerbackend.Backend.GetInstancePorts(containerInfo)
 	if err != nil {
 		return fmt.Errorf("getContainerPorts error: %w", err)
 	} else {
-		for index, container := range task.ContainerConfig {
-			for _, expose_port := range container.ExposePorts {
-				port_name := fmt.Sprintf("%d-%s", index, expose_port.Name)
+		task.ContainerExposeInfos = make(models.ContainerExposeInfos, 0)
+
+		// WEB 题目通过子域名访问
+		useHostname := task.Challenge.Category == models.CategoryWEB && trafficgateway.WebDomain() != ""
 
-				expose_ports := make([]models.ExposePort, 0)
+		for _, container := range task.ContainerConfig {
+			expose_ports := make([]models.ExposePort, 0)
 
-				for _, port := range *ports {
-					if port.Name == port_name || port.Name == fmt.Sprintf("%d/tcp", expose_port.Port) {
-						expose_ports = append(expose_ports, models.ExposePort{
+			for _, expose_port := range container.ExposePorts {
+				for _, port := range ports {
+					if port.ContainerName == container.Name && port.PortName == expose_port.Name {
+						exposePort := models.ExposePort{
 							PortName: expose_port.Name,
 							Port:     port.HostPort,
-							IP:       "localhost", // For Docker, we use localhost since it's single machine
-						})
+							IP:       port.Host,
+						}
+
+						if useHostname {
+							exposePort.Hostname, err = trafficgateway.NewInstanceHostname()
+							if err != nil {
+								return fmt.Errorf("getContainerPorts error: %w", err)
+							}
+						}
+
+						expose_ports = append(expose_ports, exposePort)
 					}
 				}
-
-				task.ContainerExposeInfos = append(task.ContainerExposeInfos, models.ContainerExposeInfo{
-					ContainerName: container.Name,
-					ExposePorts:   expose_ports,
-				})
 			}
+
+			task.ContainerExposeInfos = append(task.ContainerExposeInfos, models.ContainerExposeInfo{
+				ContainerName: container.Name,
+				ExposePorts:   expose_ports,
+			})
 		}
 
 		if err := dbtool.DB().Model(&task).Updates(map[string]interface{}{
@@ -81,8 +82,8 @@ func getContainerPorts(containerInfo dockertool.ContainerInfo, task *models.Cont
 	return nil
 }
 
-func deleteRunningContainer(containerInfo dockertool.ContainerInfo, task *models.Container) error {
-	err := dockertool.DeleteContainer(&containerInfo)
+func deleteRunningContainer(containerInfo *containerbackend.InstanceInfo, task *models.Container) error {
+	err := containerbackend.Backend.DeleteInstance(containerInfo)
 	if err != nil {
 		tasks.LogContainerOperation(nil, nil, models.ActionContainerStopping, task.ContainerID, map[string]interface{}{
 			"team_hash":      task.TeamHash,
@@ -94,6 +95,7 @@ func deleteRunningContainer(containerInfo dockertool.ContainerInfo, task *models
 	} else {
 		if err := dbtool.DB().Model(&task).Updates(map[string]interface{}{
 			"container_status": models.ContainerStopped,
+			"allocated_ports":  make(models.AllocatedPorts, 0),
 		}).Error; err != nil {
 			return fmt.Errorf("failed to update container status: %v", err)
 		}
@@ -109,82 +111,79 @@ func deleteRunningContainer(containerInfo dockertool.ContainerInfo, task *models
 	return nil
 }
 
-func UpdateLivingContainers() {
+// applyInstanceStatus 根据后端中实例的状态更新数据库中的容器
+func applyInstanceStatus(container *models.Container, containerStatus containerbackend.InstanceStatusDecision) {
+	containerInfo := containerbackend.NewInstanceInfo(container)
+	// zaphelper.Logger.Info("container status", zap.Any("containerStatus", containerStatus))
 
-	// log.Println("UpdateLivingContainers")
+	if containerStatus.Status == containerbackend.InstanceRunning {
+		if container.ContainerStatus == models.ContainerStarting {
+			// 如果远程服务器Container已经是Running状态，就获取端口并且更新数据库
+			zaphelper.Logger.Info("Getting container port", zap.Any("container", container))
+			getContainerPorts(containerInfo, container)
+		}
+
+		// 下面会处理
+		// if time.Now().UTC().After(container.ExpireTime) {
+		// 	// 如果远程服务器Container已经是Running状态，并且已经超时，就删除Container并且更新数据库
+		// 	zaphelper.Logger.Info("Stopping container for life over", zap.Any("container", container))
+		// 	tasks.NewContainerStopTask(*container)
+		// }
+
+		if container.ContainerStatus == models.ContainerStopped {
+			zaphelper.Logger.Info("Stopping deaded container", zap.Any("container", container))
+			tasks.NewContainerStopTask(*container)
+		}
+	} else if containerStatus.Status == containerbackend.InstanceFailed {
+		zaphelper.Logger.Info("Stopping failed container", zap.Any("container", container), zap.Any("container_status", containerStatus))
+		tasks.NewContainerFailedTask(*container, containerStatus)
+	} else {
+		// 等待中的容器
+	}
+}
 
+// ReconcileContainers 对比后端中的实例和数据库, 事件丢失时的兜底, 间隔可以很长
+func ReconcileContainers() {
 	var containers []models.Container
 	if err := dbtool.DB().Where("container_status != ? AND container_status != ?", models.ContainerError, models.ContainerStopped).Preload("Challenge").Preload("TeamFlag").Find(&containers).Error; err != nil {
-		log.Fatalf("Failed to find queued containers: %v\n", err)
+		zaphelper.Logger.Error("Failed to find living containers", zap.Error(err))
+		return
 	}
 
-	dockerContainerList, err := dockertool.ListContainers()
+	instances, err := containerbackend.Backend.ListInstances()
 	if err != nil {
 		zaphelper.Logger.Error("Failed to list containers", zap.Error(err))
 		return
 	}
 
-	for _, dockerContainer := range dockerContainerList {
-		containerLabels := dockerContainer.Labels
-		teamHash, exists1 := containerLabels["a1ctf.team_hash"]
-		inGameID, exists2 := containerLabels["a1ctf.ingame_id"]
-
-		if !exists1 || !exists2 {
-			continue
-		}
-
-		inGameIDInt, err := strconv.ParseInt(inGameID, 10, 64)
-		if err != nil {
-			continue
-		}
-
-		container := findExistContainer(containers, teamHash, inGameIDInt)
+	for _, instance := range instances {
+		container := findExistContainer(containers, instance.TeamHash, instance.InGameID)
 		if container == nil {
-			// zaphelper.Logger.Info("Stopping container that not found in database", zap.Any("container", container))
-			// dockertool.ForceDeleteContainer(dockerContainer.Names[0])
+			// 数据库中不存在的实例由 ContainerGCJob 在宽限期后清理
 			continue
 		}
 
-		containerInfo := dockertool.ContainerInfo{
-			Name:       fmt.Sprintf("cl-%d-%s", container.InGameID, container.TeamHash),
-			TeamHash:   container.TeamHash,
-			Containers: container.ContainerConfig,
-			Labels: map[string]string{
-				"team_hash": container.TeamHash,
-				"ingame_id": fmt.Sprintf("%d", container.InGameID),
-			},
-			Flag:     container.TeamFlag.FlagContent,
-			AllowWAN: container.Challenge.AllowWAN,
-			AllowDNS: container.Challenge.AllowDNS,
-		}
+		applyInstanceStatus(container, instance.Status)
+	}
+}
 
-		containerStatus, _ := dockertool.CheckContainerStatus(&dockerContainer)
-		// zaphelper.Logger.Info("container status", zap.Any("containerStatus", containerStatus))
+// UpdateLivingContainers 处理数据库中需要操作的容器, 实例状态的变化由 WatchContainerEvents 处理
+func UpdateLivingContainers() {
 
-		if containerStatus.Status == dockertool.CustomContainerRunning {
-			if container.ContainerStatus == models.ContainerStarting {
-				// 如果远程服务器Container已经是Running状态，就获取端口并且更新数据库
-				zaphelper.Logger.Info("Getting container port", zap.Any("container", container))
-				getContainerPorts(containerInfo, container)
-			}
+	// log.Println("UpdateLivingContainers")
 
-			// 下面会处理
-			// if time.Now().UTC().After(container.ExpireTime) {
-			// 	// 如果远程服务器Container已经是Running状态，并且已经超时，就删除Container并且更新数据库
-			// 	zaphelper.Logger.Info("Stopping container for life over", zap.Any("container", container))
-			// 	tasks.NewContainerStopTask(*container)
-			// }
+	now := time.Now().UTC()
 
-			if container.ContainerStatus == models.ContainerStopped {
-				zaphelper.Logger.Info("Stopping deaded container", zap.Any("container", container))
-				tasks.NewContainerStopTask(*container)
-			}
-		} else if containerStatus.Status == dockertool.CustomContainerFailed {
-			zaphelper.Logger.Info("Stopping failed container", zap.Any("container", container), zap.Any("container_status", containerStatus))
-			tasks.NewContainerFailedTask(*container, containerStatus)
-		} else {
-			// 等待中的容器
-		}
+	// 只查询需要处理的容器: 排队中, 要求关闭, 到期, 启动超时
+	var containers []models.Container
+	if err := dbtool.DB().Where("container_status NOT IN ?", []models.ContainerStatus{models.ContainerError, models.ContainerStopped}).
+		Where("container_status IN ? OR expire_time < ? OR (container_status = ? AND start_time < ?)",
+			[]models.ContainerStatus{models.ContainerQueueing, models.ContainerStopping},
+			now,
+			models.ContainerStarting,
+			now.Add(-10*time.Minute),
+		).Preload("Challenge").Preload("TeamFlag").Find(&containers).Error; err != nil {
+		log.Fatalf("Failed to find queued containers: %v\n", err)
 	}
 
 	for _, container := range containers {
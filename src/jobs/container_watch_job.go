@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	containerbackend "a1ctf/src/modules/container_backend"
+	dbtool "a1ctf/src/utils/db_tool"
+	"context"
+	"errors"
+	"time"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"go.uber.org/zap"
+)
+
+// 事件流断开后重新订阅的间隔
+const containerWatchRetryInterval = 5 * time.Second
+
+// StartContainerWatcher 订阅后端的实例事件并实时更新容器状态, 断开后自动重连
+func StartContainerWatcher(ctx context.Context) {
+	go func() {
+		for {
+			// 订阅之前的事件可能已经丢失, 先对账一次
+			ReconcileContainers()
+
+			err := containerbackend.Backend.WatchInstances(ctx, handleInstanceEvent)
+			if ctx.Err() != nil {
+				return
+			}
+
+			zaphelper.Logger.Warn("Container watcher disconnected", zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(containerWatchRetryInterval):
+			}
+		}
+	}()
+}
+
+func handleInstanceEvent(event containerbackend.InstanceEvent) {
+	var container models.Container
+	if err := dbtool.DB().Where("team_hash = ? AND ingame_id = ? AND container_status NOT IN ?",
+		event.TeamHash, event.InGameID, []models.ContainerStatus{models.ContainerError, models.ContainerStopped}).
+		Preload("Challenge").Preload("TeamFlag").First(&container).Error; err != nil {
+		// 数据库中没有对应的容器, 交给对账处理
+		return
+	}
+
+	containerStatus, err := containerbackend.Backend.GetInstanceStatus(containerbackend.NewInstanceInfo(&container))
+	if err != nil {
+		if !errors.Is(err, containerbackend.ErrInstanceNotFound) {
+			zaphelper.Logger.Error("Failed to get container status", zap.Error(err), zap.Any("event", event))
+		}
+		return
+	}
+
+	applyInstanceStatus(&container, containerStatus)
+}
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	noticetool "a1ctf/src/utils/notice_tool"
+	"a1ctf/src/utils/zaphelper"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ScheduledReleaseJob 发布到期的题目和提示
+// 发布计划保存在数据库里, 发布后清空, 服务重启期间错过的发布会在下一次运行时补上
+func ScheduledReleaseJob() {
+	now := time.Now().UTC()
+
+	var games []models.Game
+	if err := dbtool.DB().Where("end_time > ?", now).Find(&games).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load games for scheduled release", zap.Error(err))
+		return
+	}
+
+	for _, game := range games {
+		releaseGameSchedules(game, now)
+	}
+}
+
+func releaseGameSchedules(game models.Game, now time.Time) {
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Where("game_id = ?", game.GameID).Preload("Challenge").Find(&gameChallenges).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load game challenges for scheduled release", zap.Error(err), zap.Int64("game_id", game.GameID))
+		return
+	}
+
+	// 比赛和每道题最后一次被解出的时间, 用来计算多久没有队伍解题
+	var solves []models.Solve
+	if err := dbtool.DB().Select("ingame_id", "solve_time").
+		Where("game_id = ? AND solve_status = ? AND solve_time BETWEEN ? AND ?", game.GameID, models.SolveCorrect, game.StartTime, game.EndTime).
+		Find(&solves).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load solves for scheduled release", zap.Error(err), zap.Int64("game_id", game.GameID))
+		return
+	}
+
+	lastGameSolve := game.StartTime
+	lastChallengeSolve := make(map[int64]time.Time)
+	for _, solve := range solves {
+		if solve.SolveTime.After(lastGameSolve) {
+			lastGameSolve = solve.SolveTime
+		}
+		if solve.SolveTime.After(lastChallengeSolve[solve.IngameID]) {
+			lastChallengeSolve[solve.IngameID] = solve.SolveTime
+		}
+	}
+
+	gameStarted := !now.Before(game.StartTime)
+	releasedChallenges := make([]string, 0)
+	releasedHints := make([]string, 0)
+
+	for _, gc := range gameChallenges {
+		if !gc.Visible && challengeReleaseDue(gc, gameStarted, lastGameSolve, now) {
+			// 只更新仍然不可见的题目, 避免覆盖管理员同时做的修改
+			result := dbtool.DB().Model(&models.GameChallenge{}).
+				Where("ingame_id = ? AND visible = ?", gc.IngameID, false).
+				Updates(map[string]interface{}{
+					"visible":                true,
+					"visible_time":           now,
+					"release_time":           nil,
+					"release_after_no_solve": nil,
+				})
+			if result.Error != nil {
+				zaphelper.Logger.Error("Failed to release challenge", zap.Error(result.Error), zap.Int64("ingame_id", gc.IngameID))
+				continue
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			gc.Visible = true
+			gc.VisibleTime = &now
+			releasedChallenges = append(releasedChallenges, gc.Challenge.Name)
+			zaphelper.Logger.Info("Scheduled challenge released", zap.Int64("game_id", game.GameID), zap.Int64("ingame_id", gc.IngameID))
+		}
+
+		if !gc.Visible || gc.Hints == nil {
+			continue
+		}
+
+		// 题目开放后多久没有队伍解出, 从比赛开始、题目公开和最后一次解出中最晚的时间算起
+		idleSince := game.StartTime
+		if gc.VisibleTime != nil && gc.VisibleTime.After(idleSince) {
+			idleSince = *gc.VisibleTime
+		}
+		if lastSolve, ok := lastChallengeSolve[gc.IngameID]; ok && lastSolve.After(idleSince) {
+			idleSince = lastSolve
+		}
+
+		oldHints := *gc.Hints
+		newHints := make(models.Hints, len(oldHints))
+		copy(newHints, oldHints)
+
+		hintReleased := false
+		for idx, hint := range newHints {
+			if hint.Visible || !hint.ScheduledRelease() {
+				continue
+			}
+			if !hintReleaseDue(hint, gameStarted, idleSince, now) {
+				continue
+			}
+
+			newHints[idx].Visible = true
+			newHints[idx].CreateTime = now
+			newHints[idx].ReleaseTime = nil
+			newHints[idx].ReleaseAfterNoSolve = 0
+			hintReleased = true
+		}
+
+		if !hintReleased {
+			continue
+		}
+
+		// 提示在读取之后被管理员修改过时放弃这次发布, 下次运行再处理
+		result := dbtool.DB().Model(&models.GameChallenge{}).
+			Where("ingame_id = ? AND hints = ?", gc.IngameID, oldHints).
+			Update("hints", newHints)
+		if result.Error != nil {
+			zaphelper.Logger.Error("Failed to release hints", zap.Error(result.Error), zap.Int64("ingame_id", gc.IngameID))
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		releasedHints = append(releasedHints, gc.Challenge.Name)
+		zaphelper.Logger.Info("Scheduled hints released", zap.Int64("game_id", game.GameID), zap.Int64("ingame_id", gc.IngameID))
+	}
+
+	if len(releasedChallenges) > 0 {
+		noticetool.InsertNotice(game.GameID, models.NoticeNewChallenge, releasedChallenges)
+	}
+	if len(releasedHints) > 0 {
+		noticetool.InsertNotice(game.GameID, models.NoticeNewHint, releasedHints)
+	}
+}
+
+// 到达发布时间, 或者比赛开始后持续 N 分钟没有任何队伍解题
+func challengeReleaseDue(gc models.GameChallenge, gameStarted bool, lastGameSolve time.Time, now time.Time) bool {
+	if gc.ReleaseTime != nil && !now.Before(*gc.ReleaseTime) {
+		return true
+	}
+	if gameStarted && gc.ReleaseAfterNoSolve != nil && *gc.ReleaseAfterNoSolve > 0 {
+		return now.Sub(lastGameSolve) >= time.Duration(*gc.ReleaseAfterNoSolve)*time.Minute
+	}
+	return false
+}
+
+// 到达发布时间, 或者题目持续 N 分钟没有队伍解出
+func hintReleaseDue(hint models.Hint, gameStarted bool, idleSince time.Time, now time.Time) bool {
+	if hint.ReleaseTime != nil && !now.Before(*hint.ReleaseTime) {
+		return true
+	}
+	if gameStarted && hint.ReleaseAfterNoSolve > 0 {
+		return now.Sub(idleSince) >= time.Duration(hint.ReleaseAfterNoSolve)*time.Minute
+	}
+	return false
+}
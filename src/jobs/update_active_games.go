@@ -4,6 +4,7 @@ import (
 	"a1ctf/src/db/models"
 	dbtool "a1ctf/src/utils/db_tool"
 	"a1ctf/src/utils/ristretto_tool"
+	scoringtool "a1ctf/src/utils/scoring_tool"
 	"a1ctf/src/utils/zaphelper"
 	"math"
 	"time"
@@ -40,6 +41,17 @@ func updateActiveGameScores(game_ids []int64) {
 		}
 	}
 
+	// 5. 查询游戏信息（用于计分方式和血奖计算）
+	var games []models.Game
+	if err := dbtool.DB().Where("game_id IN ?", game_ids).Find(&games).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load games", zap.Error(err))
+		return
+	}
+	gameMap := make(map[int64]models.Game)
+	for _, game := range games {
+		gameMap[game.GameID] = game
+	}
+
 	// 4. 更新每道题的解题人数和分数（只更新有变化的）
 	var challengesToUpdate []models.GameChallenge
 	gameChallengeMap := make(map[int64]models.GameChallenge)
@@ -51,15 +63,12 @@ func updateActiveGameScores(game_ids []int64) {
 		gc.SolveCount = solveCount
 
 		// 计算当前分数
-		var newCurScore float64
-		if solveCount == 0 {
-			newCurScore = gc.TotalScore
-		} else {
-			// 动态分数计算公式
-			minRatio := gc.MinimalScore / gc.TotalScore
-			dynamicRatio := (1 - minRatio) * math.Exp((1-float64(solveCount))/gc.Difficulty)
-			newCurScore = math.Floor(gc.TotalScore * (minRatio + dynamicRatio))
-		}
+		game := gameMap[gc.GameID]
+		newCurScore := scoringtool.Score(scoringtool.Resolve(&game, &gc), scoringtool.ScoreParams{
+			TotalScore:   gc.TotalScore,
+			MinimalScore: gc.MinimalScore,
+			Difficulty:   gc.Difficulty,
+		}, solveCount)
 		gc.CurScore = newCurScore
 
 		gameChallengeMap[gc.IngameID] = gc
@@ -79,17 +88,6 @@ func updateActiveGameScores(game_ids []int64) {
 		}
 	}
 
-	// 5. 查询游戏信息（用于血奖计算）
-	var games []models.Game
-	if err := dbtool.DB().Where("game_id IN ?", game_ids).Find(&games).Error; err != nil {
-		zaphelper.Logger.Error("Failed to load games", zap.Error(err))
-		return
-	}
-	gameMap := make(map[int64]models.Game)
-	for _, game := range games {
-		gameMap[game.GameID] = game
-	}
-
 	// 6. 查询分数调整记录
 	var adjustments []models.ScoreAdjustment
 	if err := dbtool.DB().Where("game_id IN ?", game_ids).Find(&adjustments).Error; err != nil {
@@ -139,7 +137,33 @@ func updateActiveGameScores(game_ids []int64) {
 		}
 	}
 
-	// 7.3 计算分数调整
+	// 7.3 计算多段 flag 题目的部分分数
+	subFlagCredits, err := ristretto_tool.LoadSubFlagCredits(game_ids)
+	if err != nil {
+		zaphelper.Logger.Error("Failed to load sub flag credits", zap.Error(err))
+		return
+	}
+
+	for _, credit := range subFlagCredits {
+		if gc, exists := gameChallengeMap[credit.IngameID]; exists && gc.Visible {
+			teamScores[credit.TeamID] += credit.Score(gc)
+		}
+	}
+
+	// 7.4 扣除解锁提示的分数
+	hintUnlocks, err := ristretto_tool.LoadHintUnlocks(game_ids)
+	if err != nil {
+		zaphelper.Logger.Error("Failed to load hint unlocks", zap.Error(err))
+		return
+	}
+
+	for _, unlock := range hintUnlocks {
+		if gc, exists := gameChallengeMap[unlock.IngameID]; exists && gc.Visible {
+			teamScores[unlock.TeamID] -= unlock.Cost
+		}
+	}
+
+	// 7.5 计算分数调整
 	for _, adj := range adjustments {
 		teamScores[adj.TeamID] += adj.ScoreChange
 	}
@@ -206,6 +230,37 @@ func UpdateActivateGameScore() {
 	updateActiveGameScores(game_ids)
 }
 
+// loadGameChallengeMap 加载比赛下的所有题目, ingame_id -> GameChallenge
+func loadGameChallengeMap(gameID int64) (map[int64]models.GameChallenge, error) {
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Where("game_id = ?", gameID).Find(&gameChallenges).Error; err != nil {
+		return nil, err
+	}
+
+	gameChallengeMap := make(map[int64]models.GameChallenge, len(gameChallenges))
+	for _, gc := range gameChallenges {
+		gameChallengeMap[gc.IngameID] = gc
+	}
+	return gameChallengeMap, nil
+}
+
+// addTeamScore 修改队伍在 teamMap 中的分数, 没有记录的队伍新建一条
+func addTeamScore(teamMap map[int64]models.ScoreBoardData, teamID int64, teamName string, score float64, curTime time.Time) {
+	if scoreBoardData, exists := teamMap[teamID]; exists {
+		scoreBoardData.Score += score
+		teamMap[teamID] = scoreBoardData
+		return
+	}
+
+	teamMap[teamID] = models.ScoreBoardData{
+		TeamName:             teamName,
+		SolvedChallenges:     make([]string, 0),
+		NewSolvedChallengeID: nil,
+		Score:                score,
+		RecordTime:           curTime,
+	}
+}
+
 // 更新比赛每个队伍的分数, 往 scoreboard 表里插入当前某个比赛每个队伍的分数(仅在分数变动时候)
 func UpdateActiveGameScoreBoard() {
 	var active_games []models.Game
@@ -224,15 +279,26 @@ func UpdateActiveGameScoreBoard() {
 		curTime := time.Now().UTC()
 
 		// 先获取比赛下的所有队伍
-		var teamsParticipated []models.Team = make([]models.Team, 0)
+		var teams []models.Team = make([]models.Team, 0)
 		var participatedTeamIDs []int64
-		if err := dbtool.DB().Where("game_id = ? AND team_type = ?", gameID, models.TeamTypePlayer).Find(&teamsParticipated).Error; err != nil {
+		if err := dbtool.DB().Where("game_id = ?", gameID).Find(&teams).Error; err != nil {
 			zaphelper.Logger.Error("Failed to load teams for game ", zap.Error(err), zap.Int64("game_id", gameID))
 			return
 		}
 
-		for _, team := range teamsParticipated {
-			participatedTeamIDs = append(participatedTeamIDs, team.TeamID)
+		teamNameMap := make(map[int64]string)
+		for _, team := range teams {
+			teamNameMap[team.TeamID] = team.TeamName
+			if team.TeamType == models.TeamTypePlayer {
+				participatedTeamIDs = append(participatedTeamIDs, team.TeamID)
+			}
+		}
+
+		// 比赛下的所有题目, 多段 flag 和提示都按这里的可见性计算
+		gameChallengeMap, err := loadGameChallengeMap(gameID)
+		if err != nil {
+			zaphelper.Logger.Error("Failed to load game challenges for game ", zap.Error(err), zap.Int64("game_id", gameID))
+			return
 		}
 
 		// 获取上述队伍的积分榜
@@ -331,6 +397,46 @@ func UpdateActiveGameScoreBoard() {
 			}
 		}
 
+		// 多段 flag 题目的部分分数
+		subFlagCredits, err := ristretto_tool.LoadSubFlagCredits([]int64{gameID})
+		if err != nil {
+			zaphelper.Logger.Error("Failed to load sub flag credits for game ", zap.Error(err), zap.Int64("game_id", gameID))
+			return
+		}
+
+		for _, credit := range subFlagCredits {
+			gc, exists := gameChallengeMap[credit.IngameID]
+			if !exists || !gc.Visible {
+				continue
+			}
+
+			teamName, exists := teamNameMap[credit.TeamID]
+			if !exists {
+				continue
+			}
+			addTeamScore(teamMap, credit.TeamID, teamName, credit.Score(gc), curTime)
+		}
+
+		// 解锁提示的扣分
+		hintUnlocks, err := ristretto_tool.LoadHintUnlocks([]int64{gameID})
+		if err != nil {
+			zaphelper.Logger.Error("Failed to load hint unlocks for game ", zap.Error(err), zap.Int64("game_id", gameID))
+			return
+		}
+
+		for _, unlock := range hintUnlocks {
+			gc, exists := gameChallengeMap[unlock.IngameID]
+			if !exists || !gc.Visible {
+				continue
+			}
+
+			teamName, exists := teamNameMap[unlock.TeamID]
+			if !exists {
+				continue
+			}
+			addTeamScore(teamMap, unlock.TeamID, teamName, -unlock.Cost, curTime)
+		}
+
 		// 加载分数修正
 		var adjustments []models.ScoreAdjustment
 		if err := dbtool.DB().Where("game_id = ?", gameID).Preload("Team").Find(&adjustments).Error; err != nil {
@@ -339,22 +445,7 @@ func UpdateActiveGameScoreBoard() {
 		}
 
 		for _, adjustment := range adjustments {
-			if scoreBoardData, exists := teamMap[adjustment.TeamID]; exists {
-				// 有解题记录，直接修正
-				scoreBoardData.Score += adjustment.ScoreChange
-				teamMap[adjustment.TeamID] = scoreBoardData
-			} else {
-				// 没解题记录，创建新的
-				solvedList := make([]string, 0)
-				scoreBoardData := models.ScoreBoardData{
-					TeamName:             adjustment.Team.TeamName,
-					SolvedChallenges:     solvedList,
-					NewSolvedChallengeID: nil,
-					Score:                adjustment.ScoreChange,
-					RecordTime:           curTime,
-				}
-				teamMap[adjustment.TeamID] = scoreBoardData
-			}
+			addTeamScore(teamMap, adjustment.TeamID, adjustment.Team.TeamName, adjustment.ScoreChange, curTime)
 		}
 
 		// 现在已经计算完成当前所有队伍的解题记录，只需要更新进 sql 就行了
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -15,14 +16,17 @@ import (
 	"a1ctf/src/db"
 	"a1ctf/src/jobs"
 	clientconfig "a1ctf/src/modules/client_config"
+	containerbackend "a1ctf/src/modules/container_backend"
 	jwtauth "a1ctf/src/modules/jwt_auth"
 	emailjwt "a1ctf/src/modules/jwt_email"
 	"a1ctf/src/modules/monitoring"
 	proofofwork "a1ctf/src/modules/proof_of_work"
+	trafficgateway "a1ctf/src/modules/traffic_gateway"
 	"a1ctf/src/tasks"
 	"a1ctf/src/utils"
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
 	ratelimiter "a1ctf/src/utils/rate_limiter"
 	redistool "a1ctf/src/utils/redis_tool"
 	"a1ctf/src/utils/ristretto_tool"
@@ -30,6 +34,7 @@ import (
 	"a1ctf/src/utils/zaphelper"
 	"a1ctf/src/webmodels"
 
+	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/go-co-op/gocron/v2"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -74,6 +79,37 @@ func StartLoopEvent() {
 		gocron.WithSingletonMode(gocron.LimitModeWait),
 	)
 
+	// 容器状态由事件驱动, 定时对账只是兜底
+	reconcileInterval := viper.GetDuration("job-intervals.container-reconcile")
+	if reconcileInterval <= 0 {
+		reconcileInterval = time.Minute
+	}
+
+	s.NewJob(
+		gocron.DurationJob(
+			reconcileInterval,
+		),
+		gocron.NewTask(
+			jobs.ReconcileContainers,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	)
+
+	gcInterval := viper.GetDuration("job-intervals.container-gc")
+	if gcInterval <= 0 {
+		gcInterval = time.Minute
+	}
+
+	s.NewJob(
+		gocron.DurationJob(
+			gcInterval,
+		),
+		gocron.NewTask(
+			jobs.ContainerGCJob,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	)
+
 	s.NewJob(
 		gocron.DurationJob(
 			viper.GetDuration("job-intervals.flag-judge"),
@@ -84,6 +120,57 @@ func StartLoopEvent() {
 		gocron.WithSingletonMode(gocron.LimitModeWait),
 	)
 
+	releaseInterval := viper.GetDuration("job-intervals.scheduled-release")
+	if releaseInterval <= 0 {
+		releaseInterval = 10 * time.Second
+	}
+
+	if _, err := s.NewJob(
+		gocron.DurationJob(
+			releaseInterval,
+		),
+		gocron.NewTask(
+			jobs.ScheduledReleaseJob,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	); err != nil {
+		zaphelper.Sugar.Errorf("Failed to schedule scheduled-release job: %v", err)
+	}
+
+	ipCorrelationInterval := viper.GetDuration("job-intervals.ip-correlation")
+	if ipCorrelationInterval <= 0 {
+		ipCorrelationInterval = time.Minute
+	}
+
+	if _, err := s.NewJob(
+		gocron.DurationJob(
+			ipCorrelationInterval,
+		),
+		gocron.NewTask(
+			jobs.IPCorrelationJob,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	); err != nil {
+		zaphelper.Sugar.Errorf("Failed to schedule ip-correlation job: %v", err)
+	}
+
+	solveCorrelationInterval := viper.GetDuration("job-intervals.solve-correlation")
+	if solveCorrelationInterval <= 0 {
+		solveCorrelationInterval = 2 * time.Minute
+	}
+
+	if _, err := s.NewJob(
+		gocron.DurationJob(
+			solveCorrelationInterval,
+		),
+		gocron.NewTask(
+			jobs.SolveCorrelationJob,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	); err != nil {
+		zaphelper.Sugar.Errorf("Failed to schedule solve-correlation job: %v", err)
+	}
+
 	s.NewJob(
 		gocron.DurationJob(
 			viper.GetDuration("job-intervals.update-game-scoreboard-cache"),
@@ -160,6 +247,14 @@ func main() {
 		defer systemMonitor.Stop()
 	}
 
+	// 初始化容器后端
+	containerbackend.InitBackend()
+
+	// SCRIPT 类型的评测沙箱只支持 Docker, 使用 k8s 后端时也需要能访问 Docker
+	if err := judgetool.CheckSandbox(); err != nil {
+		zaphelper.Sugar.Errorf("Judge sandbox is unavailable, SCRIPT challenges will fail to judge: %v", err)
+	}
+
 	// 初始化任务队列
 	tasks.InitTaskQueue()
 
@@ -186,6 +281,9 @@ func main() {
 		zaphelper.Sugar.Warn("No trusted proxies set, using default. If you are using a reverse proxy, please set the trusted proxies in the config file.")
 	}
 
+	// WEB 题目实例的子域名访问, 需要在其他路由之前处理
+	r.Use(trafficgateway.HTTPSubdomainMiddleware())
+
 	// pprof.Register(r)
 
 	// 启动 Gin 框架性能监控
@@ -241,6 +339,9 @@ func main() {
 		public.POST("/cap/redeem", controllers.CapRedeemChallenge)
 		public.POST("/cap/validate", controllers.CapValidateToken)
 
+		// 题目容器 TCP 网关, 使用网关令牌鉴权
+		public.GET("/gateway/tcp", trafficgateway.HandleTCPTunnel)
+
 		// 邮箱验证接口
 		public.POST("/account/verifyEmailCode", controllers.PayloadValidator(
 			webmodels.EmailVerifyPayload{},
@@ -371,9 +472,15 @@ func main() {
 			gameGroup.PUT("/:game_id/challenge/:challenge_id", controllers.PathParmsMiddlewareBuilder("G|GC"), controllers.AdminUpdateGameChallenge)
 			gameGroup.POST("/:game_id/challenge/:challenge_id", controllers.PathParmsMiddlewareBuilder("g|C"), controllers.AdminAddGameChallenge)
 			gameGroup.DELETE("/:game_id/challenge/:challenge_id", controllers.PathParmsMiddlewareBuilder("g|c"), controllers.AdminDeleteGameChallenge)
+			gameGroup.POST("/:game_id/challenge/:challenge_id/score-preview", controllers.PathParmsMiddlewareBuilder("G|GC"), controllers.AdminPreviewChallengeScore)
+			gameGroup.GET("/:game_id/challenge/:challenge_id/hints/unlocks", controllers.PathParmsMiddlewareBuilder("G|GC"), controllers.AdminGetChallengeHintUsage)
+
+			gameGroup.POST("/:game_id/stages/advance", controllers.PathParmsMiddlewareBuilder("G"), controllers.AdminAdvanceGameStage)
+			gameGroup.POST("/:game_id/scoreboard/reveal", controllers.PathParmsMiddlewareBuilder("G"), controllers.AdminRevealScoreboard)
 
 			gameGroup.POST("/:game_id/submits", controllers.AdminGetSubmits)
 			gameGroup.POST("/:game_id/cheats", controllers.AdminGetCheats)
+			gameGroup.PUT("/:game_id/cheats/:cheat_id/review", controllers.AdminReviewCheat)
 
 			// 比赛海报上传路由
 			gameGroup.POST("/:game_id/poster/upload", controllers.AdminUploadGamePoster)
@@ -416,6 +523,18 @@ func main() {
 				CheckGameStarted:  true,
 			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(true), controllers.UserGetGameChallenge)
 
+			// 下载题目附件，记录下载后跳转到附件地址
+			userGameGroup.GET("/:game_id/challenge/:challenge_id/attachment/:attach_index", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: false,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(true), controllers.UserDownloadGameAttachment)
+
+			// 解锁需要扣分或者罚时的提示
+			userGameGroup.POST("/:game_id/challenge/:challenge_id/hint/:hint_id/unlock", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: false,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(true), controllers.UserUnlockGameHint)
+
 			// 比赛通知接口
 			userGameGroup.GET("/:game_id/notices", cache.CacheByRequestURI(memoryStore, 1*time.Second), controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
 				VisibleAfterEnded: false,
@@ -451,6 +570,10 @@ func main() {
 				VisibleAfterEnded: false,
 				CheckGameStarted:  true,
 			}), controllers.TeamStatusMiddleware(), controllers.UserGetGameChallengeContainerInfo)
+			userGameGroup.POST("/:game_id/container/:challenge_id/gateway", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: false,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.UserGetContainerGatewayToken)
 
 			// 提交 Flag
 			userGameGroup.POST("/:game_id/flag/:challenge_id", ratelimiter.RateLimiter(100, 100*time.Millisecond), controllers.PayloadValidator(
@@ -474,10 +597,26 @@ func main() {
 				return
 			}
 
-			// 处理WebSocket连接
-			dbtool.Melody().HandleRequestWithKeys(c.Writer, c.Request, map[string]interface{}{
+			keys := map[string]interface{}{
 				"gameID": gameID,
-			})
+			}
+
+			// 记录连接所属的用户和队伍，判题结果之类的消息只推送给对应队伍
+			claims := jwt.ExtractClaims(c)
+			if userID, ok := claims["UserID"].(string); ok {
+				keys["userID"] = userID
+
+				if gid, err := strconv.ParseInt(gameID, 10, 64); err == nil {
+					if memberBelongSearchMap, err := ristretto_tool.CachedMemberSearchTeamMap(gid); err == nil {
+						if team, ok := memberBelongSearchMap[userID]; ok {
+							keys["teamID"] = team.TeamID
+						}
+					}
+				}
+			}
+
+			// 处理WebSocket连接
+			dbtool.Melody().HandleRequestWithKeys(c.Writer, c.Request, keys)
 		})
 
 		containerGroup := auth.Group("/admin/container")
@@ -486,6 +625,8 @@ func main() {
 			containerGroup.POST("/delete", controllers.AdminDeleteContainer)
 			containerGroup.POST("/extend", controllers.AdminExtendContainer)
 			containerGroup.GET("/flag", controllers.AdminGetContainerFlag)
+			containerGroup.GET("/ports", controllers.AdminGetPortPoolUsage)
+			containerGroup.GET("/gc", controllers.AdminPreviewContainerGC)
 		}
 
 		// 系统设置相关API
@@ -522,6 +663,8 @@ func main() {
 
 	// 启动任务线程
 	StartLoopEvent()
+	watcherCtx, stopWatcher := context.WithCancel(context.Background())
+	jobs.StartContainerWatcher(watcherCtx)
 
 	// 创建HTTP服务器
 	srv := &http.Server{
@@ -544,6 +687,9 @@ func main() {
 	<-quit
 	zaphelper.Logger.Info("Shutting down server...")
 
+	// 停止容器状态监听
+	stopWatcher()
+
 	tasks.CloseTaskQueue()
 
 	// 设置关闭超时时间
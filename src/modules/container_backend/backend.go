@@ -0,0 +1,158 @@
+package containerbackend
+
+import (
+	"a1ctf/src/db/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	dockertool "a1ctf/src/utils/docker_tool"
+)
+
+var ErrInstanceNotFound = errors.New("instance not found")
+
+type InstanceStatus string
+
+const (
+	InstanceRunning InstanceStatus = "InstanceRunning"
+	InstanceFailed  InstanceStatus = "InstanceFailed"
+	InstanceWaiting InstanceStatus = "InstanceWaiting"
+)
+
+// InstanceStatusDecision 表示对题目实例状态的处理决定, 与具体后端无关
+type InstanceStatusDecision struct {
+	Status         InstanceStatus // 实例是否已经开启
+	ShouldContinue bool           // 是否继续等待
+	ShouldReport   bool           // 是否上报错误
+	Message        string         // 状态信息
+}
+
+// InstanceInfo 一个题目实例, 对应一个队伍开启的一道题的所有容器
+type InstanceInfo struct {
+	Name       string
+	TeamHash   string
+	InGameID   int64
+	Labels     map[string]string
+	Containers []dockertool.A1Container
+	Flag       string
+	// 多段 flag 题目的动态子 flag, 子 flag 名称 -> flag
+	SubFlags map[string]string
+	// 蜜罐 flag 和放入的位置, DecoyFlag 为空时不放入
+	DecoyFlag string
+	DecoyEnv  string
+	DecoyFile string
+	AllowWAN  bool
+	AllowDNS  bool
+	// 平台分配的宿主机端口, 只有 NeedHostPorts 的后端使用
+	AllocatedPorts models.AllocatedPorts
+}
+
+// InstanceState 后端中实际存在的一个题目实例
+type InstanceState struct {
+	Name     string
+	TeamHash string
+	InGameID int64
+	Status   InstanceStatusDecision
+}
+
+// InstanceEvent 后端推送的实例变化, 只作为触发信号, 实例的完整状态需要通过 GetInstanceStatus 获取
+type InstanceEvent struct {
+	Name     string
+	TeamHash string
+	InGameID int64
+	Action   string
+}
+
+// InstancePort 题目实例对外暴露的一个端口
+type InstancePort struct {
+	ContainerName string // 对应 A1Container.Name
+	PortName      string
+	Port          int32
+	HostPort      int32
+	Host          string // 选手访问的地址
+}
+
+type ContainerBackend interface {
+	// Name 后端名称
+	Name() string
+	// NeedHostPorts 是否需要平台在创建实例前分配宿主机端口
+	NeedHostPorts() bool
+
+	// CreateInstance 创建并启动题目实例
+	//   - {info} 实例信息
+	CreateInstance(info *InstanceInfo) error
+	// DeleteInstance 删除题目实例及其附属资源
+	//   - {info} 实例信息
+	DeleteInstance(info *InstanceInfo) error
+	// ForceDeleteInstance 只根据实例名称删除, 用于清理数据库中已经不存在的实例
+	//   - {name} 实例名称
+	ForceDeleteInstance(name string) error
+
+	// ListInstances 列出后端中所有由平台管理的实例
+	ListInstances() ([]InstanceState, error)
+	// GetInstanceStatus 获取单个实例的状态, 不存在时返回 ErrInstanceNotFound
+	//   - {info} 实例信息
+	GetInstanceStatus(info *InstanceInfo) (InstanceStatusDecision, error)
+	// GetInstancePorts 获取实例对外暴露的端口
+	//   - {info} 实例信息
+	GetInstancePorts(info *InstanceInfo) ([]InstancePort, error)
+
+	// WatchInstances 订阅实例变化, 阻塞直到 ctx 结束或者连接断开
+	//   - {handler} 事件处理函数
+	WatchInstances(ctx context.Context, handler func(event InstanceEvent)) error
+}
+
+// Backend 当前使用的容器后端
+var Backend ContainerBackend
+
+// InitBackend 根据配置文件 container.backend 初始化容器后端
+//   - docker 默认, 单机 Docker
+//   - k8s Kubernetes 集群
+//   - fake 内存实现, 不需要任何守护进程, 仅用于开发和测试
+func InitBackend() {
+	backend, err := NewBackend(viper.GetString("container.backend"))
+	if err != nil {
+		panic(err)
+	}
+
+	Backend = backend
+}
+
+func NewBackend(name string) (ContainerBackend, error) {
+	switch name {
+	case "", "docker":
+		return NewDockerBackend(), nil
+	case "k8s":
+		return NewK8sBackend()
+	case "fake":
+		return NewFakeBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown container backend %s", name)
+	}
+}
+
+// InstanceName 题目实例名称
+func InstanceName(inGameID int64, teamHash string) string {
+	return fmt.Sprintf("cl-%d-%s", inGameID, teamHash)
+}
+
+// NewInstanceInfo 从数据库中的容器记录构造实例信息, 需要预加载 Challenge 和 TeamFlag
+func NewInstanceInfo(container *models.Container) *InstanceInfo {
+	return &InstanceInfo{
+		Name:       InstanceName(container.InGameID, container.TeamHash),
+		TeamHash:   container.TeamHash,
+		InGameID:   container.InGameID,
+		Containers: container.ContainerConfig,
+		Labels: map[string]string{
+			"team_hash":     container.TeamHash,
+			"ingame_id":     fmt.Sprintf("%d", container.InGameID),
+			"a1ctf.managed": "true",
+		},
+		Flag:           container.InstanceFlag(),
+		AllowWAN:       container.Challenge.AllowWAN,
+		AllowDNS:       container.Challenge.AllowDNS,
+		AllocatedPorts: container.AllocatedPorts,
+	}
+}
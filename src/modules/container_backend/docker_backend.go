@@ -0,0 +1,236 @@
+package containerbackend
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/spf13/viper"
+
+	dockertool "a1ctf/src/utils/docker_tool"
+)
+
+var _ ContainerBackend = (*DockerBackend)(nil)
+
+// Docker 后端实现, 一个实例对应多个带相同 a1ctf.container_name 标签的容器
+type DockerBackend struct {
+	// 选手访问端口时使用的地址
+	host string
+}
+
+func NewDockerBackend() *DockerBackend {
+	host := viper.GetString("docker.base-host")
+	if host == "" {
+		host = "localhost"
+	}
+
+	return &DockerBackend{
+		host: host,
+	}
+}
+
+func (b *DockerBackend) Name() string {
+	return "docker"
+}
+
+func (b *DockerBackend) NeedHostPorts() bool {
+	return true
+}
+
+func (b *DockerBackend) toContainerInfo(info *InstanceInfo) *dockertool.ContainerInfo {
+	hostPorts := make(map[string]int32)
+	for _, port := range info.AllocatedPorts {
+		hostPorts[dockertool.HostPortKey(port.ContainerName, port.Port)] = port.HostPort
+	}
+
+	return &dockertool.ContainerInfo{
+		Name:       info.Name,
+		TeamHash:   info.TeamHash,
+		Labels:     info.Labels,
+		Containers: info.Containers,
+		Flag:       info.Flag,
+		SubFlags:   info.SubFlags,
+		DecoyFlag:  info.DecoyFlag,
+		DecoyEnv:   info.DecoyEnv,
+		DecoyFile:  info.DecoyFile,
+		AllowWAN:   info.AllowWAN,
+		AllowDNS:   info.AllowDNS,
+		HostPorts:  hostPorts,
+	}
+}
+
+func (b *DockerBackend) CreateInstance(info *InstanceInfo) error {
+	return dockertool.CreateContainer(b.toContainerInfo(info))
+}
+
+func (b *DockerBackend) DeleteInstance(info *InstanceInfo) error {
+	return dockertool.DeleteContainer(b.toContainerInfo(info))
+}
+
+func (b *DockerBackend) ForceDeleteInstance(name string) error {
+	return dockertool.ForceDeleteContainer(name)
+}
+
+func convertContainerStatus(decision dockertool.ContainerStatusDecision) InstanceStatusDecision {
+	status := InstanceWaiting
+	switch decision.Status {
+	case dockertool.CustomContainerRunning:
+		status = InstanceRunning
+	case dockertool.CustomContainerFailed:
+		status = InstanceFailed
+	}
+
+	return InstanceStatusDecision{
+		Status:         status,
+		ShouldContinue: decision.ShouldContinue,
+		ShouldReport:   decision.ShouldReport,
+		Message:        decision.Message,
+	}
+}
+
+// 合并同一实例下多个容器的状态: 有一个失败则失败, 全部运行才算运行
+func mergeInstanceStatus(current InstanceStatusDecision, next InstanceStatusDecision) InstanceStatusDecision {
+	if current.Status == InstanceFailed {
+		return current
+	}
+	if next.Status == InstanceFailed || next.Status == InstanceWaiting {
+		return next
+	}
+	if current.Status == InstanceWaiting {
+		return current
+	}
+	return next
+}
+
+func (b *DockerBackend) ListInstances() ([]InstanceState, error) {
+	containers, err := dockertool.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	return groupInstances(containers), nil
+}
+
+// 按 a1ctf.container_name 标签把容器合并成实例
+func groupInstances(containers []types.Container) []InstanceState {
+	instances := make([]InstanceState, 0)
+	instanceIndex := make(map[string]int)
+	// 实例已经创建的容器数量, 少于 a1ctf.container_count 时说明还在创建中
+	createdCount := make(map[string]int)
+	expectedCount := make(map[string]int)
+
+	for _, container := range containers {
+		name, exists1 := container.Labels["a1ctf.container_name"]
+		teamHash, exists2 := container.Labels["a1ctf.team_hash"]
+		inGameID, exists3 := container.Labels["a1ctf.ingame_id"]
+		if !exists1 || !exists2 || !exists3 {
+			continue
+		}
+
+		inGameIDInt, err := strconv.ParseInt(inGameID, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		decision, _ := dockertool.CheckContainerStatus(&container)
+		status := convertContainerStatus(decision)
+
+		createdCount[name]++
+		if count, err := strconv.Atoi(container.Labels["a1ctf.container_count"]); err == nil {
+			expectedCount[name] = count
+		}
+
+		if index, ok := instanceIndex[name]; ok {
+			instances[index].Status = mergeInstanceStatus(instances[index].Status, status)
+			continue
+		}
+
+		instanceIndex[name] = len(instances)
+		instances = append(instances, InstanceState{
+			Name:     name,
+			TeamHash: teamHash,
+			InGameID: inGameIDInt,
+			Status:   status,
+		})
+	}
+
+	for name, index := range instanceIndex {
+		if createdCount[name] < expectedCount[name] && instances[index].Status.Status == InstanceRunning {
+			instances[index].Status = InstanceStatusDecision{
+				Status:         InstanceWaiting,
+				ShouldContinue: true,
+				ShouldReport:   false,
+				Message:        "Instance is still creating containers",
+			}
+		}
+	}
+
+	return instances
+}
+
+func (b *DockerBackend) GetInstanceStatus(info *InstanceInfo) (InstanceStatusDecision, error) {
+	// 只查询这个实例的容器, 事件回调里频繁调用
+	containers, err := dockertool.ListInstanceContainers(info.Name)
+	if err != nil {
+		return InstanceStatusDecision{}, err
+	}
+
+	for _, instance := range groupInstances(containers) {
+		if instance.Name == info.Name && instance.TeamHash == info.TeamHash {
+			return instance.Status, nil
+		}
+	}
+
+	return InstanceStatusDecision{}, ErrInstanceNotFound
+}
+
+func (b *DockerBackend) GetInstancePorts(info *InstanceInfo) ([]InstancePort, error) {
+	ports, err := dockertool.GetContainerPorts(b.toContainerInfo(info))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]InstancePort, 0)
+	for _, container := range info.Containers {
+		for _, exposePort := range container.ExposePorts {
+			for _, port := range *ports {
+				// 旧版本创建的容器没有 a1ctf.service_name 标签, 只能按端口匹配
+				if port.ServiceName != "" && port.ServiceName != container.Name {
+					continue
+				}
+				if port.Port != exposePort.Port {
+					continue
+				}
+
+				result = append(result, InstancePort{
+					ContainerName: container.Name,
+					PortName:      exposePort.Name,
+					Port:          exposePort.Port,
+					HostPort:      port.HostPort,
+					Host:          b.host,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (b *DockerBackend) WatchInstances(ctx context.Context, handler func(event InstanceEvent)) error {
+	return dockertool.WatchContainerEvents(ctx, func(message events.Message) {
+		attributes := message.Actor.Attributes
+
+		inGameID, err := strconv.ParseInt(attributes["a1ctf.ingame_id"], 10, 64)
+		if err != nil {
+			return
+		}
+
+		handler(InstanceEvent{
+			Name:     attributes["a1ctf.container_name"],
+			TeamHash: attributes["a1ctf.team_hash"],
+			InGameID: inGameID,
+			Action:   string(message.Action),
+		})
+	})
+}
@@ -0,0 +1,213 @@
+package containerbackend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var _ ContainerBackend = (*FakeBackend)(nil)
+
+// 内存后端实现, 不创建任何真实容器
+// 实例创建后立即处于运行状态, 可以通过 SetInstanceStatus 模拟启动中和失败的情况
+type FakeBackend struct {
+	mu        sync.Mutex
+	instances map[string]*fakeInstance
+	nextPort  int32
+
+	watchers map[chan InstanceEvent]struct{}
+}
+
+type fakeInstance struct {
+	info   InstanceInfo
+	status InstanceStatusDecision
+	ports  []InstancePort
+}
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		instances: make(map[string]*fakeInstance),
+		nextPort:  40000,
+		watchers:  make(map[chan InstanceEvent]struct{}),
+	}
+}
+
+func (b *FakeBackend) Name() string {
+	return "fake"
+}
+
+func (b *FakeBackend) NeedHostPorts() bool {
+	return true
+}
+
+func (b *FakeBackend) CreateInstance(info *InstanceInfo) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.instances[info.Name]; exists {
+		return fmt.Errorf("instance %s already exists", info.Name)
+	}
+
+	ports := make([]InstancePort, 0)
+	if len(info.AllocatedPorts) > 0 {
+		for _, p := range info.AllocatedPorts {
+			ports = append(ports, InstancePort{
+				ContainerName: p.ContainerName,
+				PortName:      p.PortName,
+				Port:          p.Port,
+				HostPort:      p.HostPort,
+				Host:          "127.0.0.1",
+			})
+		}
+	} else {
+		for _, c := range info.Containers {
+			for _, p := range c.ExposePorts {
+				ports = append(ports, InstancePort{
+					ContainerName: c.Name,
+					PortName:      p.Name,
+					Port:          p.Port,
+					HostPort:      b.nextPort,
+					Host:          "127.0.0.1",
+				})
+				b.nextPort++
+			}
+		}
+	}
+
+	b.instances[info.Name] = &fakeInstance{
+		info: *info,
+		status: InstanceStatusDecision{
+			Status:  InstanceRunning,
+			Message: "Instance is running successfully",
+		},
+		ports: ports,
+	}
+
+	b.notify(info.Name, "start")
+	return nil
+}
+
+func (b *FakeBackend) DeleteInstance(info *InstanceInfo) error {
+	return b.ForceDeleteInstance(info.Name)
+}
+
+func (b *FakeBackend) ForceDeleteInstance(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.notify(name, "destroy")
+	delete(b.instances, name)
+	return nil
+}
+
+func (b *FakeBackend) ListInstances() ([]InstanceState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	instances := make([]InstanceState, 0, len(b.instances))
+	for name, instance := range b.instances {
+		instances = append(instances, InstanceState{
+			Name:     name,
+			TeamHash: instance.info.TeamHash,
+			InGameID: instance.info.InGameID,
+			Status:   instance.status,
+		})
+	}
+
+	return instances, nil
+}
+
+func (b *FakeBackend) GetInstanceStatus(info *InstanceInfo) (InstanceStatusDecision, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	instance, exists := b.instances[info.Name]
+	if !exists {
+		return InstanceStatusDecision{}, ErrInstanceNotFound
+	}
+
+	return instance.status, nil
+}
+
+func (b *FakeBackend) GetInstancePorts(info *InstanceInfo) ([]InstancePort, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	instance, exists := b.instances[info.Name]
+	if !exists {
+		return nil, ErrInstanceNotFound
+	}
+
+	ports := make([]InstancePort, len(instance.ports))
+	copy(ports, instance.ports)
+	return ports, nil
+}
+
+// SetInstanceStatus 修改实例状态, 用于模拟启动中或者运行失败
+//   - {name} 实例名称
+//   - {status} 新的状态
+//   - {message} 状态信息
+func (b *FakeBackend) SetInstanceStatus(name string, status InstanceStatus, message string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	instance, exists := b.instances[name]
+	if !exists {
+		return ErrInstanceNotFound
+	}
+
+	instance.status = InstanceStatusDecision{
+		Status:         status,
+		ShouldContinue: status == InstanceWaiting,
+		ShouldReport:   status == InstanceFailed,
+		Message:        message,
+	}
+
+	b.notify(name, string(status))
+	return nil
+}
+
+func (b *FakeBackend) WatchInstances(ctx context.Context, handler func(event InstanceEvent)) error {
+	events := make(chan InstanceEvent, 64)
+
+	b.mu.Lock()
+	b.watchers[events] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.watchers, events)
+		b.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			handler(event)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// 通知所有订阅者, 调用时需要持有锁. 订阅者处理不过来时丢弃事件, 由定时对账兜底
+func (b *FakeBackend) notify(name string, action string) {
+	instance, exists := b.instances[name]
+	if !exists {
+		return
+	}
+
+	event := InstanceEvent{
+		Name:     name,
+		TeamHash: instance.info.TeamHash,
+		InGameID: instance.info.InGameID,
+		Action:   action,
+	}
+
+	for watcher := range b.watchers {
+		select {
+		case watcher <- event:
+		default:
+		}
+	}
+}
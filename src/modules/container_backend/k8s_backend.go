@@ -0,0 +1,206 @@
+package containerbackend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8stool "a1ctf/src/utils/k8s_tool"
+)
+
+var _ ContainerBackend = (*K8sBackend)(nil)
+
+// Kubernetes 后端实现, 一个实例对应一个 Pod 以及同名的 Service 和 NetworkPolicy
+type K8sBackend struct{}
+
+func NewK8sBackend() (*K8sBackend, error) {
+	if err := k8stool.InitNamespace(); err != nil {
+		return nil, err
+	}
+	k8stool.InitNodeAddressMap()
+
+	return &K8sBackend{}, nil
+}
+
+func (b *K8sBackend) Name() string {
+	return "k8s"
+}
+
+// NodePort 由集群分配
+func (b *K8sBackend) NeedHostPorts() bool {
+	return false
+}
+
+func (b *K8sBackend) toPodInfo(info *InstanceInfo) *k8stool.PodInfo {
+	containers := make([]k8stool.A1Container, 0, len(info.Containers))
+	for _, c := range info.Containers {
+		env := make([]corev1.EnvVar, 0, len(c.Env))
+		for _, e := range c.Env {
+			env = append(env, corev1.EnvVar{Name: e.Name, Value: e.Value})
+		}
+
+		ports := make([]k8stool.PortName, 0, len(c.ExposePorts))
+		for _, p := range c.ExposePorts {
+			ports = append(ports, k8stool.PortName{Name: p.Name, Port: p.Port})
+		}
+
+		containers = append(containers, k8stool.A1Container{
+			Name:         c.Name,
+			Image:        c.Image,
+			Command:      c.Command,
+			Env:          env,
+			ExposePorts:  ports,
+			CPULimit:     c.CPULimit,
+			MemoryLimit:  c.MemoryLimit,
+			StorageLimit: c.StorageLimit,
+		})
+	}
+
+	return &k8stool.PodInfo{
+		Name:       info.Name,
+		TeamHash:   info.TeamHash,
+		Labels:     info.Labels,
+		Containers: containers,
+		Flag:       info.Flag,
+		SubFlags:   info.SubFlags,
+		DecoyFlag:  info.DecoyFlag,
+		DecoyEnv:   info.DecoyEnv,
+		DecoyFile:  info.DecoyFile,
+		AllowWAN:   info.AllowWAN,
+		AllowDNS:   info.AllowDNS,
+	}
+}
+
+func (b *K8sBackend) CreateInstance(info *InstanceInfo) error {
+	return k8stool.CreatePod(b.toPodInfo(info))
+}
+
+func (b *K8sBackend) DeleteInstance(info *InstanceInfo) error {
+	return k8stool.DeletePod(b.toPodInfo(info))
+}
+
+func (b *K8sBackend) ForceDeleteInstance(name string) error {
+	return k8stool.ForceDeletePod(name)
+}
+
+func convertPodStatus(decision k8stool.PodStatusDecision) InstanceStatusDecision {
+	status := InstanceWaiting
+	switch decision.Status {
+	case k8stool.CustomPodRunning:
+		status = InstanceRunning
+	case k8stool.CustomPodFailed:
+		status = InstanceFailed
+	}
+
+	return InstanceStatusDecision{
+		Status:         status,
+		ShouldContinue: decision.ShouldContinue,
+		ShouldReport:   decision.ShouldReport,
+		Message:        decision.Message,
+	}
+}
+
+func (b *K8sBackend) ListInstances() ([]InstanceState, error) {
+	pods, err := k8stool.ListPods()
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]InstanceState, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		teamHash, exists1 := pod.Labels["team_hash"]
+		inGameID, exists2 := pod.Labels["ingame_id"]
+		if !exists1 || !exists2 {
+			continue
+		}
+
+		inGameIDInt, err := strconv.ParseInt(inGameID, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		decision, _ := k8stool.CheckPodStatus(&pod)
+		instances = append(instances, InstanceState{
+			Name:     pod.Name,
+			TeamHash: teamHash,
+			InGameID: inGameIDInt,
+			Status:   convertPodStatus(decision),
+		})
+	}
+
+	return instances, nil
+}
+
+func (b *K8sBackend) GetInstanceStatus(info *InstanceInfo) (InstanceStatusDecision, error) {
+	clientset, err := k8stool.GetClient()
+	if err != nil {
+		return InstanceStatusDecision{}, err
+	}
+
+	pod, err := clientset.CoreV1().Pods("a1ctf-challenges").Get(context.Background(), info.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return InstanceStatusDecision{}, ErrInstanceNotFound
+	} else if err != nil {
+		return InstanceStatusDecision{}, err
+	}
+
+	decision, _ := k8stool.CheckPodStatus(pod)
+	return convertPodStatus(decision), nil
+}
+
+func (b *K8sBackend) GetInstancePorts(info *InstanceInfo) ([]InstancePort, error) {
+	ports, err := k8stool.GetPodPorts(b.toPodInfo(info))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]InstancePort, 0)
+	for _, port := range *ports {
+		// Service 端口名称为 {容器下标}-{端口名称}
+		parts := strings.SplitN(port.Name, "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 || index >= len(info.Containers) {
+			continue
+		}
+
+		host, ok := k8stool.NodeAddressMap[port.NodeName]
+		if !ok {
+			return nil, fmt.Errorf("address of node %s not found in k8s.node-ip-map", port.NodeName)
+		}
+
+		result = append(result, InstancePort{
+			ContainerName: info.Containers[index].Name,
+			PortName:      parts[1],
+			Port:          port.Port,
+			HostPort:      port.NodePort,
+			Host:          host,
+		})
+	}
+
+	return result, nil
+}
+
+func (b *K8sBackend) WatchInstances(ctx context.Context, handler func(event InstanceEvent)) error {
+	return k8stool.WatchPods(ctx, func(pod *corev1.Pod) {
+		inGameID, err := strconv.ParseInt(pod.Labels["ingame_id"], 10, 64)
+		if err != nil {
+			return
+		}
+
+		handler(InstanceEvent{
+			Name:     pod.Name,
+			TeamHash: pod.Labels["team_hash"],
+			InGameID: inGameID,
+			Action:   string(pod.Status.Phase),
+		})
+	})
+}
@@ -0,0 +1,154 @@
+package containerbackend
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 分配端口时使用的 PostgreSQL 事务级 advisory lock, 保证多个 worker 不会分到同一个端口
+const portAllocatorLockKey int64 = 0x61316374665f7070
+
+var ErrPortPoolExhausted = errors.New("host port pool exhausted")
+
+// PortRange 宿主机端口池, 闭区间
+type PortRange struct {
+	Start int32
+	End   int32
+}
+
+func (r PortRange) Size() int {
+	return int(r.End-r.Start) + 1
+}
+
+func (r PortRange) Contains(port int32) bool {
+	return port >= r.Start && port <= r.End
+}
+
+// GetPortRange 读取配置文件 container.port-range-start / container.port-range-end
+func GetPortRange() PortRange {
+	portRange := PortRange{
+		Start: viper.GetInt32("container.port-range-start"),
+		End:   viper.GetInt32("container.port-range-end"),
+	}
+
+	if portRange.Start <= 0 || portRange.End > 65535 || portRange.Start > portRange.End {
+		portRange = PortRange{Start: 30000, End: 39999}
+	}
+
+	return portRange
+}
+
+// 所有仍持有端口的容器
+func listAllocatedContainers(tx *gorm.DB) ([]models.Container, error) {
+	var containers []models.Container
+	if err := tx.Model(&models.Container{}).
+		Where("jsonb_array_length(allocated_ports) > 0").
+		Find(&containers).Error; err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// AllocateHostPorts 为容器的每个暴露端口分配一个空闲的宿主机端口, 并记录到 containers.allocated_ports
+// 容器删除后 (ContainerStopped / ContainerError) 清空 allocated_ports 即释放端口
+// 如果容器已经分配过端口 (例如任务重试), 直接返回已有的分配
+//   - {container} 容器记录
+func AllocateHostPorts(container *models.Container) (models.AllocatedPorts, error) {
+	portRange := GetPortRange()
+	result := make(models.AllocatedPorts, 0)
+
+	err := dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", portAllocatorLockKey).Error; err != nil {
+			return err
+		}
+
+		var current models.Container
+		if err := tx.Where("container_id = ?", container.ContainerID).First(&current).Error; err != nil {
+			return err
+		}
+
+		if len(current.AllocatedPorts) > 0 {
+			result = current.AllocatedPorts
+			return nil
+		}
+
+		allocatedContainers, err := listAllocatedContainers(tx)
+		if err != nil {
+			return err
+		}
+
+		usedPorts := make(map[int32]bool)
+		for _, c := range allocatedContainers {
+			for _, port := range c.AllocatedPorts {
+				usedPorts[port.HostPort] = true
+			}
+		}
+
+		nextPort := portRange.Start
+		for _, c := range container.ContainerConfig {
+			for _, exposePort := range c.ExposePorts {
+				for nextPort <= portRange.End && usedPorts[nextPort] {
+					nextPort++
+				}
+				if nextPort > portRange.End {
+					return ErrPortPoolExhausted
+				}
+
+				usedPorts[nextPort] = true
+				result = append(result, models.AllocatedPort{
+					ContainerName: c.Name,
+					PortName:      exposePort.Name,
+					Port:          exposePort.Port,
+					HostPort:      nextPort,
+				})
+			}
+		}
+
+		return tx.Model(&models.Container{}).
+			Where("container_id = ?", container.ContainerID).
+			Update("allocated_ports", result).Error
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate host ports: %w", err)
+	}
+
+	return result, nil
+}
+
+// PortPoolUsage 端口池使用情况
+type PortPoolUsage struct {
+	Range      PortRange
+	Used       int
+	Containers []models.Container
+}
+
+// GetPortPoolUsage 获取端口池使用情况, 端口池外的分配 (修改配置前分配的) 不计入使用量
+func GetPortPoolUsage() (*PortPoolUsage, error) {
+	portRange := GetPortRange()
+
+	containers, err := listAllocatedContainers(dbtool.DB())
+	if err != nil {
+		return nil, err
+	}
+
+	used := 0
+	for _, c := range containers {
+		for _, port := range c.AllocatedPorts {
+			if portRange.Contains(port.HostPort) {
+				used++
+			}
+		}
+	}
+
+	return &PortPoolUsage{
+		Range:      portRange,
+		Used:       used,
+		Containers: containers,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package trafficgateway
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"a1ctf/src/utils/zaphelper"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/dgraph-io/ristretto/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// 域名解析结果的缓存时间, 容器关闭后最多这么久仍然可以访问
+const hostnameCacheTime = 5 * time.Second
+
+// 不存在的域名只缓存很短的时间, 刚启动的实例很快就可以访问
+const hostnameNegativeCacheTime = 1 * time.Second
+
+type hostnameTarget struct {
+	address    string // 为空表示域名不存在
+	expireTime time.Time
+}
+
+// 任何人都可以请求随机的子域名, 缓存需要限制大小
+var (
+	hostnameCache     *ristretto.Cache[string, *hostnameTarget]
+	hostnameCacheOnce sync.Once
+)
+
+func getHostnameCache() *ristretto.Cache[string, *hostnameTarget] {
+	hostnameCacheOnce.Do(func() {
+		cache, err := ristretto.NewCache(&ristretto.Config[string, *hostnameTarget]{
+			NumCounters: 1e5,
+			MaxCost:     1e4, // 每个域名的 cost 为 1, 最多缓存 10000 个
+			BufferItems: 64,
+		})
+		if err != nil {
+			panic(err)
+		}
+		hostnameCache = cache
+	})
+	return hostnameCache
+}
+
+// WebDomain WEB 题目实例的域名后缀, 例如 chal.example.org, 为空时不启用子域名访问
+func WebDomain() string {
+	return strings.ToLower(strings.Trim(viper.GetString("gateway.web-domain"), "."))
+}
+
+// NewInstanceHostname 生成一个随机的实例域名
+func NewInstanceHostname() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s", hex.EncodeToString(buf), WebDomain()), nil
+}
+
+// hostnameFilter 生成 expose_ports @> ?::jsonb 使用的过滤条件
+// 只能包含 hostname, 直接序列化 models.ContainerExposeInfos 会带上空的 container_name / port 等字段, 永远匹配不到
+func hostnameFilter(hostname string) (string, error) {
+	return sonic.MarshalString([]map[string]interface{}{
+		{"expose_port": []map[string]interface{}{
+			{"hostname": hostname},
+		}},
+	})
+}
+
+func resolveHostname(hostname string) (*hostnameTarget, error) {
+	cache := getHostnameCache()
+	if target, ok := cache.Get(hostname); ok {
+		return target, nil
+	}
+
+	filter, err := hostnameFilter(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &hostnameTarget{}
+
+	var containers []models.Container
+	if err := dbtool.DB().Where("container_status = ? AND expose_ports @> ?::jsonb", models.ContainerRunning, filter).
+		Find(&containers).Error; err != nil {
+		return nil, err
+	}
+
+	for _, container := range containers {
+		for _, exposeInfo := range container.ContainerExposeInfos {
+			for _, port := range exposeInfo.ExposePorts {
+				if port.Hostname != hostname {
+					continue
+				}
+
+				host := viper.GetString("gateway.upstream-host")
+				if host == "" {
+					host = port.IP
+				}
+				target.address = net.JoinHostPort(host, fmt.Sprintf("%d", port.Port))
+				target.expireTime = container.ExpireTime
+			}
+		}
+	}
+
+	if target.address == "" {
+		cache.SetWithTTL(hostname, target, 1, hostnameNegativeCacheTime)
+	} else {
+		cache.SetWithTTL(hostname, target, 1, hostnameCacheTime)
+	}
+	return target, nil
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f5f5; color: #333; display: flex; align-items: center; justify-content: center; height: 100vh; margin: 0; }
+.box { background: #fff; padding: 40px 48px; border-radius: 12px; box-shadow: 0 4px 16px rgba(0,0,0,0.08); text-align: center; max-width: 480px; }
+h1 { font-size: 22px; margin: 0 0 12px; }
+p { margin: 6px 0; color: #666; }
+</style>
+</head>
+<body>
+<div class="box">
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+<p>{{.MessageZh}}</p>
+</div>
+</body>
+</html>`))
+
+func renderErrorPage(w http.ResponseWriter, status int, title string, message string, messageZh string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = errorPageTemplate.Execute(w, map[string]string{
+		"Title":     title,
+		"Message":   message,
+		"MessageZh": messageZh,
+	})
+}
+
+// HTTPSubdomainMiddleware 把 WEB 题目实例域名的请求反向代理到对应容器, 其他请求正常处理
+func HTTPSubdomainMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := WebDomain()
+		if domain == "" {
+			c.Next()
+			return
+		}
+
+		hostname := strings.ToLower(c.Request.Host)
+		if host, _, err := net.SplitHostPort(hostname); err == nil {
+			hostname = host
+		}
+
+		if !strings.HasSuffix(hostname, "."+domain) {
+			c.Next()
+			return
+		}
+		c.Abort()
+
+		target, err := resolveHostname(hostname)
+		if err != nil {
+			zaphelper.Logger.Error("Failed to resolve instance hostname", zap.String("hostname", hostname), zap.Error(err))
+			renderErrorPage(c.Writer, http.StatusInternalServerError, "Server Error",
+				"Something went wrong, please try again later.",
+				"服务器出错了, 请稍后再试")
+			return
+		}
+
+		if target.address == "" || time.Now().UTC().After(target.expireTime) {
+			renderErrorPage(c.Writer, http.StatusNotFound, "Instance Not Found",
+				"This challenge instance does not exist or has expired. Please launch it again from the challenge page.",
+				"题目实例不存在或已过期, 请在题目页面重新启动")
+			return
+		}
+
+		upstream := &url.URL{Scheme: "http", Host: target.address}
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetURL(upstream)
+				r.Out.Host = r.In.Host
+				r.SetXForwarded()
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				renderErrorPage(w, http.StatusBadGateway, "Instance Unavailable",
+					"The challenge instance is not responding, it may still be starting.",
+					"题目实例没有响应, 可能还在启动中")
+			},
+		}
+
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+}
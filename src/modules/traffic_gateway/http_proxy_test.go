@@ -0,0 +1,109 @@
+package trafficgateway
+
+import (
+	"a1ctf/src/db/models"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+// jsonbContains 按照 PostgreSQL jsonb @> 的规则判断 value 是否包含 filter
+func jsonbContains(value interface{}, filter interface{}) bool {
+	switch f := filter.(type) {
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, fieldFilter := range f {
+			fieldValue, exists := v[key]
+			if !exists || !jsonbContains(fieldValue, fieldFilter) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, elemFilter := range f {
+			found := false
+			for _, elem := range v {
+				if jsonbContains(elem, elemFilter) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return value == filter
+	}
+}
+
+func TestHostnameFilterMatchesExposePortsRow(t *testing.T) {
+	hostname := "1a2b3c4d5e6f7a8b.chal.example.org"
+
+	// 和启动 WEB 题目实例后写入 expose_ports 列的数据一致
+	row, err := models.ContainerExposeInfos{
+		{
+			ContainerName: "db",
+			ExposePorts: models.ExposePorts{
+				{PortName: "mysql", Port: 30001, IP: "10.0.0.2"},
+			},
+		},
+		{
+			ContainerName: "web",
+			ExposePorts: models.ExposePorts{
+				{PortName: "ssh", Port: 30002, IP: "10.0.0.2"},
+				{PortName: "http", Port: 30003, IP: "10.0.0.2", Hostname: hostname},
+			},
+		},
+	}.Value()
+	if err != nil {
+		t.Fatalf("failed to marshal expose ports: %v", err)
+	}
+
+	filter, err := hostnameFilter(hostname)
+	if err != nil {
+		t.Fatalf("failed to build filter: %v", err)
+	}
+
+	var rowValue, filterValue interface{}
+	if err := sonic.Unmarshal(toBytes(t, row), &rowValue); err != nil {
+		t.Fatalf("failed to unmarshal row: %v", err)
+	}
+	if err := sonic.UnmarshalString(filter, &filterValue); err != nil {
+		t.Fatalf("failed to unmarshal filter: %v", err)
+	}
+
+	if !jsonbContains(rowValue, filterValue) {
+		t.Fatalf("filter %s does not match row %s", filter, toBytes(t, row))
+	}
+
+	otherFilter, _ := hostnameFilter("ffffffffffffffff.chal.example.org")
+	var otherFilterValue interface{}
+	if err := sonic.UnmarshalString(otherFilter, &otherFilterValue); err != nil {
+		t.Fatalf("failed to unmarshal filter: %v", err)
+	}
+	if jsonbContains(rowValue, otherFilterValue) {
+		t.Fatalf("filter %s should not match row %s", otherFilter, toBytes(t, row))
+	}
+}
+
+func toBytes(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		t.Fatalf("unexpected driver value type %T", value)
+		return nil
+	}
+}
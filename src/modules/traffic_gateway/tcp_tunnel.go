@@ -0,0 +1,264 @@
+package trafficgateway
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	"a1ctf/src/utils/zaphelper"
+	"a1ctf/src/webmodels"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// GatewaySubprotocol 浏览器无法设置 WebSocket 请求头, 令牌和这个子协议一起放在 Sec-WebSocket-Protocol 中
+const GatewaySubprotocol = "a1ctf-gateway"
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	Subprotocols:    []string{GatewaySubprotocol},
+	// 通过令牌鉴权, 允许命令行工具等非浏览器客户端连接
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// 每个队伍当前的连接数
+var (
+	teamConnections      = make(map[int64]int)
+	teamConnectionsMutex sync.Mutex
+)
+
+func acquireTeamConnection(teamID int64) bool {
+	limit := viper.GetInt("gateway.max-connections-per-team")
+	if limit <= 0 {
+		limit = 32
+	}
+
+	teamConnectionsMutex.Lock()
+	defer teamConnectionsMutex.Unlock()
+
+	if teamConnections[teamID] >= limit {
+		return false
+	}
+	teamConnections[teamID]++
+	return true
+}
+
+func releaseTeamConnection(teamID int64) {
+	teamConnectionsMutex.Lock()
+	defer teamConnectionsMutex.Unlock()
+
+	teamConnections[teamID]--
+	if teamConnections[teamID] <= 0 {
+		delete(teamConnections, teamID)
+	}
+}
+
+// 查找令牌对应的容器端口地址
+func findUpstreamAddress(container *models.Container, containerName string, portName string) (string, bool) {
+	for _, exposeInfo := range container.ContainerExposeInfos {
+		if exposeInfo.ContainerName != containerName {
+			continue
+		}
+
+		for _, port := range exposeInfo.ExposePorts {
+			if port.PortName != portName {
+				continue
+			}
+
+			// 网关和容器不在同一个网络环境时 (例如平台本身运行在容器中), 需要单独配置上游地址
+			host := viper.GetString("gateway.upstream-host")
+			if host == "" {
+				host = port.IP
+			}
+			return net.JoinHostPort(host, fmt.Sprintf("%d", port.Port)), true
+		}
+	}
+
+	return "", false
+}
+
+// 从请求头中读取令牌, 不放在 URL 中避免出现在访问日志和浏览器历史里
+//   - Authorization: Bearer {token}, 用于命令行等可以设置请求头的客户端
+//   - Sec-WebSocket-Protocol: a1ctf-gateway, {token}, 用于浏览器
+func tokenFromRequest(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+
+	for _, protocol := range websocket.Subprotocols(r) {
+		if protocol != GatewaySubprotocol {
+			return protocol
+		}
+	}
+
+	return ""
+}
+
+// HandleTCPTunnel 把 WebSocket 连接转发到题目容器的 TCP 端口
+// 每个 Binary 消息对应一段 TCP 数据
+func HandleTCPTunnel(c *gin.Context) {
+	claims, err := ParseToken(tokenFromRequest(c.Request))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, webmodels.ErrorMessage{
+			Code:    401,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidGatewayToken"}),
+		})
+		return
+	}
+
+	var container models.Container
+	if err := dbtool.DB().Where("container_id = ? AND team_id = ?", claims.ContainerID, claims.TeamID).First(&container).Error; err != nil {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "LaunchContainerFirst"}),
+		})
+		return
+	}
+
+	if container.ContainerStatus != models.ContainerRunning || time.Now().UTC().After(container.ExpireTime) {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "LaunchContainerFirst"}),
+		})
+		return
+	}
+
+	address, ok := findUpstreamAddress(&container, claims.ContainerName, claims.PortName)
+	if !ok {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ContainerPortNotFound"}),
+		})
+		return
+	}
+
+	if !acquireTeamConnection(claims.TeamID) {
+		c.JSON(http.StatusTooManyRequests, webmodels.ErrorMessage{
+			Code:    429,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "TooManyGatewayConnections"}),
+		})
+		return
+	}
+	defer releaseTeamConnection(claims.TeamID)
+
+	upstream, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		zaphelper.Logger.Warn("Failed to connect to container", zap.String("address", address), zap.Error(err))
+		c.JSON(http.StatusBadGateway, webmodels.ErrorMessage{
+			Code:    502,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ContainerConnectFailed"}),
+		})
+		return
+	}
+	defer upstream.Close()
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 已经返回了错误响应
+		return
+	}
+	defer ws.Close()
+
+	// 容器到期后断开
+	_ = upstream.SetDeadline(container.ExpireTime)
+
+	connection := models.GatewayConnection{
+		ConnectionID:  uuid.NewString(),
+		GameID:        claims.GameID,
+		TeamID:        claims.TeamID,
+		UserID:        claims.UserID,
+		ContainerID:   container.ContainerID,
+		ChallengeID:   container.ChallengeID,
+		ContainerName: claims.ContainerName,
+		PortName:      claims.PortName,
+		ClientIP:      c.ClientIP(),
+		StartTime:     time.Now().UTC(),
+	}
+
+	if err := dbtool.DB().Create(&connection).Error; err != nil {
+		zaphelper.Logger.Error("Failed to record gateway connection", zap.Error(err), zap.Any("connection", connection))
+	}
+
+	zaphelper.Logger.Info("Gateway connection opened",
+		zap.String("connection_id", connection.ConnectionID),
+		zap.Int64("team_id", connection.TeamID),
+		zap.String("container_id", connection.ContainerID),
+		zap.String("client_ip", connection.ClientIP))
+
+	var bytesIn, bytesOut atomic.Int64
+	done := make(chan struct{}, 2)
+
+	// 选手 -> 容器
+	go func() {
+		defer func() { done <- struct{}{} }()
+		for {
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+				continue
+			}
+
+			n, err := upstream.Write(data)
+			bytesIn.Add(int64(n))
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// 容器 -> 选手
+	go func() {
+		defer func() { done <- struct{}{} }()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := upstream.Read(buf)
+			if n > 0 {
+				if err := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+					return
+				}
+				bytesOut.Add(int64(n))
+			}
+			if err != nil {
+				_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return
+			}
+		}
+	}()
+
+	// 任意一个方向结束后关闭两端, 等待另一个方向退出
+	<-done
+	ws.Close()
+	upstream.Close()
+	<-done
+
+	endTime := time.Now().UTC()
+	if err := dbtool.DB().Model(&connection).Updates(map[string]interface{}{
+		"end_time":  endTime,
+		"bytes_in":  bytesIn.Load(),
+		"bytes_out": bytesOut.Load(),
+	}).Error; err != nil {
+		zaphelper.Logger.Error("Failed to record gateway connection", zap.Error(err), zap.Any("connection", connection))
+	}
+
+	zaphelper.Logger.Info("Gateway connection closed",
+		zap.String("connection_id", connection.ConnectionID),
+		zap.Int64("bytes_in", bytesIn.Load()),
+		zap.Int64("bytes_out", bytesOut.Load()),
+		zap.Duration("duration", endTime.Sub(connection.StartTime)))
+}
@@ -0,0 +1,96 @@
+package trafficgateway
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/spf13/viper"
+)
+
+var ErrInvalidToken = errors.New("invalid gateway token")
+
+// TokenClaims 网关令牌内容, 令牌只能用于一个队伍的一个容器端口
+type TokenClaims struct {
+	GameID        int64  `json:"g"`
+	TeamID        int64  `json:"t"`
+	UserID        string `json:"u"`
+	ContainerID   string `json:"c"`
+	ContainerName string `json:"n"`
+	PortName      string `json:"p"`
+	ExpiresAt     int64  `json:"e"`
+}
+
+var (
+	secret     []byte
+	secretOnce sync.Once
+)
+
+// 未配置 gateway.secret 时使用随机密钥, 重启后旧令牌失效
+func getSecret() []byte {
+	secretOnce.Do(func() {
+		if configured := viper.GetString("gateway.secret"); configured != "" {
+			secret = []byte(configured)
+			return
+		}
+
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	})
+	return secret
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, getSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateToken 生成网关令牌
+//   - {claims} 令牌内容
+func GenerateToken(claims *TokenClaims) (string, error) {
+	data, err := sonic.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(payload), nil
+}
+
+// ParseToken 校验并解析网关令牌
+//   - {token} 令牌
+func ParseToken(token string) (*TokenClaims, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(sign(payload))) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims TokenClaims
+	if err := sonic.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
@@ -5,6 +5,7 @@ import (
 	dbtool "a1ctf/src/utils/db_tool"
 	"a1ctf/src/utils/zaphelper"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/hibiken/asynq"
 	"github.com/vmihailenco/msgpack/v5"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type FlagAntiCheatPayload struct {
@@ -26,7 +28,7 @@ func NewFlagAntiCheatTask(judge models.Judge) error {
 
 	task := asynq.NewTask(TypeAntiCheat, payload)
 	// taskID 是为了防止重复创建任务
-	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("flag_antiCheat_%d_%d_%d", judge.TeamID, judge.GameID, judge.ChallengeID)),
+	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("flag_antiCheat_%s", judge.JudgeID)),
 		asynq.MaxRetry(100),
 		asynq.Timeout(10*time.Second),
 	)
@@ -41,7 +43,26 @@ func HandleFlagAntiCheatTask(ctx context.Context, t *asynq.Task) error {
 	}
 
 	var judge models.Judge
-	dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", p.Judge.JudgeID).Preload("TeamFlag").Preload("Challenge").First(&judge)
+	if err := dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", p.Judge.JudgeID).Preload("TeamFlag").Preload("Challenge").Preload("Team").First(&judge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("judge %s not found: %w", p.Judge.JudgeID, asynq.SkipRetry)
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// 提交了别的队伍靶机里的蜜罐 flag, 静态 flag 的题目也能定位到泄露的队伍
+	var decoyContainer models.Container
+	if err := dbtool.DB().Model(&models.Container{}).Where("decoy_flag = ? AND team_id != ? AND game_id = ?", judge.JudgeContent, judge.TeamID, judge.GameID).Preload("Team").First(&decoyContainer).Error; err == nil {
+		cheat := newSolveCheat(&judge, models.CheatSubmitHoneypotFlag, models.CheatExtraData{
+			RelevantTeam:     decoyContainer.TeamID,
+			RelevantTeamName: decoyContainer.Team.TeamName,
+			Reason:           fmt.Sprintf("Submitted the decoy flag planted in container %s of the relevant team", decoyContainer.ContainerID),
+		})
+
+		if err := createCheatOnce(&cheat); err != nil {
+			zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", judge.GameID), zap.Any("cheat_data", cheat))
+		}
+	}
 
 	if judge.TeamFlag.FlagContent != judge.JudgeContent && judge.Challenge.FlagType == models.FlagTypeDynamic {
 		// 如果 flag 不一致，需要检查是否是别的队伍的 Flag
@@ -52,11 +73,11 @@ func HandleFlagAntiCheatTask(ctx context.Context, t *asynq.Task) error {
 				CheatID:     uuid.NewString(),
 				CheatType:   models.CheatSubmitSomeonesFlag,
 				GameID:      judge.GameID,
-				IngameID:    judge.IngameID,
-				ChallengeID: judge.ChallengeID,
+				IngameID:    &judge.IngameID,
+				ChallengeID: &judge.ChallengeID,
 				TeamID:      judge.TeamID,
 				FlagID:      &teamFlag.FlagID,
-				JudgeID:     judge.JudgeID,
+				JudgeID:     &judge.JudgeID,
 				SubmiterID:  judge.SubmiterID,
 				CheatTime:   judge.JudgeTime,
 				SubmiterIP:  judge.SubmiterIP,
@@ -66,13 +87,157 @@ func HandleFlagAntiCheatTask(ctx context.Context, t *asynq.Task) error {
 				},
 			}
 
-			if err := dbtool.DB().Create(cheat).Error; err != nil {
+			if err := createCheatOnce(&cheat); err != nil {
+				zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", judge.GameID), zap.Any("cheat_data", cheat))
+			}
+		}
+	}
+
+	if judge.Challenge.FlagType == models.FlagTypeDynamic {
+		// 每个靶机单独生成 flag 时，检查是否是别的队伍靶机里的 flag
+		var container models.Container
+		if err := dbtool.DB().Model(&models.Container{}).Where("container_flag = ? AND team_id != ? AND ingame_id = ?", judge.JudgeContent, judge.TeamID, judge.IngameID).Preload("Team").First(&container).Error; err == nil {
+			cheat := models.Cheat{
+				CheatID:     uuid.NewString(),
+				CheatType:   models.CheatSubmitSomeonesFlag,
+				GameID:      judge.GameID,
+				IngameID:    &judge.IngameID,
+				ChallengeID: &judge.ChallengeID,
+				TeamID:      judge.TeamID,
+				JudgeID:     &judge.JudgeID,
+				SubmiterID:  judge.SubmiterID,
+				CheatTime:   judge.JudgeTime,
+				SubmiterIP:  judge.SubmiterIP,
+				ExtraData: models.CheatExtraData{
+					RelevantTeam:     container.TeamID,
+					RelevantTeamName: container.Team.TeamName,
+				},
+			}
+
+			if err := createCheatOnce(&cheat); err != nil {
 				zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", judge.GameID), zap.Any("cheat_data", cheat))
 			}
 		}
 	}
 
-	// TODO 检查是否在未下载附件或者未启动靶机的情况下提交正确 flag
+	// 检查是否在未下载附件或者未启动靶机的情况下提交正确 flag
+	// 只检查真正产生解题记录的评测, 部分正确和重复解出的提交不再检查
+	if judge.JudgeStatus == models.JudgeAC && judge.Team.TeamType != models.TeamTypeAdmin {
+		var solveCount int64
+		if err := dbtool.DB().Model(&models.Solve{}).Where("judge_id = ? AND solve_status = ?", judge.JudgeID, models.SolveCorrect).Count(&solveCount).Error; err != nil {
+			return fmt.Errorf("failed to count solves: %w", err)
+		}
+		if solveCount == 0 {
+			return nil
+		}
+
+		if err := checkSolveWithoutDownload(&judge); err != nil {
+			return err
+		}
+
+		if err := checkSolveWithoutContainer(&judge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createCheatOnce 保存作弊记录, 同一个评测的同一种作弊只记录一次, 任务重试时不会重复插入
+func createCheatOnce(cheat *models.Cheat) error {
+	if cheat.JudgeID != nil {
+		var existCount int64
+		if err := dbtool.DB().Model(&models.Cheat{}).Where("judge_id = ? AND cheat_type = ?", *cheat.JudgeID, cheat.CheatType).Count(&existCount).Error; err != nil {
+			return err
+		}
+		if existCount > 0 {
+			return nil
+		}
+	}
+
+	return dbtool.DB().Create(cheat).Error
+}
+
+func newSolveCheat(judge *models.Judge, cheatType models.CheatType, extraData models.CheatExtraData) models.Cheat {
+	return models.Cheat{
+		CheatID:     uuid.NewString(),
+		CheatType:   cheatType,
+		GameID:      judge.GameID,
+		IngameID:    &judge.IngameID,
+		ChallengeID: &judge.ChallengeID,
+		TeamID:      judge.TeamID,
+		FlagID:      judge.FlagID,
+		JudgeID:     &judge.JudgeID,
+		SubmiterID:  judge.SubmiterID,
+		CheatTime:   judge.JudgeTime,
+		SubmiterIP:  judge.SubmiterIP,
+		ExtraData:   extraData,
+	}
+}
+
+// 题目有附件，但是队伍在提交前没有下载过任何一个附件
+// 只统计经过下载记录接口的附件，没有这样的附件时不检查
+func checkSolveWithoutDownload(judge *models.Judge) error {
+	trackedAttachments := 0
+	for _, attachment := range judge.Challenge.Attachments {
+		hasURL := attachment.AttachURL != nil && *attachment.AttachURL != ""
+		hasStaticFile := attachment.AttachType == models.AttachmentTypeStaticFile && attachment.AttachHash != nil && *attachment.AttachHash != ""
+		if hasURL || hasStaticFile {
+			trackedAttachments++
+		}
+	}
+	if trackedAttachments == 0 {
+		return nil
+	}
+
+	var downloadCount int64
+	if err := dbtool.DB().Model(&models.AttachmentDownload{}).Where("team_id = ? AND ingame_id = ? AND download_time <= ?", judge.TeamID, judge.IngameID, judge.JudgeTime).Count(&downloadCount).Error; err != nil {
+		return fmt.Errorf("failed to count attachment downloads: %w", err)
+	}
+
+	if downloadCount > 0 {
+		return nil
+	}
+
+	attachments := make([]string, 0, len(judge.Challenge.Attachments))
+	for _, attachment := range judge.Challenge.Attachments {
+		attachments = append(attachments, attachment.AttachName)
+	}
+
+	cheat := newSolveCheat(judge, models.CheatSubmitWithoutDownloadAttachments, models.CheatExtraData{
+		Reason:      "Correct flag submitted before the team downloaded any attachment of this challenge",
+		Attachments: attachments,
+	})
+
+	if err := createCheatOnce(&cheat); err != nil {
+		zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", judge.GameID), zap.Any("cheat_data", cheat))
+	}
+
+	return nil
+}
+
+// 动态容器的题目，队伍在提交前从来没有启动过靶机
+func checkSolveWithoutContainer(judge *models.Judge) error {
+	if judge.Challenge.ContainerType != models.DYNAMIC_CONTAINER {
+		return nil
+	}
+
+	var containerCount int64
+	if err := dbtool.DB().Model(&models.Container{}).Where("team_id = ? AND ingame_id = ? AND start_time <= ?", judge.TeamID, judge.IngameID, judge.JudgeTime).Count(&containerCount).Error; err != nil {
+		return fmt.Errorf("failed to count containers: %w", err)
+	}
+
+	if containerCount > 0 {
+		return nil
+	}
+
+	cheat := newSolveCheat(judge, models.CheatSubmitWithoutStartContainer, models.CheatExtraData{
+		Reason: "Correct flag submitted for a dynamic container challenge the team never launched",
+	})
+
+	if err := createCheatOnce(&cheat); err != nil {
+		zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", judge.GameID), zap.Any("cheat_data", cheat))
+	}
 
 	return nil
 }
@@ -12,12 +12,12 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 	"go.uber.org/zap"
 
-	dockertool "a1ctf/src/utils/docker_tool"
+	containerbackend "a1ctf/src/modules/container_backend"
 )
 
 type ContainerFailedPayload struct {
 	Container       models.Container
-	ContainerStatus dockertool.ContainerStatusDecision
+	ContainerStatus containerbackend.InstanceStatusDecision
 }
 
 func NewContainerStartTask(data models.Container) error {
@@ -42,7 +42,7 @@ func NewContainerStopTask(data models.Container) error {
 	return err
 }
 
-func NewContainerFailedTask(data models.Container, containerStatus dockertool.ContainerStatusDecision) error {
+func NewContainerFailedTask(data models.Container, containerStatus containerbackend.InstanceStatusDecision) error {
 	payload, err := msgpack.Marshal(ContainerFailedPayload{
 		Container:       data,
 		ContainerStatus: containerStatus,
@@ -62,21 +62,52 @@ func HandleContainerStartTask(ctx context.Context, t *asynq.Task) error {
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
 	}
 
-	containerInfo := dockertool.ContainerInfo{
-		Name:       fmt.Sprintf("cl-%d-%s", task.InGameID, task.TeamHash),
-		TeamHash:   task.TeamHash,
-		Containers: task.ContainerConfig,
-		Labels: map[string]string{
-			"team_hash":     task.TeamHash,
-			"ingame_id":     fmt.Sprintf("%d", task.InGameID),
-			"a1ctf.managed": "true",
-		},
-		Flag:     task.TeamFlag.FlagContent,
-		AllowWAN: task.Challenge.AllowWAN,
-		AllowDNS: task.Challenge.AllowDNS,
+	if containerbackend.Backend.NeedHostPorts() {
+		allocatedPorts, err := containerbackend.AllocateHostPorts(&task)
+		if err != nil {
+			LogContainerOperation(nil, nil, models.ActionContainerStarting, task.ContainerID, map[string]interface{}{
+				"team_hash":    task.TeamHash,
+				"ingame_id":    task.InGameID,
+				"container_id": task.ContainerID,
+			}, err)
+			zaphelper.Logger.Error("AllocateHostPorts", zap.Error(err), zap.Any("task", task))
+			// 强制关闭
+			dbtool.DB().Model(&task).Update("container_status", models.ContainerStopping)
+			return fmt.Errorf("AllocateHostPorts %+v error: %v", task, err)
+		}
+		task.AllocatedPorts = allocatedPorts
 	}
 
-	err := dockertool.CreateContainer(&containerInfo)
+	containerInfo := containerbackend.NewInstanceInfo(&task)
+
+	// 多段 flag 题目的动态子 flag 以 A1CTF_FLAG_<NAME> 注入
+	subFlags, err := EnsureTeamSubFlags(task.TeamID, task.InGameID)
+	if err != nil {
+		LogContainerOperation(nil, nil, models.ActionContainerStarting, task.ContainerID, map[string]interface{}{
+			"team_hash":    task.TeamHash,
+			"ingame_id":    task.InGameID,
+			"container_id": task.ContainerID,
+		}, err)
+		dbtool.DB().Model(&task).Update("container_status", models.ContainerStopping)
+		return fmt.Errorf("EnsureTeamSubFlags %+v error: %v", task, err)
+	}
+	containerInfo.SubFlags = subFlags
+
+	// 蜜罐 flag 按题目配置放入环境变量或者文件
+	if task.DecoyFlag != nil {
+		var gameChallenge models.GameChallenge
+		if err := dbtool.DB().Where("ingame_id = ?", task.InGameID).First(&gameChallenge).Error; err != nil {
+			dbtool.DB().Model(&task).Update("container_status", models.ContainerStopping)
+			return fmt.Errorf("load game challenge %+v error: %v", task, err)
+		}
+		if gameChallenge.JudgeConfig != nil && gameChallenge.JudgeConfig.Honeypot != nil {
+			containerInfo.DecoyFlag = *task.DecoyFlag
+			containerInfo.DecoyEnv = gameChallenge.JudgeConfig.Honeypot.EnvName
+			containerInfo.DecoyFile = gameChallenge.JudgeConfig.Honeypot.FilePath
+		}
+	}
+
+	err = containerbackend.Backend.CreateInstance(containerInfo)
 	if err != nil {
 		// 记录容器创建失败日志
 		LogContainerOperation(nil, nil, models.ActionContainerStarting, task.ContainerID, map[string]interface{}{
@@ -111,20 +142,9 @@ func HandleContainerStopTask(ctx context.Context, t *asynq.Task) error {
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
 	}
 
-	containerInfo := dockertool.ContainerInfo{
-		Name:       fmt.Sprintf("cl-%d-%s", task.InGameID, task.TeamHash),
-		TeamHash:   task.TeamHash,
-		Containers: task.ContainerConfig,
-		Labels: map[string]string{
-			"team_hash": task.TeamHash,
-			"ingame_id": fmt.Sprintf("%d", task.InGameID),
-		},
-		Flag:     task.TeamFlag.FlagContent,
-		AllowWAN: task.Challenge.AllowWAN,
-		AllowDNS: task.Challenge.AllowDNS,
-	}
+	containerInfo := containerbackend.NewInstanceInfo(&task)
 
-	err := dockertool.DeleteContainer(&containerInfo)
+	err := containerbackend.Backend.DeleteInstance(containerInfo)
 	if err != nil {
 		LogContainerOperation(nil, nil, models.ActionContainerStopping, task.ContainerID, map[string]interface{}{
 			"team_hash":      task.TeamHash,
@@ -136,6 +156,7 @@ func HandleContainerStopTask(ctx context.Context, t *asynq.Task) error {
 	} else {
 		if err := dbtool.DB().Model(&task).Updates(map[string]interface{}{
 			"container_status": models.ContainerStopped,
+			"allocated_ports":  make(models.AllocatedPorts, 0),
 		}).Error; err != nil {
 			LogContainerOperation(nil, nil, models.ActionContainerStarting, task.ContainerID, map[string]interface{}{
 				"team_hash":      task.TeamHash,
@@ -166,20 +187,9 @@ func HandleContainerFailedTask(ctx context.Context, t *asynq.Task) error {
 	task := payload.Container
 	containerStatus := payload.ContainerStatus
 
-	containerInfo := dockertool.ContainerInfo{
-		Name:       fmt.Sprintf("cl-%d-%s", task.InGameID, task.TeamHash),
-		TeamHash:   task.TeamHash,
-		Containers: task.ContainerConfig,
-		Labels: map[string]string{
-			"team_hash": task.TeamHash,
-			"ingame_id": fmt.Sprintf("%d", task.InGameID),
-		},
-		Flag:     task.TeamFlag.FlagContent,
-		AllowWAN: task.Challenge.AllowWAN,
-		AllowDNS: task.Challenge.AllowDNS,
-	}
+	containerInfo := containerbackend.NewInstanceInfo(&task)
 
-	err := dockertool.DeleteContainer(&containerInfo)
+	err := containerbackend.Backend.DeleteInstance(containerInfo)
 	if err != nil {
 		LogContainerOperation(nil, nil, models.ActionContainerFailed, task.ContainerID, map[string]interface{}{
 			"team_hash":      task.TeamHash,
@@ -191,6 +201,7 @@ func HandleContainerFailedTask(ctx context.Context, t *asynq.Task) error {
 	} else {
 		if err := dbtool.DB().Model(&task).Updates(map[string]interface{}{
 			"container_status": models.ContainerError,
+			"allocated_ports":  make(models.AllocatedPorts, 0),
 		}).Error; err != nil {
 			LogContainerOperation(nil, nil, models.ActionContainerFailed, task.ContainerID, map[string]interface{}{
 				"team_hash":      task.TeamHash,
@@ -16,6 +16,7 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateTeamFlagPayload struct {
@@ -100,3 +101,62 @@ func HandleTeamCreateTask(ctx context.Context, t *asynq.Task) error {
 
 	return fmt.Errorf("failed to create flag: %w", err)
 }
+
+// 生成队伍在多段 flag 题目中的动态子 flag，已经生成过的不会重新生成，返回子 flag 名称到 flag 的映射
+func EnsureTeamSubFlags(teamID int64, ingameID int64) (map[string]string, error) {
+	var gameChallenge models.GameChallenge
+	if err := dbtool.DB().Where("ingame_id = ?", ingameID).First(&gameChallenge).Error; err != nil {
+		return nil, fmt.Errorf("failed to load game challenge: %w", err)
+	}
+
+	result := make(map[string]string)
+	if gameChallenge.JudgeConfig == nil || len(gameChallenge.JudgeConfig.SubFlags) == 0 {
+		return result, nil
+	}
+
+	var team models.Team
+	if err := dbtool.DB().Where("team_id = ?", teamID).First(&team).Error; err != nil {
+		return nil, fmt.Errorf("failed to load team: %w", err)
+	}
+
+	newSubFlags := make([]models.TeamSubFlag, 0)
+	for _, subFlag := range gameChallenge.JudgeConfig.SubFlags {
+		if subFlag.FlagType != models.FlagTypeDynamic {
+			continue
+		}
+
+		newSubFlags = append(newSubFlags, models.TeamSubFlag{
+			TeamID:   teamID,
+			IngameID: ingameID,
+			SubFlag:  subFlag.Name,
+			GameID:   gameChallenge.GameID,
+			FlagContent: general.ProcessFlag(subFlag.FlagTemplate, map[string]string{
+				"team_id":      fmt.Sprintf("%d", teamID),
+				"game_id":      fmt.Sprintf("%d", gameChallenge.GameID),
+				"challenge_id": fmt.Sprintf("%d", gameChallenge.ChallengeID),
+				"team_hash":    team.TeamHash,
+				"team_name":    team.TeamName,
+			}, true),
+		})
+	}
+
+	if len(newSubFlags) == 0 {
+		return result, nil
+	}
+
+	// 已经存在的子 flag 保持不变
+	if err := dbtool.DB().Clauses(clause.OnConflict{DoNothing: true}).Create(&newSubFlags).Error; err != nil {
+		return nil, fmt.Errorf("failed to create sub flags: %w", err)
+	}
+
+	var teamSubFlags []models.TeamSubFlag
+	if err := dbtool.DB().Where("team_id = ? AND ingame_id = ?", teamID, ingameID).Find(&teamSubFlags).Error; err != nil {
+		return nil, fmt.Errorf("failed to load sub flags: %w", err)
+	}
+
+	for _, teamSubFlag := range teamSubFlags {
+		result[teamSubFlag.SubFlag] = teamSubFlag.FlagContent
+	}
+
+	return result, nil
+}
@@ -0,0 +1,498 @@
+package tasks
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
+	noticetool "a1ctf/src/utils/notice_tool"
+	"a1ctf/src/utils/zaphelper"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 计算解题排名时使用的 advisory lock 类别，和 ingame_id 组成 (int4, int4) 形式的锁，
+// 与单个 bigint 形式的锁不在同一个空间，不会和端口分配的锁冲突
+const solveRankLockClass int32 = 0x61316a64
+
+type JudgeFlagPayload struct {
+	JudgeID string
+}
+
+func NewJudgeFlagTask(judge models.Judge) error {
+	payload, err := msgpack.Marshal(JudgeFlagPayload{JudgeID: judge.JudgeID})
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeJudgeFlag, payload)
+	// taskID 是为了防止同一个评测被重复入队
+	_, err = client.Enqueue(task, asynq.TaskID(judgeFlagTaskID(judge.JudgeID)),
+		asynq.Queue("critical"),
+		asynq.MaxRetry(5),
+		asynq.Timeout(2*time.Minute),
+	)
+
+	return err
+}
+
+func judgeFlagTaskID(judgeID string) string {
+	return fmt.Sprintf("judge_flag_%s", judgeID)
+}
+
+// RequeueJudgeFlagTask 重新入队卡住的评测
+// 重试次数用完的任务会被归档并继续占用 TaskID, 需要先删除归档的任务
+func RequeueJudgeFlagTask(judge models.Judge) error {
+	err := NewJudgeFlagTask(judge)
+	if !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return err
+	}
+
+	info, err := inspector.GetTaskInfo("critical", judgeFlagTaskID(judge.JudgeID))
+	if err != nil {
+		return err
+	}
+
+	// 任务还在队列里, 等待它被处理即可
+	if info.State != asynq.TaskStateArchived {
+		return asynq.ErrTaskIDConflict
+	}
+
+	if err := inspector.DeleteTask("critical", info.ID); err != nil {
+		return err
+	}
+
+	return NewJudgeFlagTask(judge)
+}
+
+// LockSolveRank 在事务内锁住一道题的排名, 和评测插入解题记录时使用同一把锁
+func LockSolveRank(tx *gorm.DB, ingameID int64) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", solveRankLockClass, int32(ingameID)).Error
+}
+
+// ReRankSolves 按解题时间重新计算一道题剩余正确解题记录的排名, 调用前需要先 LockSolveRank
+func ReRankSolves(tx *gorm.DB, ingameID int64) error {
+	return tx.Exec(`UPDATE solves SET rank = ranked.new_rank
+		FROM (
+			SELECT solve_id, ROW_NUMBER() OVER (ORDER BY solve_time ASC, solve_id ASC) AS new_rank
+			FROM solves WHERE ingame_id = ? AND solve_status = ?
+		) AS ranked
+		WHERE solves.solve_id = ranked.solve_id AND solves.rank <> ranked.new_rank`,
+		ingameID, models.SolveCorrect).Error
+}
+
+// 最后一次重试也失败时把评测标记为错误, 否则选手会一直看到评测中
+func markJudgeErrorAfterRetries(ctx context.Context, judgeID string) {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	if retried < maxRetry {
+		return
+	}
+
+	result := dbtool.DB().Model(&models.Judge{}).
+		Where("judge_id = ? AND judge_status IN ?", judgeID, []models.JudgeStatus{models.JudgeQueueing, models.JudgeRunning}).
+		Update("judge_status", models.JudgeError)
+	if result.Error != nil {
+		zaphelper.Logger.Error("Failed to mark judge as error", zap.Error(result.Error), zap.String("judge_id", judgeID))
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	var judge models.Judge
+	if err := dbtool.DB().Where("judge_id = ?", judgeID).First(&judge).Error; err == nil {
+		noticetool.PushJudgeResult(judge)
+	}
+
+	zaphelper.Logger.Warn("Judge failed after all retries", zap.String("judge_id", judgeID))
+}
+
+func HandleJudgeFlagTask(ctx context.Context, t *asynq.Task) (err error) {
+	var p JudgeFlagPayload
+	if err := msgpack.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	defer func() {
+		if err != nil && !errors.Is(err, asynq.SkipRetry) {
+			markJudgeErrorAfterRetries(ctx, p.JudgeID)
+		}
+	}()
+
+	var judge models.Judge
+	if err := dbtool.DB().Where("judge_id = ?", p.JudgeID).Preload("TeamFlag").Preload("GameChallenge").Preload("Challenge").Preload("Team").First(&judge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("judge %s not found: %w", p.JudgeID, asynq.SkipRetry)
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// 已经评测过的直接跳过，恢复任务可能会把同一个评测再次入队
+	if judge.JudgeStatus != models.JudgeQueueing && judge.JudgeStatus != models.JudgeRunning {
+		return nil
+	}
+
+	judge.JudgeStatus = models.JudgeRunning
+	if err := dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", judge.JudgeID).Update("judge_status", judge.JudgeStatus).Error; err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if err := processQueueingJudge(&judge); err != nil {
+		zaphelper.Logger.Error("Judge task failed", zap.Error(err), zap.Any("judge", judge))
+	}
+
+	if err := dbtool.DB().Save(&judge).Error; err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	noticetool.PushJudgeResult(judge)
+
+	// 评测完成后再检查作弊，需要用到评测结果
+	if err := NewFlagAntiCheatTask(judge); err != nil {
+		zaphelper.Logger.Error("Failed to enqueue anti cheat task", zap.Error(err), zap.String("judge_id", judge.JudgeID))
+	}
+
+	return nil
+}
+
+// 判题正确后插入解题记录，并处理三血公告
+func acceptJudge(judge *models.Judge) error {
+	// 如果是系统管理员队伍，不插入 Solves，防止影响积分榜
+	if judge.Team.TeamType == models.TeamTypeAdmin {
+		judge.JudgeStatus = models.JudgeAC
+		return nil
+	}
+
+	newSolve := models.Solve{
+		IngameID:    judge.IngameID,
+		JudgeID:     judge.JudgeID,
+		SolveID:     uuid.NewString(),
+		GameID:      judge.GameID,
+		ChallengeID: judge.ChallengeID,
+		TeamID:      judge.TeamID,
+		SolveStatus: models.SolveCorrect,
+		SolveTime:   time.Now().UTC(),
+		SolverID:    judge.SubmiterID,
+		ContainerID: judge.ContainerID,
+	}
+
+	alreadySolved := false
+
+	// 同一道题的排名计算和插入在 advisory lock 内完成，同时到达的正确提交不会拿到相同的排名
+	err := dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		if err := LockSolveRank(tx, judge.IngameID); err != nil {
+			return err
+		}
+
+		var teamSolves int64
+		if err := tx.Model(&models.Solve{}).Where("game_id = ? AND challenge_id = ? AND team_id = ?", judge.GameID, judge.ChallengeID, judge.TeamID).Count(&teamSolves).Error; err != nil {
+			return err
+		}
+
+		// 队伍的多个正确提交同时在评测，只记录第一个
+		if teamSolves > 0 {
+			alreadySolved = true
+			return nil
+		}
+
+		var solveCount int64
+		if err := tx.Model(&models.Solve{}).Where("game_id = ? AND challenge_id = ?", judge.GameID, judge.ChallengeID).Count(&solveCount).Error; err != nil {
+			return err
+		}
+
+		newSolve.Rank = int32(solveCount + 1)
+		return tx.Create(&newSolve).Error
+	})
+
+	if err != nil {
+		judge.JudgeStatus = models.JudgeError
+		LogJudgeOperation(nil, nil, models.ActionJudge, judge.JudgeID, map[string]interface{}{
+			"team_id": judge.TeamID,
+			"game_id": judge.GameID,
+			"judge":   judge,
+		}, err)
+		return fmt.Errorf("database error: %w data: %+v", err, judge)
+	}
+
+	if alreadySolved {
+		judge.JudgeStatus = models.JudgeAC
+		return nil
+	}
+
+	if newSolve.Rank <= 3 {
+		var solveDetail = models.Solve{}
+
+		if err := dbtool.DB().Where("solve_id = ?", newSolve.SolveID).Preload("Challenge").Preload("Team").First(&solveDetail).Error; err != nil {
+			zaphelper.Logger.Error("Announce first blood error", zap.Error(err))
+		}
+
+		var noticeCate models.NoticeCategory
+
+		// 现在由算分逻辑计算三血分数，不使用 score-adjustment
+		// var rewardScore float64
+		// var rewardReason string
+
+		if newSolve.Rank == 1 {
+			noticeCate = models.NoticeFirstBlood
+		} else if newSolve.Rank == 2 {
+			noticeCate = models.NoticeSecondBlood
+		} else {
+			noticeCate = models.NoticeThirdBlood
+		}
+
+		// rewardReason = fmt.Sprintf("%s for %s", rewardReason, judge.Challenge.Name)
+
+		// adjustment := models.ScoreAdjustment{
+		// 	TeamID:         judge.TeamID,
+		// 	GameID:         judge.GameID,
+		// 	AdjustmentType: models.AdjustmentTypeReward,
+		// 	ScoreChange:    rewardScore,
+		// 	Reason:         rewardReason,
+		// 	CreatedBy:      uuid.MustParse(judge.SubmiterID),
+		// 	CreatedAt:      time.Now().UTC(),
+		// 	UpdatedAt:      time.Now().UTC(),
+		// }
+
+		// if err := dbtool.DB().Create(&adjustment).Error; err != nil {
+		// 	tasks.LogJudgeOperation(nil, nil, models.ActionJudge, judge.JudgeID, map[string]interface{}{
+		// 		"team_id":      judge.TeamID,
+		// 		"game_id":      judge.GameID,
+		// 		"score_change": adjustment.ScoreChange,
+		// 	}, err)
+		// }
+
+		// 封榜期间不公告三血, 避免暴露封榜后的解题
+		var game models.Game
+		if err := dbtool.DB().Where("game_id = ?", judge.GameID).First(&game).Error; err != nil {
+			zaphelper.Logger.Error("Load game for blood notice error", zap.Error(err))
+		} else if !game.ScoreboardFrozen(time.Now().UTC()) {
+			go func() {
+				noticetool.InsertNotice(judge.GameID, noticeCate, []string{solveDetail.Team.TeamName, solveDetail.Challenge.Name})
+			}()
+		}
+	}
+
+	judge.JudgeStatus = models.JudgeAC
+	return nil
+}
+
+// 使用评测脚本判题，题目内的配置优先于题库中的配置
+func processScriptJudge(judge *models.Judge) error {
+	var script *string
+	if judge.GameChallenge.JudgeConfig != nil && judge.GameChallenge.JudgeConfig.JudgeScript != nil {
+		script = judge.GameChallenge.JudgeConfig.JudgeScript
+	} else if judge.Challenge.JudgeConfig != nil && judge.Challenge.JudgeConfig.JudgeScript != nil {
+		script = judge.Challenge.JudgeConfig.JudgeScript
+	}
+
+	if script == nil {
+		judge.JudgeStatus = models.JudgeError
+		return fmt.Errorf("judge script not found for challenge %d", judge.ChallengeID)
+	}
+
+	teamFlag, err := dynamicFlagForJudge(judge)
+	if err != nil {
+		judge.JudgeStatus = models.JudgeError
+		return err
+	}
+
+	result, err := judgetool.RunCheckerScript(*script, &judgetool.ScriptJudgeContext{
+		JudgeID:     judge.JudgeID,
+		Content:     judge.JudgeContent,
+		GameID:      judge.GameID,
+		ChallengeID: judge.ChallengeID,
+		IngameID:    judge.IngameID,
+		TeamID:      judge.TeamID,
+		TeamHash:    judge.Team.TeamHash,
+		TeamName:    judge.Team.TeamName,
+		SubmiterID:  judge.SubmiterID,
+		TeamFlag:    teamFlag,
+	})
+	if err != nil {
+		judge.JudgeStatus = models.JudgeError
+		LogJudgeOperation(nil, nil, models.ActionJudge, judge.JudgeID, map[string]interface{}{
+			"team_id":      judge.TeamID,
+			"game_id":      judge.GameID,
+			"challenge_id": judge.ChallengeID,
+		}, err)
+		return fmt.Errorf("judge script error: %w", err)
+	}
+
+	judge.JudgeResult = result.Message
+
+	switch result.Verdict {
+	case judgetool.ScriptVerdictAC:
+		return acceptJudge(judge)
+	case judgetool.ScriptVerdictWA:
+		judge.JudgeStatus = models.JudgeWA
+		return nil
+	case judgetool.ScriptVerdictTimeout:
+		judge.JudgeStatus = models.JudgeTimeout
+		return nil
+	default:
+		judge.JudgeStatus = models.JudgeError
+		return fmt.Errorf("unknown script verdict: %s", result.Verdict)
+	}
+}
+
+// 获取这次评测对应的动态 flag，题目开启了每个靶机单独生成 flag 时，
+// 使用队伍最近一次启动的靶机的 flag，并记录到 judge.ContainerID 上，没有启动过靶机时返回空字符串
+func dynamicFlagForJudge(judge *models.Judge) (string, error) {
+	if judge.GameChallenge.JudgeConfig == nil || !judge.GameChallenge.JudgeConfig.PerContainerFlag {
+		return judge.TeamFlag.FlagContent, nil
+	}
+
+	var container models.Container
+	if err := dbtool.DB().Where("team_id = ? AND ingame_id = ? AND container_flag IS NOT NULL", judge.TeamID, judge.IngameID).Order("start_time DESC").First(&container).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	judge.ContainerID = &container.ContainerID
+	return *container.ContainerFlag, nil
+}
+
+// 多段 flag 的评测，提交和任意一个子 flag 匹配就记录下来，全部子 flag 都提交后按照正常解题处理，
+// 血奖也只在完整解出时计算
+func processSubFlagJudge(judge *models.Judge) error {
+	config := judge.GameChallenge.JudgeConfig
+
+	// 没有靶机的题目不会在启动靶机时生成子 flag, 这里补上
+	dynamicSubFlags, err := EnsureTeamSubFlags(judge.TeamID, judge.IngameID)
+	if err != nil {
+		judge.JudgeStatus = models.JudgeError
+		return err
+	}
+
+	var matched *models.SubFlagConfig
+	for i, subFlag := range config.SubFlags {
+		switch subFlag.FlagType {
+		case models.FlagTypeDynamic:
+			if flag, ok := dynamicSubFlags[subFlag.Name]; ok && flag == judge.JudgeContent {
+				matched = &config.SubFlags[i]
+			}
+		case models.FlagTypeStatic:
+			if judgetool.MatchStaticSubFlag(config, subFlag, judge.JudgeContent) {
+				matched = &config.SubFlags[i]
+			}
+		}
+
+		if matched != nil {
+			break
+		}
+	}
+
+	if matched == nil {
+		judge.JudgeStatus = models.JudgeWA
+		return nil
+	}
+
+	// 管理员队伍不记录解题
+	if judge.Team.TeamType == models.TeamTypeAdmin {
+		judge.JudgeStatus = models.JudgeAC
+		judge.JudgeResult = fmt.Sprintf("Sub flag %s accepted", matched.Name)
+		return nil
+	}
+
+	subFlagSolve := models.SubFlagSolve{
+		TeamID:      judge.TeamID,
+		IngameID:    judge.IngameID,
+		SubFlag:     matched.Name,
+		GameID:      judge.GameID,
+		ChallengeID: judge.ChallengeID,
+		JudgeID:     judge.JudgeID,
+		SolverID:    judge.SubmiterID,
+		ContainerID: judge.ContainerID,
+		SolveTime:   time.Now().UTC(),
+	}
+
+	alreadySubmitted := false
+	var solvedSubFlags []string
+
+	err = dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		if err := LockSolveRank(tx, judge.IngameID); err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&subFlagSolve)
+		if result.Error != nil {
+			return result.Error
+		}
+		alreadySubmitted = result.RowsAffected == 0
+
+		return tx.Model(&models.SubFlagSolve{}).Where("team_id = ? AND ingame_id = ?", judge.TeamID, judge.IngameID).Pluck("sub_flag", &solvedSubFlags).Error
+	})
+
+	if err != nil {
+		judge.JudgeStatus = models.JudgeError
+		return fmt.Errorf("database error: %w data: %+v", err, judge)
+	}
+
+	if alreadySubmitted {
+		judge.JudgeStatus = models.JudgeWA
+		judge.JudgeResult = fmt.Sprintf("Sub flag %s has already been submitted", matched.Name)
+		return nil
+	}
+
+	if models.SubFlagCreditRatio(config, solvedSubFlags) >= 1 {
+		judge.JudgeResult = fmt.Sprintf("Sub flag %s accepted, all %d parts completed", matched.Name, len(config.SubFlags))
+		return acceptJudge(judge)
+	}
+
+	judge.JudgeStatus = models.JudgePartialAC
+	judge.JudgeResult = fmt.Sprintf("Sub flag %s accepted (%d/%d)", matched.Name, len(solvedSubFlags), len(config.SubFlags))
+	return nil
+}
+
+func processQueueingJudge(judge *models.Judge) error {
+	switch judge.JudgeType {
+	case models.JudgeTypeDynamic:
+		if judge.GameChallenge.JudgeConfig != nil && len(judge.GameChallenge.JudgeConfig.SubFlags) > 0 {
+			return processSubFlagJudge(judge)
+		}
+
+		flagCorrect := false
+
+		switch judge.Challenge.FlagType {
+		case models.FlagTypeDynamic:
+			// 动态和TeamFlag库里的比较，每个靶机单独生成 flag 时和队伍最近启动的靶机比较
+			teamFlag, err := dynamicFlagForJudge(judge)
+			if err != nil {
+				judge.JudgeStatus = models.JudgeError
+				return err
+			}
+			flagCorrect = teamFlag != "" && judge.JudgeContent == teamFlag
+		case models.FlagTypeStatic:
+			// 静态按照配置匹配多个答案和正则表达式
+			matched, err := judgetool.MatchStaticFlag(judge.GameChallenge.JudgeConfig, judge.JudgeContent)
+			if err != nil {
+				judge.JudgeStatus = models.JudgeError
+				return err
+			}
+			flagCorrect = matched
+		}
+
+		if flagCorrect {
+			return acceptJudge(judge)
+		} else {
+			judge.JudgeStatus = models.JudgeWA
+			return nil
+		}
+	case models.JudgeTypeScript:
+		return processScriptJudge(judge)
+	default:
+		judge.JudgeStatus = models.JudgeError
+		return fmt.Errorf("unknown judge type: %s", judge.JudgeType)
+	}
+}
@@ -56,6 +56,7 @@ func InitTaskQueue() {
 		mux.HandleFunc(TypeStopContainer, HandleContainerStopTask)
 		mux.HandleFunc(TypeContainerFailedOperation, HandleContainerFailedTask)
 
+		mux.HandleFunc(TypeJudgeFlag, HandleJudgeFlagTask)
 		mux.HandleFunc(TypeAntiCheat, HandleFlagAntiCheatTask)
 		mux.HandleFunc(TypeSendMail, HandleSendMailTask)
 
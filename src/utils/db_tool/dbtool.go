@@ -22,10 +22,17 @@ import (
 var db *gorm.DB
 var redis_instance *redis.Client
 var ml *melody.Melody
-var gameSessions map[*melody.Session]int64 = make(map[*melody.Session]int64)
+var gameSessions map[*melody.Session]GameSession = make(map[*melody.Session]GameSession)
 var gameSessionsMutex sync.RWMutex
 var ctx = context.Background()
 
+// GameSession 记录一个 /api/hub 连接所属的比赛、队伍和用户，TeamID 为 0 表示用户在该比赛中没有队伍
+type GameSession struct {
+	GameID int64
+	TeamID int64
+	UserID string
+}
+
 func DB() *gorm.DB {
 	return db
 }
@@ -87,7 +94,7 @@ func Init() {
 	// Init melody
 	ml = melody.New()
 
-	gameSessions = make(map[*melody.Session]int64)
+	gameSessions = make(map[*melody.Session]GameSession)
 
 	ml.HandleConnect(func(s *melody.Session) {
 		// 从会话keys中获取gameID
@@ -103,8 +110,20 @@ func Init() {
 			return
 		}
 
+		gameSession := GameSession{
+			GameID: gameID,
+		}
+
+		if userID, ok := s.Get("userID"); ok {
+			gameSession.UserID, _ = userID.(string)
+		}
+
+		if teamID, ok := s.Get("teamID"); ok {
+			gameSession.TeamID, _ = teamID.(int64)
+		}
+
 		gameSessionsMutex.Lock()
-		gameSessions[s] = gameID
+		gameSessions[s] = gameSession
 		gameSessionsMutex.Unlock()
 
 		s.Write([]byte("{ \"status\": \"connected\" }"))
@@ -121,12 +140,12 @@ func Init() {
 	})
 }
 
-func GameSessions() map[*melody.Session]int64 {
+func GameSessions() map[*melody.Session]GameSession {
 	gameSessionsMutex.RLock()
 	defer gameSessionsMutex.RUnlock()
 
 	// 返回一个拷贝以避免外部修改
-	result := make(map[*melody.Session]int64)
+	result := make(map[*melody.Session]GameSession)
 	for k, v := range gameSessions {
 		result[k] = v
 	}
@@ -0,0 +1,41 @@
+package dockertool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// WatchContainerEvents 订阅平台管理的容器的状态变化事件, 阻塞直到 ctx 结束或者连接断开
+func WatchContainerEvents(ctx context.Context, handler func(message events.Message)) error {
+	cli, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	messages, errs := cli.Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("label", "a1ctf.managed"),
+			filters.Arg("event", string(events.ActionStart)),
+			filters.Arg("event", string(events.ActionDie)),
+			filters.Arg("event", string(events.ActionOOM)),
+			filters.Arg("event", string(events.ActionDestroy)),
+		),
+	})
+
+	for {
+		select {
+		case message := <-messages:
+			handler(message)
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("docker events stream closed: %v", err)
+		}
+	}
+}
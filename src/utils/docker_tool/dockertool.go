@@ -2,21 +2,27 @@ package dockertool
 
 import (
 	"a1ctf/src/utils/zaphelper"
+	"archive/tar"
+	"bytes"
 	"context"
 	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -70,7 +76,15 @@ func ValidContainerConfig(containers []A1Container) error {
 	_ = validate.RegisterValidation("dns_label", validateDNSLabel)
 	_ = validate.RegisterValidation("portname", validatePortName)
 
+	containerNames := make(map[string]bool)
+
 	for _, container := range containers {
+		// 容器名称同时是实例网络内的主机名, 不能重复
+		if containerNames[container.Name] {
+			return fmt.Errorf("duplicate container name %s", container.Name)
+		}
+		containerNames[container.Name] = true
+
 		err := validate.Struct(container)
 		if err != nil {
 			// 处理验证错误
@@ -112,12 +126,30 @@ type ContainerInfo struct {
 	Flag       string
 	AllowWAN   bool
 	AllowDNS   bool
+	// 多段 flag 题目的动态子 flag, 以 A1CTF_FLAG_<NAME> 注入
+	SubFlags map[string]string
+	// 蜜罐 flag, 注入到 DecoyEnv 环境变量, 或者在启动前写入 DecoyFile 文件
+	DecoyFlag string
+	DecoyEnv  string
+	DecoyFile string
+	// 预先分配的宿主机端口, key 为 HostPortKey
+	HostPorts map[string]int32
+}
+
+// 子 flag 注入到容器中的环境变量名
+func SubFlagEnvName(name string) string {
+	return "A1CTF_FLAG_" + strings.ToUpper(name)
+}
+
+func HostPortKey(containerName string, port int32) string {
+	return fmt.Sprintf("%s/%d", containerName, port)
 }
 
 type ContainerPort struct {
-	Name     string
-	Port     int32
-	HostPort int32
+	Name        string
+	ServiceName string
+	Port        int32
+	HostPort    int32
 }
 
 type ContainerPorts []ContainerPort
@@ -160,6 +192,27 @@ func ListContainers() ([]types.Container, error) {
 	return a1ctfContainers, nil
 }
 
+// ListInstanceContainers 列出一个实例的所有容器
+func ListInstanceContainers(containerName string) ([]types.Container, error) {
+	cli, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", "a1ctf.managed"),
+			filters.Arg("label", fmt.Sprintf("a1ctf.container_name=%s", containerName)),
+		),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %v", err)
+	}
+
+	return containers, nil
+}
+
 func CreateContainer(containerInfo *ContainerInfo) error {
 	cli, err := GetClient()
 	if err != nil {
@@ -168,12 +221,21 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 
 	ctx := context.Background()
 
-	// Create network if it doesn't exist
-	networkName := "a1ctf-challenges"
-	if err := createNetworkIfNotExists(cli, ctx, networkName); err != nil {
+	// 每个实例使用独立的网络
+	networkName := containerInfo.Name
+	if err := createInstanceNetwork(cli, ctx, containerInfo); err != nil {
 		return fmt.Errorf("error creating network: %v", err)
 	}
 
+	// 不允许出网的实例由转发容器发布端口, 题目容器本身不绑定宿主机端口
+	ingress := needIngressProxy(containerInfo)
+
+	// 转发容器也算在实例的容器数量里, 没有创建出来之前实例还不能访问
+	containerCount := len(containerInfo.Containers)
+	if ingress {
+		containerCount++
+	}
+
 	// For each container in the spec, create a Docker container
 	for i, c := range containerInfo.Containers {
 		containerName := fmt.Sprintf("%s-%d", containerInfo.Name, i)
@@ -185,6 +247,12 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 		}
 		// Add the flag environment variable
 		env = append(env, fmt.Sprintf("A1CTF_FLAG=%s", containerInfo.Flag))
+		for name, subFlag := range containerInfo.SubFlags {
+			env = append(env, fmt.Sprintf("%s=%s", SubFlagEnvName(name), subFlag))
+		}
+		if containerInfo.DecoyFlag != "" && containerInfo.DecoyEnv != "" {
+			env = append(env, fmt.Sprintf("%s=%s", containerInfo.DecoyEnv, containerInfo.DecoyFlag))
+		}
 
 		// Prepare port mappings
 		portSet := nat.PortSet{}
@@ -193,10 +261,18 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 		for _, port := range c.ExposePorts {
 			natPort := nat.Port(fmt.Sprintf("%d/tcp", port.Port))
 			portSet[natPort] = struct{}{}
-			
-			// Assign host port (use port + 30000 offset for now, similar to k8s NodePort)
-			hostPort := port.Port + 30000
-			portMap[natPort] = []nat.PortBinding{{HostPort: strconv.Itoa(int(hostPort))}}
+			if ingress {
+				continue
+			}
+
+			// 使用预先分配的宿主机端口, 没有分配时交给 Docker 随机选择
+			binding := nat.PortBinding{
+				HostIP: viper.GetString("docker.port-bind-ip"),
+			}
+			if hostPort, ok := containerInfo.HostPorts[HostPortKey(c.Name, port.Port)]; ok {
+				binding.HostPort = strconv.Itoa(int(hostPort))
+			}
+			portMap[natPort] = []nat.PortBinding{binding}
 		}
 
 		// Prepare labels
@@ -207,6 +283,8 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 		labels["a1ctf.managed"] = "true"
 		labels["a1ctf.container_name"] = containerInfo.Name
 		labels["a1ctf.team_hash"] = containerInfo.TeamHash
+		labels["a1ctf.service_name"] = c.Name
+		labels["a1ctf.container_count"] = strconv.Itoa(containerCount)
 		// Add ingame_id if it exists in the original labels
 		if ingameID, exists := containerInfo.Labels["ingame_id"]; exists {
 			labels["a1ctf.ingame_id"] = ingameID
@@ -224,6 +302,7 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 
 		// Create container config
 		config := &container.Config{
+			Hostname:     c.Name,
 			Image:        c.Image,
 			Env:          env,
 			ExposedPorts: portSet,
@@ -240,9 +319,25 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 			NetworkMode:  container.NetworkMode(networkName),
 		}
 
+		// 与 k8s 的 NetworkPolicy 一致, 只有不允许出网时才需要限制 DNS
+		// 上游 DNS 指向容器内的回环地址, 外部域名无法解析
+		if !containerInfo.AllowWAN && !containerInfo.AllowDNS {
+			hostConfig.DNS = []string{"127.0.0.1"}
+		}
+
+		// 需要 overlay2 + xfs(pquota) 存储驱动支持
+		if c.StorageLimit > 0 && storageQuotaEnabled() {
+			hostConfig.StorageOpt = map[string]string{
+				"size": fmt.Sprintf("%dM", c.StorageLimit),
+			}
+		}
+
+		// 同一实例内的容器可以通过 A1Container.Name 互相访问
 		networkingConfig := &network.NetworkingConfig{
 			EndpointsConfig: map[string]*network.EndpointSettings{
-				networkName: {},
+				networkName: {
+					Aliases: []string{c.Name},
+				},
 			},
 		}
 
@@ -262,6 +357,13 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 			return fmt.Errorf("error creating container %s: %v", containerName, err)
 		}
 
+		// 蜜罐 flag 文件需要在启动前写入
+		if containerInfo.DecoyFlag != "" && containerInfo.DecoyFile != "" {
+			if err := copyDecoyFile(cli, ctx, resp.ID, containerInfo.DecoyFile, containerInfo.DecoyFlag); err != nil {
+				return fmt.Errorf("error writing decoy file to container %s: %v", containerName, err)
+			}
+		}
+
 		// Start container
 		if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
 			return fmt.Errorf("error starting container %s: %v", containerName, err)
@@ -272,26 +374,96 @@ func CreateContainer(containerInfo *ContainerInfo) error {
 			zap.String("container_id", resp.ID))
 	}
 
+	if ingress {
+		if err := createIngressContainer(cli, ctx, containerInfo, containerCount); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func createNetworkIfNotExists(cli *client.Client, ctx context.Context, networkName string) error {
-	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{})
-	if err != nil {
+// 把蜜罐 flag 打包成 tar 写入容器, 不存在的父目录会自动创建
+func copyDecoyFile(cli *client.Client, ctx context.Context, containerID string, filePath string, content string) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    strings.TrimPrefix(path.Clean(filePath), "/"),
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}); err != nil {
 		return err
 	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return cli.CopyToContainer(ctx, containerID, "/", &buf, types.CopyToContainerOptions{})
+}
+
+// 默认关闭, 存储驱动不支持 size 参数时容器会创建失败
+func storageQuotaEnabled() bool {
+	return viper.GetBool("docker.storage-quota")
+}
 
-	for _, network := range networks {
-		if network.Name == networkName {
-			return nil // Network already exists
+func hasExposePorts(containerInfo *ContainerInfo) bool {
+	for _, c := range containerInfo.Containers {
+		if len(c.ExposePorts) > 0 {
+			return true
 		}
 	}
+	return false
+}
+
+// createInstanceNetwork 创建实例独占的网络
+// 不允许出网时使用 internal 网络, 和 k8s 的 NetworkPolicy 一样容器无法访问宿主机、内网和外网
+// 暴露的端口交给 createIngressContainer 创建的转发容器发布
+// 配置了 docker.network-pool 时子网从地址池中分配, 见 network_pool.go
+func createInstanceNetwork(cli *client.Client, ctx context.Context, containerInfo *ContainerInfo) error {
+	networkName := containerInfo.Name
+
+	if _, err := cli.NetworkInspect(ctx, networkName, types.NetworkInspectOptions{}); err == nil {
+		return nil // Network already exists
+	} else if !client.IsErrNotFound(err) {
+		return err
+	}
 
-	// Create network
-	_, err = cli.NetworkCreate(ctx, networkName, types.NetworkCreate{
+	networkCreate := types.NetworkCreate{
 		Driver: "bridge",
-	})
-	return err
+		Labels: map[string]string{
+			"a1ctf.managed":        "true",
+			"a1ctf.container_name": containerInfo.Name,
+			"a1ctf.team_hash":      containerInfo.TeamHash,
+		},
+	}
+
+	if !containerInfo.AllowWAN {
+		networkCreate.Internal = true
+	}
+
+	pool, prefix, err := networkPool()
+	if err != nil {
+		return err
+	}
+	if pool != nil {
+		return createNetworkFromPool(cli, ctx, networkName, networkCreate, pool, prefix)
+	}
+
+	_, err = cli.NetworkCreate(ctx, networkName, networkCreate)
+	return wrapAddressPoolError(err)
+}
+
+// removeInstanceNetwork 删除实例网络, 需要先删除网络中的容器
+func removeInstanceNetwork(cli *client.Client, ctx context.Context, networkName string) error {
+	err := cli.NetworkRemove(ctx, networkName)
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	return nil
 }
 
 func GetContainerPorts(containerInfo *ContainerInfo) (*ContainerPorts, error) {
@@ -323,11 +495,22 @@ func GetContainerPorts(containerInfo *ContainerInfo) (*ContainerPorts, error) {
 				if len(bindings) > 0 {
 					portNum, _ := strconv.Atoi(strings.Split(string(port), "/")[0])
 					hostPort, _ := strconv.Atoi(bindings[0].HostPort)
-					
+
+					serviceName := dockerContainer.Labels["a1ctf.service_name"]
+					containerPort := int32(portNum)
+					// 转发容器的端口换算成题目容器的端口
+					if _, ok := dockerContainer.Labels["a1ctf.ingress"]; ok {
+						var found bool
+						if serviceName, containerPort, found = ingressTarget(dockerContainer.Labels, portNum); !found {
+							continue
+						}
+					}
+
 					result = append(result, ContainerPort{
-						Name:     string(port),
-						Port:     int32(portNum),
-						HostPort: int32(hostPort),
+						Name:        string(port),
+						ServiceName: serviceName,
+						Port:        containerPort,
+						HostPort:    int32(hostPort),
 					})
 				}
 			}
@@ -368,6 +551,10 @@ func DeleteContainer(containerInfo *ContainerInfo) error {
 		}
 	}
 
+	if err := removeInstanceNetwork(cli, ctx, containerInfo.Name); err != nil {
+		return fmt.Errorf("error removing network %s: %v", containerInfo.Name, err)
+	}
+
 	return nil
 }
 
@@ -401,5 +588,9 @@ func ForceDeleteContainer(containerName string) error {
 		}
 	}
 
+	if err := removeInstanceNetwork(cli, ctx, containerName); err != nil {
+		return fmt.Errorf("error removing network %s: %v", containerName, err)
+	}
+
 	return nil
 }
\ No newline at end of file
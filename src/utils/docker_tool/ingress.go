@@ -0,0 +1,175 @@
+package dockertool
+
+import (
+	"a1ctf/src/utils/zaphelper"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// 不允许出网的实例只连接 internal 网络, 没有任何出口
+// 暴露的端口由同时连接实例网络和 ingressNetworkName 的转发容器发布, 转发容器只负责入站连接
+const ingressNetworkName = "a1ctf-ingress"
+
+// 转发容器监听的第一个端口, 每个暴露的端口占用一个
+const ingressListenPortBase = 20000
+
+// 转发容器的标签 a1ctf.ingress.{监听端口} = {服务名}:{端口}
+const ingressPortLabelPrefix = "a1ctf.ingress."
+
+func needIngressProxy(containerInfo *ContainerInfo) bool {
+	return !containerInfo.AllowWAN && hasExposePorts(containerInfo)
+}
+
+func ingressImage() string {
+	if image := viper.GetString("docker.ingress-image"); image != "" {
+		return image
+	}
+	return "alpine/socat:latest"
+}
+
+// ingressTarget 解析转发容器端口对应的服务和端口
+func ingressTarget(labels map[string]string, listenPort int) (string, int32, bool) {
+	target, ok := labels[fmt.Sprintf("%s%d", ingressPortLabelPrefix, listenPort)]
+	if !ok {
+		return "", 0, false
+	}
+
+	serviceName, portStr, found := strings.Cut(target, ":")
+	if !found {
+		return "", 0, false
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return serviceName, int32(port), true
+}
+
+func createIngressNetwork(cli *client.Client, ctx context.Context) error {
+	if _, err := cli.NetworkInspect(ctx, ingressNetworkName, types.NetworkInspectOptions{}); err == nil {
+		return nil // Network already exists
+	} else if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	_, err := cli.NetworkCreate(ctx, ingressNetworkName, types.NetworkCreate{
+		Driver: "bridge",
+		Labels: map[string]string{
+			"a1ctf.managed": "true",
+		},
+		Options: map[string]string{
+			// 转发容器之间不需要互相访问
+			"com.docker.network.bridge.enable_icc": "false",
+		},
+	})
+	return err
+}
+
+// createIngressContainer 为不允许出网的实例创建端口转发容器
+// 题目容器通过实例网络中的别名访问, 删除实例时和题目容器一起按 a1ctf.container_name 标签删除
+// 转发容器和题目容器使用相同的 a1ctf.* 标签, 状态监听和回收都把它当作实例的一部分
+func createIngressContainer(cli *client.Client, ctx context.Context, containerInfo *ContainerInfo, containerCount int) error {
+	if err := createIngressNetwork(cli, ctx); err != nil {
+		return fmt.Errorf("error creating ingress network: %v", err)
+	}
+
+	containerName := fmt.Sprintf("%s-ingress", containerInfo.Name)
+
+	labels := map[string]string{
+		"a1ctf.managed":         "true",
+		"a1ctf.container_name":  containerInfo.Name,
+		"a1ctf.team_hash":       containerInfo.TeamHash,
+		"a1ctf.container_count": strconv.Itoa(containerCount),
+		"a1ctf.ingress":         "true",
+	}
+	if ingameID, exists := containerInfo.Labels["ingame_id"]; exists {
+		labels["a1ctf.ingame_id"] = ingameID
+	}
+
+	portSet := nat.PortSet{}
+	portMap := nat.PortMap{}
+	commands := make([]string, 0)
+
+	listenPort := ingressListenPortBase
+	for _, c := range containerInfo.Containers {
+		for _, port := range c.ExposePorts {
+			natPort := nat.Port(fmt.Sprintf("%d/tcp", listenPort))
+			portSet[natPort] = struct{}{}
+
+			binding := nat.PortBinding{
+				HostIP: viper.GetString("docker.port-bind-ip"),
+			}
+			if hostPort, ok := containerInfo.HostPorts[HostPortKey(c.Name, port.Port)]; ok {
+				binding.HostPort = strconv.Itoa(int(hostPort))
+			}
+			portMap[natPort] = []nat.PortBinding{binding}
+
+			labels[fmt.Sprintf("%s%d", ingressPortLabelPrefix, listenPort)] = fmt.Sprintf("%s:%d", c.Name, port.Port)
+			commands = append(commands, fmt.Sprintf("socat TCP-LISTEN:%d,fork,reuseaddr TCP:%s:%d &", listenPort, c.Name, port.Port))
+
+			listenPort++
+		}
+	}
+	commands = append(commands, "wait")
+
+	config := &container.Config{
+		Image:        ingressImage(),
+		Entrypoint:   []string{"/bin/sh", "-c"},
+		Cmd:          []string{strings.Join(commands, " ")},
+		ExposedPorts: portSet,
+		Labels:       labels,
+	}
+
+	hostConfig := &container.HostConfig{
+		PortBindings: portMap,
+		NetworkMode:  container.NetworkMode(ingressNetworkName),
+		Resources: container.Resources{
+			Memory: 64 * 1024 * 1024,
+		},
+	}
+
+	reader, err := cli.ImagePull(ctx, config.Image, types.ImagePullOptions{})
+	if err != nil {
+		zaphelper.Logger.Warn("Failed to pull image", zap.String("image", config.Image), zap.Error(err))
+	} else {
+		io.Copy(io.Discard, reader)
+		reader.Close()
+	}
+
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			ingressNetworkName: {},
+		},
+	}, nil, containerName)
+	if err != nil {
+		return fmt.Errorf("error creating container %s: %v", containerName, err)
+	}
+
+	// 旧版本的 Docker API 创建时只能指定一个网络
+	if err := cli.NetworkConnect(ctx, containerInfo.Name, resp.ID, nil); err != nil {
+		return fmt.Errorf("error connecting container %s to network %s: %v", containerName, containerInfo.Name, err)
+	}
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("error starting container %s: %v", containerName, err)
+	}
+
+	zaphelper.Logger.Info("Ingress container created and started",
+		zap.String("container_name", containerName),
+		zap.String("container_id", resp.ID))
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package dockertool
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/spf13/viper"
+)
+
+// 每个实例独占一个 bridge 网络, Docker 默认的地址池只能分出三十个左右的网络
+// 配置 docker.network-pool 后实例网络从这个网段里切出 docker.network-prefix 大小的子网
+const defaultNetworkPrefix = 28
+
+// 子网被同时启动的其他实例抢占时换一个重试
+const networkCreateAttempts = 8
+
+// networkPool 读取实例网络使用的地址池, 没有配置时返回 nil, 交给 Docker 的 default-address-pools 分配
+func networkPool() (*net.IPNet, int, error) {
+	poolStr := strings.TrimSpace(viper.GetString("docker.network-pool"))
+	if poolStr == "" {
+		return nil, 0, nil
+	}
+
+	_, pool, err := net.ParseCIDR(poolStr)
+	if err != nil || pool.IP.To4() == nil {
+		return nil, 0, fmt.Errorf("invalid docker.network-pool %q, it must be an IPv4 CIDR", poolStr)
+	}
+
+	prefix := viper.GetInt("docker.network-prefix")
+	if prefix == 0 {
+		prefix = defaultNetworkPrefix
+	}
+
+	poolPrefix, _ := pool.Mask.Size()
+	// 至少要留出网关和一个容器的地址
+	if prefix < poolPrefix || prefix > 29 {
+		return nil, 0, fmt.Errorf("invalid docker.network-prefix %d, it must be between %d and 29", prefix, poolPrefix)
+	}
+
+	return pool, prefix, nil
+}
+
+// usedSubnets 列出 Docker 中所有网络已经占用的子网
+func usedSubnets(cli *client.Client, ctx context.Context) ([]*net.IPNet, error) {
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	subnets := make([]*net.IPNet, 0)
+	for _, n := range networks {
+		for _, config := range n.IPAM.Config {
+			if _, subnet, err := net.ParseCIDR(config.Subnet); err == nil {
+				subnets = append(subnets, subnet)
+			}
+		}
+	}
+	return subnets, nil
+}
+
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// nextFreeSubnet 在地址池里按顺序找第一个和 used 都不重叠的子网
+func nextFreeSubnet(pool *net.IPNet, prefix int, used []*net.IPNet) (*net.IPNet, bool) {
+	poolPrefix, _ := pool.Mask.Size()
+	base := binary.BigEndian.Uint32(pool.IP.To4())
+	size := uint32(1) << (32 - prefix)
+	count := uint32(1) << (prefix - poolPrefix)
+
+	for i := uint32(0); i < count; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, base+i*size)
+		candidate := &net.IPNet{IP: ip, Mask: net.CIDRMask(prefix, 32)}
+
+		free := true
+		for _, subnet := range used {
+			if subnetsOverlap(candidate, subnet) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate, true
+		}
+	}
+	return nil, false
+}
+
+// createNetworkFromPool 从 docker.network-pool 中分配子网并创建网络
+func createNetworkFromPool(cli *client.Client, ctx context.Context, networkName string, networkCreate types.NetworkCreate, pool *net.IPNet, prefix int) error {
+	used, err := usedSubnets(cli, ctx)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt < networkCreateAttempts; attempt++ {
+		subnet, ok := nextFreeSubnet(pool, prefix, used)
+		if !ok {
+			return fmt.Errorf("docker.network-pool %s is exhausted, use a larger pool or a longer docker.network-prefix", pool.String())
+		}
+
+		networkCreate.IPAM = &network.IPAM{
+			Driver: "default",
+			Config: []network.IPAMConfig{
+				{Subnet: subnet.String()},
+			},
+		}
+
+		_, err = cli.NetworkCreate(ctx, networkName, networkCreate)
+		if err == nil || !strings.Contains(err.Error(), "overlaps") {
+			return err
+		}
+
+		// 子网刚被其他实例占用
+		used = append(used, subnet)
+	}
+
+	return err
+}
+
+// wrapAddressPoolError 给 Docker 默认地址池耗尽的错误加上配置提示
+func wrapAddressPoolError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "non-overlapping") {
+		return fmt.Errorf("docker has no free address pool for the instance network, set docker.network-pool or enlarge default-address-pools in daemon.json: %v", err)
+	}
+	return err
+}
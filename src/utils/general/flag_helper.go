@@ -57,6 +57,7 @@ var templateList = []string{
 	"[team_name]",
 	"[uuid]",
 	"[game_id]",
+	"[container_id]",
 }
 
 func findChar(flag string) int {
@@ -146,6 +147,7 @@ func ReplaceTemplateFlag(flag string, data map[string]string) string {
 	flag = strings.ReplaceAll(flag, "[team_name]", data["team_name"])
 	flag = strings.ReplaceAll(flag, "[uuid]", uuid.New().String())
 	flag = strings.ReplaceAll(flag, "[game_id]", data["game_id"])
+	flag = strings.ReplaceAll(flag, "[container_id]", data["container_id"])
 
 	// process special length random string
 	flag = regexp.MustCompile(`\[random_string_\d+\]`).ReplaceAllStringFunc(flag, func(s string) string {
@@ -156,6 +158,21 @@ func ReplaceTemplateFlag(flag string, data map[string]string) string {
 	return flag
 }
 
+// HasPerLaunchTemplate 模板中是否有每次生成都不同的部分
+func HasPerLaunchTemplate(flag string) bool {
+	return strings.Contains(flag, "[uuid]") || strings.Contains(flag, "[container_id]") ||
+		regexp.MustCompile(`\[random_string_\d+\]`).MatchString(flag)
+}
+
+// AppendFlagBody 在 flag 的花括号内追加内容, 没有花括号时追加在末尾
+func AppendFlagBody(flag string, suffix string) string {
+	if strings.Contains(flag, "{") && strings.Contains(flag, "}") {
+		end := strings.Index(flag, "}")
+		return flag[:end] + suffix + flag[end:]
+	}
+	return flag + suffix
+}
+
 func ProcessFlag(flag string, data map[string]string, shouldLeet bool) string {
 	flagHead := ""
 	flagBody := flag
@@ -0,0 +1,178 @@
+package judgetool
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/utils/general"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 按照评测配置里的规范化选项处理 flag
+func NormalizeFlag(config *models.JudgeConfig, flag string) string {
+	if config == nil {
+		return flag
+	}
+
+	if config.FlagNormalizeNFKC {
+		flag = norm.NFKC.String(flag)
+	}
+
+	if config.FlagTrimSpace {
+		flag = strings.TrimSpace(flag)
+	}
+
+	if config.FlagCaseInsensitive {
+		flag = strings.ToLower(flag)
+	}
+
+	return flag
+}
+
+// 题目生效的 flag 前缀，题目没有设置时使用比赛的默认前缀，题目设置为空字符串表示不检查格式
+func FlagPrefix(game *models.Game, config *models.JudgeConfig) string {
+	if config != nil && config.FlagPrefix != nil {
+		return *config.FlagPrefix
+	}
+	if game != nil && game.FlagPrefix != nil {
+		return *game.FlagPrefix
+	}
+	return ""
+}
+
+// 检查提交是否符合 flag 前缀的格式，没有配置前缀时总是符合
+// 脚本评测的提交格式由脚本决定，不检查前缀
+func CheckFlagFormat(config *models.JudgeConfig, flagPrefix string, content string) bool {
+	if flagPrefix == "" {
+		return true
+	}
+
+	if config != nil && config.JudgeType == models.JudgeTypeScript {
+		return true
+	}
+
+	content = NormalizeFlag(config, content)
+	prefix := NormalizeFlag(config, flagPrefix) + "{"
+
+	return len(content) > len(prefix) && strings.HasPrefix(content, prefix) && strings.HasSuffix(content, "}")
+}
+
+func compileFlagRegexp(config *models.JudgeConfig, expr string) (*regexp.Regexp, error) {
+	expr = "^(?:" + expr + ")$"
+	if config.FlagCaseInsensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+var subFlagNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 检查评测配置是否合法，包括正则表达式能否编译和子 flag 的配置
+func ValidJudgeConfig(config *models.JudgeConfig) error {
+	if config == nil {
+		return nil
+	}
+
+	for _, expr := range config.FlagRegexps {
+		if _, err := compileFlagRegexp(config, expr); err != nil {
+			return fmt.Errorf("invalid flag regexp %q: %w", expr, err)
+		}
+	}
+
+	subFlagNames := make(map[string]bool)
+	for _, subFlag := range config.SubFlags {
+		if !subFlagNameRegexp.MatchString(subFlag.Name) {
+			return fmt.Errorf("invalid sub flag name %q, only letters, digits and underscores are allowed", subFlag.Name)
+		}
+		if subFlagNames[subFlag.Name] {
+			return fmt.Errorf("duplicate sub flag name %q", subFlag.Name)
+		}
+		subFlagNames[subFlag.Name] = true
+
+		if subFlag.Weight <= 0 {
+			return fmt.Errorf("weight of sub flag %q must be positive", subFlag.Name)
+		}
+		if subFlag.FlagType != models.FlagTypeDynamic && subFlag.FlagType != models.FlagTypeStatic {
+			return fmt.Errorf("invalid flag type of sub flag %q", subFlag.Name)
+		}
+		if subFlag.FlagTemplate == "" {
+			return fmt.Errorf("flag template of sub flag %q is empty", subFlag.Name)
+		}
+	}
+
+	if honeypot := config.Honeypot; honeypot != nil {
+		if honeypot.EnvName == "" && honeypot.FilePath == "" {
+			return fmt.Errorf("honeypot needs an env name or a file path")
+		}
+		if honeypot.EnvName != "" && (!envNameRegexp.MatchString(honeypot.EnvName) || strings.HasPrefix(honeypot.EnvName, "A1CTF_FLAG")) {
+			return fmt.Errorf("invalid honeypot env name %q", honeypot.EnvName)
+		}
+		if honeypot.FilePath != "" && (!path.IsAbs(honeypot.FilePath) || strings.HasSuffix(honeypot.FilePath, "/")) {
+			return fmt.Errorf("honeypot file path %q must be an absolute file path", honeypot.FilePath)
+		}
+	}
+
+	return nil
+}
+
+// 生成一个蜜罐 flag, 默认和题目的 flag 格式一致, 提交时不会因为格式错误被直接拒绝
+func GenerateDecoyFlag(config *models.JudgeConfig, flagPrefix string, data map[string]string) string {
+	template := config.Honeypot.Template
+	if template == "" {
+		prefix := "flag"
+		if flagPrefix != "" {
+			prefix = flagPrefix
+		}
+		template = prefix + "{[random_string_32]}"
+	}
+	return general.ProcessFlag(template, data, false)
+}
+
+// 匹配静态的子 flag，规范化选项沿用题目的配置
+func MatchStaticSubFlag(config *models.JudgeConfig, subFlag models.SubFlagConfig, content string) bool {
+	matched, _ := MatchStaticFlag(&models.JudgeConfig{
+		FlagTemplate:        &subFlag.FlagTemplate,
+		FlagCaseInsensitive: config.FlagCaseInsensitive,
+		FlagTrimSpace:       config.FlagTrimSpace,
+		FlagNormalizeNFKC:   config.FlagNormalizeNFKC,
+	}, content)
+	return matched
+}
+
+// 静态 flag 的匹配，flag 模板、额外答案和正则表达式任意一个匹配即为正确
+func MatchStaticFlag(config *models.JudgeConfig, content string) (bool, error) {
+	if config == nil {
+		return false, nil
+	}
+
+	normalized := NormalizeFlag(config, content)
+
+	answers := make([]string, 0, len(config.FlagAnswers)+1)
+	if config.FlagTemplate != nil {
+		answers = append(answers, *config.FlagTemplate)
+	}
+	answers = append(answers, config.FlagAnswers...)
+
+	for _, answer := range answers {
+		if answer != "" && NormalizeFlag(config, answer) == normalized {
+			return true, nil
+		}
+	}
+
+	for _, expr := range config.FlagRegexps {
+		re, err := compileFlagRegexp(config, expr)
+		if err != nil {
+			return false, fmt.Errorf("invalid flag regexp %q: %w", expr, err)
+		}
+
+		if re.MatchString(normalized) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
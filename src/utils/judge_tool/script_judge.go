@@ -0,0 +1,331 @@
+package judgetool
+
+import (
+	"a1ctf/src/utils/zaphelper"
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	dockertool "a1ctf/src/utils/docker_tool"
+)
+
+// 评测脚本在沙箱内的存放位置
+const checkerDir = "/checker"
+const checkerScriptName = "script"
+
+// 返回给选手的信息最大长度
+const maxMessageLength = 1024
+
+// 沙箱每个输出流最多保留的字节数
+const maxOutputLength = 64 * 1024
+
+type ScriptVerdict string
+
+const (
+	ScriptVerdictAC      ScriptVerdict = "AC"
+	ScriptVerdictWA      ScriptVerdict = "WA"
+	ScriptVerdictTimeout ScriptVerdict = "Timeout"
+)
+
+// ScriptJudgeContext 传递给评测脚本的提交信息和队伍信息
+type ScriptJudgeContext struct {
+	JudgeID     string
+	Content     string
+	GameID      int64
+	ChallengeID int64
+	IngameID    int64
+	TeamID      int64
+	TeamHash    string
+	TeamName    string
+	SubmiterID  string
+	TeamFlag    string
+}
+
+type ScriptJudgeResult struct {
+	Verdict ScriptVerdict
+	Message string
+}
+
+type sandboxConfig struct {
+	Image       string
+	Command     []string
+	Timeout     time.Duration
+	MemoryLimit int64
+	CPULimit    int64
+	PidsLimit   int64
+}
+
+func loadSandboxConfig() sandboxConfig {
+	config := sandboxConfig{
+		Image:       viper.GetString("judge-sandbox.image"),
+		Command:     viper.GetStringSlice("judge-sandbox.command"),
+		Timeout:     viper.GetDuration("judge-sandbox.timeout"),
+		MemoryLimit: viper.GetInt64("judge-sandbox.memory-limit"),
+		CPULimit:    viper.GetInt64("judge-sandbox.cpu-limit"),
+		PidsLimit:   viper.GetInt64("judge-sandbox.pids-limit"),
+	}
+
+	if config.Image == "" {
+		config.Image = "python:3.12-alpine"
+	}
+	if len(config.Command) == 0 {
+		config.Command = []string{"python3", fmt.Sprintf("%s/%s", checkerDir, checkerScriptName)}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.MemoryLimit <= 0 {
+		config.MemoryLimit = 128
+	}
+	if config.CPULimit <= 0 {
+		config.CPULimit = 500
+	}
+	if config.PidsLimit <= 0 {
+		config.PidsLimit = 64
+	}
+
+	return config
+}
+
+func (e *ScriptJudgeContext) toEnv() []string {
+	return []string{
+		fmt.Sprintf("A1CTF_JUDGE_ID=%s", e.JudgeID),
+		fmt.Sprintf("A1CTF_SUBMISSION=%s", e.Content),
+		fmt.Sprintf("A1CTF_GAME_ID=%d", e.GameID),
+		fmt.Sprintf("A1CTF_CHALLENGE_ID=%d", e.ChallengeID),
+		fmt.Sprintf("A1CTF_INGAME_ID=%d", e.IngameID),
+		fmt.Sprintf("A1CTF_TEAM_ID=%d", e.TeamID),
+		fmt.Sprintf("A1CTF_TEAM_HASH=%s", e.TeamHash),
+		fmt.Sprintf("A1CTF_TEAM_NAME=%s", e.TeamName),
+		fmt.Sprintf("A1CTF_SUBMITER_ID=%s", e.SubmiterID),
+		fmt.Sprintf("A1CTF_FLAG=%s", e.TeamFlag),
+	}
+}
+
+// 把评测脚本打包成 tar，用于拷贝进沙箱
+func buildScriptArchive(script string) (io.Reader, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     strings.TrimPrefix(checkerDir, "/") + "/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     fmt.Sprintf("%s/%s", strings.TrimPrefix(checkerDir, "/"), checkerScriptName),
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(script)),
+	}); err != nil {
+		return nil, err
+	}
+
+	if _, err := tw.Write([]byte(script)); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+func ensureImage(ctx context.Context, cli *client.Client, image string) error {
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	}
+
+	reader, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("error pulling sandbox image %s: %v", image, err)
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// cappedBuffer 只保留前 limit 个字节, 超出的部分直接丢弃, 写入永远不会失败
+// 这样可以把整个日志流交给 StdCopy 解复用, 不会因为截断在帧中间而出错
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if remain := b.limit - b.Len(); remain > 0 {
+		if len(p) > remain {
+			b.Buffer.Write(p[:remain])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// CheckSandbox 检查评测沙箱使用的 Docker 是否可用
+// 沙箱总是通过本机的 Docker (DOCKER_HOST) 运行, 使用 k8s 作为容器后端时也一样
+func CheckSandbox() error {
+	cli, err := dockertool.GetClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := cli.Ping(ctx); err != nil {
+		return fmt.Errorf("docker is not reachable: %v", err)
+	}
+	return nil
+}
+
+func truncateMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if len(message) <= maxMessageLength {
+		return message
+	}
+
+	message = message[:maxMessageLength]
+	// 防止截断到半个 UTF-8 字符
+	for len(message) > 0 && !utf8.ValidString(message) {
+		message = message[:len(message)-1]
+	}
+	return message
+}
+
+// RunCheckerScript 在一次性的 Docker 沙箱中运行评测脚本
+// 脚本以退出码返回结果: 0 为正确, 1 为错误, 其他视为评测出错; 标准输出作为返回给选手的信息
+func RunCheckerScript(script string, judgeCtx *ScriptJudgeContext) (*ScriptJudgeResult, error) {
+	if strings.TrimSpace(script) == "" {
+		return nil, errors.New("judge script is empty")
+	}
+
+	cli, err := dockertool.GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	sandbox := loadSandboxConfig()
+	ctx := context.Background()
+
+	if err := ensureImage(ctx, cli, sandbox.Image); err != nil {
+		return nil, err
+	}
+
+	config := &container.Config{
+		Image:           sandbox.Image,
+		Cmd:             sandbox.Command,
+		Env:             judgeCtx.toEnv(),
+		User:            "65534:65534",
+		WorkingDir:      checkerDir,
+		NetworkDisabled: true,
+		Labels: map[string]string{
+			"a1ctf.sandbox":  "true",
+			"a1ctf.judge_id": judgeCtx.JudgeID,
+		},
+	}
+
+	pidsLimit := sandbox.PidsLimit
+	hostConfig := &container.HostConfig{
+		NetworkMode: "none",
+		CapDrop:     []string{"ALL"},
+		SecurityOpt: []string{"no-new-privileges"},
+		Tmpfs: map[string]string{
+			"/tmp": "rw,noexec,nosuid,size=16m",
+		},
+		Resources: container.Resources{
+			Memory:     sandbox.MemoryLimit * 1024 * 1024,
+			MemorySwap: sandbox.MemoryLimit * 1024 * 1024,
+			NanoCPUs:   sandbox.CPULimit * 1000000,
+			PidsLimit:  &pidsLimit,
+		},
+	}
+
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, fmt.Sprintf("a1ctf-judge-%s", judgeCtx.JudgeID))
+	if err != nil {
+		return nil, fmt.Errorf("error creating sandbox: %v", err)
+	}
+
+	// 无论结果如何都要清理沙箱
+	defer func() {
+		if err := cli.ContainerRemove(context.Background(), resp.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			zaphelper.Logger.Warn("Failed to remove judge sandbox", zap.String("container_id", resp.ID), zap.Error(err))
+		}
+	}()
+
+	archive, err := buildScriptArchive(script)
+	if err != nil {
+		return nil, fmt.Errorf("error packing judge script: %v", err)
+	}
+
+	if err := cli.CopyToContainer(ctx, resp.ID, "/", archive, types.CopyToContainerOptions{}); err != nil {
+		return nil, fmt.Errorf("error copying judge script: %v", err)
+	}
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, fmt.Errorf("error starting sandbox: %v", err)
+	}
+
+	// 只有脚本运行阶段计入超时
+	waitCtx, cancel := context.WithTimeout(ctx, sandbox.Timeout)
+	defer cancel()
+
+	var exitCode int64
+	statusCh, errCh := cli.ContainerWait(waitCtx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+			_ = cli.ContainerKill(ctx, resp.ID, "SIGKILL")
+			return &ScriptJudgeResult{Verdict: ScriptVerdictTimeout}, nil
+		}
+		return nil, fmt.Errorf("error waiting sandbox: %v", err)
+	case status := <-statusCh:
+		if status.Error != nil {
+			return nil, fmt.Errorf("sandbox exited with error: %s", status.Error.Message)
+		}
+		exitCode = status.StatusCode
+	}
+
+	logs, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return nil, fmt.Errorf("error reading sandbox output: %v", err)
+	}
+	defer logs.Close()
+
+	stdout := &cappedBuffer{limit: maxOutputLength}
+	stderr := &cappedBuffer{limit: maxOutputLength}
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil {
+		return nil, fmt.Errorf("error reading sandbox output: %v", err)
+	}
+
+	switch exitCode {
+	case 0:
+		return &ScriptJudgeResult{Verdict: ScriptVerdictAC, Message: truncateMessage(stdout.String())}, nil
+	case 1:
+		return &ScriptJudgeResult{Verdict: ScriptVerdictWA, Message: truncateMessage(stdout.String())}, nil
+	case 137:
+		// 被 OOM Killer 杀掉
+		return nil, fmt.Errorf("judge script was killed, memory limit exceeded")
+	default:
+		return nil, fmt.Errorf("judge script exited with code %d: %s", exitCode, truncateMessage(stderr.String()))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/bytedance/sonic"
 	"github.com/go-playground/validator/v10"
@@ -14,6 +15,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -115,8 +117,21 @@ type PodInfo struct {
 	Flag       string
 	AllowWAN   bool
 	AllowDNS   bool
+	// 多段 flag 题目的动态子 flag
+	SubFlags map[string]string
+	// 蜜罐 flag, 注入到 DecoyEnv 环境变量, 或者通过 Secret 挂载到 DecoyFile 文件
+	DecoyFlag string
+	DecoyEnv  string
+	DecoyFile string
 }
 
+// 蜜罐 flag 文件使用的 Secret 名称和 key
+func decoySecretName(podName string) string {
+	return podName + "-decoy"
+}
+
+const decoySecretKey = "decoy"
+
 func GetClient() (*kubernetes.Clientset, error) {
 
 	if clientset != nil {
@@ -184,6 +199,26 @@ func CreatePod(podInfo *PodInfo) error {
 			Name:  "A1CTF_FLAG",
 			Value: podInfo.Flag,
 		})
+		for name, subFlag := range podInfo.SubFlags {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name:  "A1CTF_FLAG_" + strings.ToUpper(name),
+				Value: subFlag,
+			})
+		}
+		if podInfo.DecoyFlag != "" && podInfo.DecoyEnv != "" {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name:  podInfo.DecoyEnv,
+				Value: podInfo.DecoyFlag,
+			})
+		}
+		if podInfo.DecoyFlag != "" && podInfo.DecoyFile != "" {
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      decoySecretKey,
+				MountPath: podInfo.DecoyFile,
+				SubPath:   decoySecretKey,
+				ReadOnly:  true,
+			})
+		}
 
 		if len(c.ExposePorts) > 0 {
 			var containerPorts []corev1.ContainerPort
@@ -217,6 +252,12 @@ func CreatePod(podInfo *PodInfo) error {
 
 		containers = append(containers, container)
 	}
+	// Pod 内的容器共享网络, 和 Docker 一样可以通过容器名称互相访问
+	var containerNames []string
+	for _, c := range podInfo.Containers {
+		containerNames = append(containerNames, c.Name)
+	}
+
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   podInfo.Name,
@@ -224,12 +265,52 @@ func CreatePod(podInfo *PodInfo) error {
 		},
 		Spec: corev1.PodSpec{
 			Containers: containers,
+			HostAliases: []corev1.HostAlias{
+				{
+					IP:        "127.0.0.1",
+					Hostnames: containerNames,
+				},
+			},
 		},
 	}
 
+	// 蜜罐 flag 文件通过 Secret 挂载, 需要在 Pod 之前创建
+	hasDecoySecret := podInfo.DecoyFlag != "" && podInfo.DecoyFile != ""
+	if hasDecoySecret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   decoySecretName(podInfo.Name),
+				Labels: podInfo.Labels,
+			},
+			StringData: map[string]string{
+				decoySecretKey: podInfo.DecoyFlag,
+			},
+		}
+		_, err := clientset.CoreV1().Secrets(namespace).Create(context.Background(), secret, metav1.CreateOptions{})
+		// 上一次启动失败时可能留下了同名的 Secret, 覆盖成这次的蜜罐 flag
+		if k8serrors.IsAlreadyExists(err) {
+			_, err = clientset.CoreV1().Secrets(namespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("error creating decoy secret: %v", err)
+		}
+
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: decoySecretKey,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: decoySecretName(podInfo.Name),
+				},
+			},
+		})
+	}
+
 	// 创建 Pod
 	_, err = clientset.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
 	if err != nil {
+		if hasDecoySecret {
+			_ = clientset.CoreV1().Secrets(namespace).Delete(context.Background(), decoySecretName(podInfo.Name), metav1.DeleteOptions{})
+		}
 		return fmt.Errorf("error creating pod: %v", err)
 	}
 
@@ -423,6 +504,9 @@ func DeletePod(podInfo *PodInfo) error {
 	// 	return fmt.Errorf("error deleting service: %v", err)
 	// }
 
+	// 删除蜜罐 flag 的 Secret, 没有配置时不存在
+	_ = clientset.CoreV1().Secrets(namespace).Delete(context.Background(), decoySecretName(podInfo.Name), metav1.DeleteOptions{})
+
 	if !podInfo.AllowWAN {
 		// 删除 NetworkPolicy
 		_ = clientset.NetworkingV1().NetworkPolicies(namespace).Delete(context.Background(), podInfo.Name, metav1.DeleteOptions{})
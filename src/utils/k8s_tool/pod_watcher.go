@@ -0,0 +1,56 @@
+package k8stool
+
+import (
+	"context"
+	"errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatchPods 通过 informer 订阅题目 Pod 的变化, 阻塞直到 ctx 结束
+func WatchPods(ctx context.Context, handler func(pod *corev1.Pod)) error {
+	clientset, err := GetClient()
+	if err != nil {
+		return err
+	}
+	namespace := "a1ctf-challenges"
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+	informer := factory.Core().V1().Pods().Informer()
+
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				handler(pod)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if pod, ok := newObj.(*corev1.Pod); ok {
+				handler(pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				handler(pod)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("failed to sync pod informer")
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
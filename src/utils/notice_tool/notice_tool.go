@@ -4,6 +4,7 @@ import (
 	"a1ctf/src/db/models"
 	dbtool "a1ctf/src/utils/db_tool"
 	"a1ctf/src/utils/zaphelper"
+	"a1ctf/src/webmodels"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -28,8 +29,8 @@ func InsertNotice(gameID int64, category models.NoticeCategory, values []string)
 }
 
 func AnnounceNotice(notice models.Notice) {
-	for session, gid := range dbtool.GameSessions() {
-		if gid == notice.GameID {
+	for session, gameSession := range dbtool.GameSessions() {
+		if gameSession.GameID == notice.GameID {
 			msg, _ := sonic.Marshal(map[string]interface{}{
 				"type": "Notice",
 				"message": map[string]interface{}{
@@ -43,3 +44,52 @@ func AnnounceNotice(notice models.Notice) {
 		}
 	}
 }
+
+// 把判题结果推送给提交队伍在该比赛中的所有连接，客户端收到后不需要再轮询判题结果
+func PushJudgeResult(judge models.Judge) {
+	msg, _ := sonic.Marshal(map[string]interface{}{
+		"type": "JudgeResult",
+		"message": map[string]interface{}{
+			"judge_id":     judge.JudgeID,
+			"challenge_id": judge.ChallengeID,
+			"judge_status": judge.JudgeStatus,
+			"judge_result": judge.JudgeResult,
+		},
+	})
+
+	for session, gameSession := range dbtool.GameSessions() {
+		if gameSession.GameID == judge.GameID && gameSession.TeamID == judge.TeamID {
+			session.Write(msg)
+		}
+	}
+}
+
+// 把揭晓排行榜的一步推送给比赛中的所有连接
+func PushScoreboardRevealStep(gameID int64, step webmodels.ScoreboardRevealStep) {
+	msg, _ := sonic.Marshal(map[string]interface{}{
+		"type":    "ScoreboardRevealStep",
+		"message": step,
+	})
+
+	for session, gameSession := range dbtool.GameSessions() {
+		if gameSession.GameID == gameID {
+			session.Write(msg)
+		}
+	}
+}
+
+// 排行榜全部揭晓后通知客户端重新获取排行榜
+func PushScoreboardRevealFinished(gameID int64) {
+	msg, _ := sonic.Marshal(map[string]interface{}{
+		"type": "ScoreboardRevealFinished",
+		"message": map[string]interface{}{
+			"game_id": gameID,
+		},
+	})
+
+	for session, gameSession := range dbtool.GameSessions() {
+		if gameSession.GameID == gameID {
+			session.Write(msg)
+		}
+	}
+}
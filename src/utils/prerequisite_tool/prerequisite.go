@@ -0,0 +1,192 @@
+package prerequisitetool
+
+import (
+	"a1ctf/src/db/models"
+	"fmt"
+	"strings"
+)
+
+// TeamProgress 队伍当前的解题情况, 用来判断前置条件是否满足
+type TeamProgress struct {
+	Solved         map[int64]bool
+	Score          float64
+	CategorySolves map[models.ChallengeCategory]int
+}
+
+// NewTeamProgress 根据队伍的解题记录统计解题情况
+func NewTeamProgress(solves []models.Solve, score float64) TeamProgress {
+	progress := TeamProgress{
+		Solved:         make(map[int64]bool, len(solves)),
+		Score:          score,
+		CategorySolves: make(map[models.ChallengeCategory]int),
+	}
+
+	for _, solve := range solves {
+		if progress.Solved[solve.ChallengeID] {
+			continue
+		}
+		progress.Solved[solve.ChallengeID] = true
+		progress.CategorySolves[solve.Challenge.Category]++
+	}
+
+	return progress
+}
+
+// Satisfied 队伍是否满足题目的全部前置条件
+func Satisfied(prerequisites *models.ChallengePrerequisites, progress TeamProgress) bool {
+	if prerequisites.Empty() {
+		return true
+	}
+
+	if len(prerequisites.Challenges) > 0 {
+		solvedCount := 0
+		for _, challengeID := range prerequisites.Challenges {
+			if progress.Solved[challengeID] {
+				solvedCount++
+			}
+		}
+
+		required := len(prerequisites.Challenges)
+		if prerequisites.MinChallenges > 0 && prerequisites.MinChallenges < required {
+			required = prerequisites.MinChallenges
+		}
+		if solvedCount < required {
+			return false
+		}
+	}
+
+	if prerequisites.MinScore > 0 && progress.Score < prerequisites.MinScore {
+		return false
+	}
+
+	for _, requirement := range prerequisites.Categories {
+		if progress.CategorySolves[requirement.Category] < requirement.MinSolves {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Validate 检查题目新的前置条件, graph 是比赛中所有题目当前的前置题目
+// 前置题目必须在比赛中, 并且加入后依赖关系不能出现环
+func Validate(challengeID int64, prerequisites *models.ChallengePrerequisites, graph map[int64][]int64) error {
+	if prerequisites.Empty() {
+		return nil
+	}
+
+	if prerequisites.MinChallenges < 0 || prerequisites.MinChallenges > len(prerequisites.Challenges) {
+		return fmt.Errorf("min_challenges must be between 0 and %d", len(prerequisites.Challenges))
+	}
+
+	if prerequisites.MinScore < 0 {
+		return fmt.Errorf("min_score must not be negative")
+	}
+
+	for _, requirement := range prerequisites.Categories {
+		if requirement.Category == "" || requirement.MinSolves <= 0 {
+			return fmt.Errorf("category requirement needs a category and a positive min_solves")
+		}
+	}
+
+	seen := make(map[int64]bool, len(prerequisites.Challenges))
+	for _, requiredID := range prerequisites.Challenges {
+		if requiredID == challengeID {
+			return fmt.Errorf("challenge %d can not depend on itself", challengeID)
+		}
+		if _, ok := graph[requiredID]; !ok {
+			return fmt.Errorf("challenge %d is not in this game", requiredID)
+		}
+		if seen[requiredID] {
+			return fmt.Errorf("challenge %d is listed more than once", requiredID)
+		}
+		seen[requiredID] = true
+	}
+
+	newGraph := make(map[int64][]int64, len(graph))
+	for id, edges := range graph {
+		newGraph[id] = edges
+	}
+	newGraph[challengeID] = prerequisites.Challenges
+
+	if cycle := findCycle(newGraph); cycle != nil {
+		path := make([]string, 0, len(cycle))
+		for _, id := range cycle {
+			path = append(path, fmt.Sprintf("%d", id))
+		}
+		return fmt.Errorf("prerequisites form a cycle: %s", strings.Join(path, " -> "))
+	}
+
+	return nil
+}
+
+// RemoveChallenge 从前置题目中去掉已经删除的题目, 返回是否有修改
+func RemoveChallenge(prerequisites *models.ChallengePrerequisites, challengeID int64) bool {
+	if prerequisites == nil {
+		return false
+	}
+
+	remaining := make([]int64, 0, len(prerequisites.Challenges))
+	for _, requiredID := range prerequisites.Challenges {
+		if requiredID != challengeID {
+			remaining = append(remaining, requiredID)
+		}
+	}
+	if len(remaining) == len(prerequisites.Challenges) {
+		return false
+	}
+
+	prerequisites.Challenges = remaining
+	if prerequisites.MinChallenges > len(remaining) {
+		prerequisites.MinChallenges = len(remaining)
+	}
+	return true
+}
+
+// 深度优先搜索找出一个环, 返回环上的题目, 没有环时返回 nil
+func findCycle(graph map[int64][]int64) []int64 {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[int64]int, len(graph))
+	stack := make([]int64, 0)
+
+	var visit func(id int64) []int64
+	visit = func(id int64) []int64 {
+		state[id] = visiting
+		stack = append(stack, id)
+
+		for _, next := range graph[id] {
+			switch state[next] {
+			case visiting:
+				for idx, stackID := range stack {
+					if stackID == next {
+						cycle := append([]int64{}, stack[idx:]...)
+						return append(cycle, next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[id] = visited
+		return nil
+	}
+
+	for id := range graph {
+		if state[id] == unvisited {
+			if cycle := visit(id); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+)
+
+// 加载比赛时间内的提示解锁记录，比赛时间外解锁的提示不扣分
+func LoadHintUnlocks(gameIDs []int64) ([]models.HintUnlock, error) {
+	unlocks := make([]models.HintUnlock, 0)
+	if len(gameIDs) == 0 {
+		return unlocks, nil
+	}
+
+	if err := dbtool.DB().Model(&models.HintUnlock{}).
+		Joins("JOIN games ON games.game_id = hint_unlocks.game_id").
+		Where("hint_unlocks.game_id IN ? AND hint_unlocks.unlock_time BETWEEN games.start_time AND games.end_time", gameIDs).
+		Where("(hint_unlocks.cost > 0 OR hint_unlocks.penalty_seconds > 0)").
+		Preload("Challenge").
+		Order("hint_unlocks.unlock_time ASC").
+		Find(&unlocks).Error; err != nil {
+		return nil, err
+	}
+
+	return unlocks, nil
+}
@@ -0,0 +1,81 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	prerequisitetool "a1ctf/src/utils/prerequisite_tool"
+	"errors"
+	"fmt"
+)
+
+// CachedGamePrerequisites 缓存比赛中设置了前置条件的题目, challenge_id -> 前置条件
+func CachedGamePrerequisites(gameID int64) (map[int64]*models.ChallengePrerequisites, error) {
+	obj, err := GetOrCacheSingleFlight(fmt.Sprintf("game_prerequisites_%d", gameID), func() (interface{}, error) {
+		var gameChallenges []models.GameChallenge
+		if err := dbtool.DB().Select("challenge_id", "prerequisites").
+			Where("game_id = ? AND prerequisites IS NOT NULL", gameID).Find(&gameChallenges).Error; err != nil {
+			return nil, errors.New("failed to load challenge prerequisites")
+		}
+
+		prerequisites := make(map[int64]*models.ChallengePrerequisites)
+		for _, gc := range gameChallenges {
+			if !gc.Prerequisites.Empty() {
+				prerequisites[gc.ChallengeID] = gc.Prerequisites
+			}
+		}
+
+		return prerequisites, nil
+	}, challengesForGameCacheTime, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.(map[int64]*models.ChallengePrerequisites), nil
+}
+
+// CachedTeamLockedChallenges 缓存队伍还没有满足前置条件的题目, challenge_id -> true
+func CachedTeamLockedChallenges(gameID int64, teamID int64) (map[int64]bool, error) {
+	prerequisites, err := CachedGamePrerequisites(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 没有设置前置条件的比赛不需要再查询队伍的解题情况
+	if len(prerequisites) == 0 {
+		return map[int64]bool{}, nil
+	}
+
+	obj, err := GetOrCacheSingleFlight(fmt.Sprintf("team_locked_challenges_%d_%d", gameID, teamID), func() (interface{}, error) {
+		solveMap, err := CachedSolvedChallengesForGame(gameID)
+		if err != nil {
+			return nil, err
+		}
+
+		var team models.Team
+		if err := dbtool.DB().Select("team_id", "team_score").Where("team_id = ?", teamID).First(&team).Error; err != nil {
+			return nil, errors.New("failed to load team")
+		}
+
+		progress := prerequisitetool.NewTeamProgress(solveMap[teamID], team.TeamScore)
+
+		locked := make(map[int64]bool)
+		for challengeID, prerequisite := range prerequisites {
+			// 已经解出的题目不会因为之后分数变化再被锁上
+			if progress.Solved[challengeID] {
+				continue
+			}
+			if !prerequisitetool.Satisfied(prerequisite, progress) {
+				locked[challengeID] = true
+			}
+		}
+
+		return locked, nil
+	}, teamSolveStatusCacheTime, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.(map[int64]bool), nil
+}
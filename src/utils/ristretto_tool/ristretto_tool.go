@@ -260,7 +260,47 @@ func CachedGameInfo(gameID int64) (*models.Game, error) {
 	return &game, nil
 }
 
+// sortTeamRankings 排行榜排序, 阶段排行榜也用同样的规则
+func sortTeamRankings(teamRankings []webmodels.TeamScoreItem) {
+	// 使用 sort.Slice 进行多条件排序：
+	// 1. 总分降序（分数高的排前面）
+	// 2. 总分相同时，罚时升序（罚时少的排前面）
+	// 3. 罚时相同时，最后解题时间升序（解题时间早的排前面）
+	// 4. 最后比较队伍名称（升序，字典序小的排前面）... 这个应该不会出现
+	sort.Slice(teamRankings, func(i, j int) bool {
+		teamI, teamJ := teamRankings[i], teamRankings[j]
+
+		// 先比较总分（降序）
+		if teamI.Score != teamJ.Score {
+			return teamI.Score > teamJ.Score
+		}
+
+		// 总分相同时比较罚时（升序，罚时少的排前面）
+		if teamI.Penalty != teamJ.Penalty {
+			return teamI.Penalty < teamJ.Penalty
+		}
+
+		// 罚时相同时比较最后解题时间（升序，解题时间早的排前面）
+		if teamI.LastSolveTime != teamJ.LastSolveTime {
+			return teamI.LastSolveTime < teamJ.LastSolveTime
+		}
+
+		// 比较队伍 ID。。。
+		return teamI.TeamID < teamJ.TeamID
+	})
+}
+
+// CalculateGameScoreBoard 计算公开的排行榜, 封榜期间只包含封榜前的数据
 func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, error) {
+	return calculateGameScoreBoard(gameID, false)
+}
+
+// CalculateRevealedGameScoreBoard 计算包含封榜后数据的真实排行榜, 只能给管理员使用, 不能放进公开的缓存
+func CalculateRevealedGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, error) {
+	return calculateGameScoreBoard(gameID, true)
+}
+
+func calculateGameScoreBoard(gameID int64, ignoreFreeze bool) (*webmodels.CachedGameScoreBoardData, error) {
 	var cachedData webmodels.CachedGameScoreBoardData
 
 	// 获取用户信息
@@ -274,6 +314,13 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 		return nil, errors.New("failed to load game")
 	}
 
+	// 封榜后只统计封榜前的数据
+	scoreboardEndTime := game.EndTime
+	frozen := !ignoreFreeze && game.ScoreboardFrozen(time.Now().UTC())
+	if frozen {
+		scoreboardEndTime = *game.FreezeTime
+	}
+
 	var finalScoreBoardMap map[int64]webmodels.TeamScoreItem = make(map[int64]webmodels.TeamScoreItem)
 	var timeLines []webmodels.TimeLineItem = make([]webmodels.TimeLineItem, 0)
 
@@ -287,7 +334,7 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 	var solves []models.Solve
 	if err := dbtool.DB().Where(`game_id = ? 
 	AND solve_time >= ? 
-	AND solve_time <= ?`, gameID, game.StartTime, game.EndTime).
+	AND solve_time <= ?`, gameID, game.StartTime, scoreboardEndTime).
 		Preload("GameChallenge").
 		Preload("Solver").
 		Preload("Challenge").
@@ -297,6 +344,21 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 		return nil, errors.New("failed to load solves")
 	}
 
+	// 封榜时题目分数按照封榜前的解题人数计算, 避免从分数变化看出封榜后的解题
+	var frozenChallenges map[int64]webmodels.FrozenChallengeScore
+	if frozen {
+		frozenChallenges, err = frozenChallengeScores(&game, solves)
+		if err != nil {
+			return nil, err
+		}
+	}
+	challengeCurScore := func(gc models.GameChallenge) float64 {
+		if frozenChallenge, ok := frozenChallenges[gc.ChallengeID]; ok {
+			return frozenChallenge.CurScore
+		}
+		return gc.CurScore
+	}
+
 	// 计算每道题的首杀时间
 	firstSolveTime := make(map[int64]time.Time) // challengeID -> 首杀时间
 	for _, solve := range solves {
@@ -307,6 +369,7 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 
 	// 计算每个队伍的总分和罚时
 	teamDataMap := make(map[int64]webmodels.TeamScoreItem)
+	stageScores := newStageScoreCollector(game.Stages)
 
 	// 初始化队伍数据
 	for _, team := range teams {
@@ -337,6 +400,7 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 			Score:            0,
 			Penalty:          0,
 			SolvedChallenges: make([]webmodels.TeamSolveItem, 0),
+			PartialSolves:    make([]webmodels.TeamPartialSolveItem, 0),
 			ScoreAdjustments: make([]webmodels.TeamScoreAdjustmentItem, 0),
 			LastSolveTime:    0,
 		}
@@ -355,8 +419,10 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 				penalty = int64(solve.SolveTime.Sub(firstTime).Seconds())
 			}
 
-			challengeScore := solve.GameChallenge.CurScore
+			baseScore := challengeCurScore(solve.GameChallenge)
+			challengeScore := baseScore
 			rewardScore := 0.0
+			var rewardAdjustment *webmodels.TeamScoreAdjustmentItem
 
 			// 这里计算分数了，处理一下三血
 			if solve.GameChallenge.BloodRewardEnabled && solve.Rank <= 3 {
@@ -367,19 +433,19 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 
 				switch solve.Rank {
 				case 3:
-					rewardScore = float64(solve.Game.ThirdBloodReward) * solve.GameChallenge.CurScore / 100
+					rewardScore = float64(solve.Game.ThirdBloodReward) * baseScore / 100
 					rewardReason = "Third Blood Reward"
 					if solve.Game.ThirdBloodReward != 0 {
 						rankRewardEnabled = true
 					}
 				case 2:
-					rewardScore = float64(solve.Game.SecondBloodReward) * solve.GameChallenge.CurScore / 100
+					rewardScore = float64(solve.Game.SecondBloodReward) * baseScore / 100
 					rewardReason = "Second Blood Reward"
 					if solve.Game.SecondBloodReward != 0 {
 						rankRewardEnabled = true
 					}
 				case 1:
-					rewardScore = float64(solve.Game.FirstBloodReward) * solve.GameChallenge.CurScore / 100
+					rewardScore = float64(solve.Game.FirstBloodReward) * baseScore / 100
 					rewardReason = "First Blood Reward"
 					if solve.Game.FirstBloodReward != 0 {
 						rankRewardEnabled = true
@@ -400,6 +466,7 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 					}
 
 					challengeScore += rewardScore
+					rewardAdjustment = &adjustment
 
 					// 往前端添加三血的加分记录
 					teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, adjustment)
@@ -410,7 +477,7 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 			teamData.Penalty += penalty
 
 			// 插入解题记录
-			teamData.SolvedChallenges = append(teamData.SolvedChallenges, webmodels.TeamSolveItem{
+			solveItem := webmodels.TeamSolveItem{
 				ChallengeID:   solve.ChallengeID,
 				Score:         challengeScore,
 				Solver:        solve.Solver.Username,
@@ -418,7 +485,9 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 				SolveTime:     solve.SolveTime,
 				BloodReward:   rewardScore,
 				ChallengeName: solve.Challenge.Name,
-			})
+			}
+			teamData.SolvedChallenges = append(teamData.SolvedChallenges, solveItem)
+			stageScores.addSolve(solve.GameChallenge.BelongStage, solve.TeamID, solveItem, penalty, rewardAdjustment)
 
 			// 更新最后解题时间
 			if teamData.LastSolveTime < solve.SolveTime.UnixMilli() {
@@ -429,9 +498,109 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 		}
 	}
 
+	// 多段 flag 题目的部分分数
+	var subFlagCredits []SubFlagCredit
+	if frozen {
+		subFlagCredits, err = LoadSubFlagCreditsBefore(gameID, scoreboardEndTime)
+	} else {
+		subFlagCredits, err = LoadSubFlagCredits([]int64{gameID})
+	}
+	if err != nil {
+		return nil, errors.New("failed to load sub flag credits")
+	}
+
+	if len(subFlagCredits) > 0 {
+		var gameChallenges []models.GameChallenge
+		if err := dbtool.DB().Where("game_id = ?", gameID).Preload("Challenge").Find(&gameChallenges).Error; err != nil {
+			return nil, errors.New("failed to load game challenges")
+		}
+
+		gameChallengeMap := make(map[int64]models.GameChallenge)
+		for _, gc := range gameChallenges {
+			gameChallengeMap[gc.IngameID] = gc
+		}
+
+		for _, credit := range subFlagCredits {
+			gc, exists := gameChallengeMap[credit.IngameID]
+			if !exists || !gc.Visible {
+				continue
+			}
+
+			if teamData, exists := teamDataMap[credit.TeamID]; exists {
+				gc.CurScore = challengeCurScore(gc)
+				creditScore := credit.Score(gc)
+
+				partialSolve := webmodels.TeamPartialSolveItem{
+					ChallengeID:   credit.ChallengeID,
+					ChallengeName: gc.Challenge.Name,
+					SubFlags:      credit.SubFlags,
+					Score:         creditScore,
+					SolveTime:     credit.LastSolveTime,
+				}
+
+				teamData.Score += creditScore
+				teamData.PartialSolves = append(teamData.PartialSolves, partialSolve)
+				stageScores.addPartialSolve(gc.BelongStage, credit.TeamID, partialSolve)
+
+				if teamData.LastSolveTime < credit.LastSolveTime.UnixMilli() {
+					teamData.LastSolveTime = credit.LastSolveTime.UnixMilli()
+				}
+
+				teamDataMap[credit.TeamID] = teamData
+			}
+		}
+	}
+
+	// 解锁提示的扣分和罚时
+	hintUnlocks, err := LoadHintUnlocks([]int64{gameID})
+	if err != nil {
+		return nil, errors.New("failed to load hint unlocks")
+	}
+
+	if len(hintUnlocks) > 0 {
+		var gameChallenges []models.GameChallenge
+		if err := dbtool.DB().Where("game_id = ?", gameID).Find(&gameChallenges).Error; err != nil {
+			return nil, errors.New("failed to load game challenges")
+		}
+
+		gameChallengeMap := make(map[int64]models.GameChallenge)
+		for _, gc := range gameChallenges {
+			gameChallengeMap[gc.IngameID] = gc
+		}
+
+		for _, unlock := range hintUnlocks {
+			gc, exists := gameChallengeMap[unlock.IngameID]
+			if !exists || !gc.Visible || unlock.UnlockTime.After(scoreboardEndTime) {
+				continue
+			}
+
+			if teamData, exists := teamDataMap[unlock.TeamID]; exists {
+				teamData.Score -= unlock.Cost
+				teamData.Penalty += unlock.PenaltySeconds
+
+				// 往前端添加解锁提示的扣分记录
+				hintAdjustment := webmodels.TeamScoreAdjustmentItem{
+					AdjustmentID:   -1,
+					AdjustmentType: string(models.AdjustmentTypeHint),
+					ScoreChange:    -unlock.Cost,
+					Reason:         fmt.Sprintf("Hint unlock for %s", unlock.Challenge.Name),
+					CreatedAt:      unlock.UnlockTime,
+				}
+				teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, hintAdjustment)
+				stageScores.addAdjustment(gc.BelongStage, unlock.TeamID, hintAdjustment, unlock.PenaltySeconds)
+
+				teamDataMap[unlock.TeamID] = teamData
+			}
+		}
+	}
+
 	// 获取并应用分数修正
 	var adjustments []models.ScoreAdjustment
-	if err := dbtool.DB().Where("game_id = ?", gameID).Find(&adjustments).Error; err != nil {
+	adjustmentQuery := dbtool.DB().Where("game_id = ?", gameID)
+	if frozen {
+		adjustmentQuery = adjustmentQuery.Where("created_at <= ?", scoreboardEndTime)
+	}
+	if err := adjustmentQuery.Find(&adjustments).Error; err != nil {
 		return nil, errors.New("failed to load score adjustments")
 	}
 
@@ -445,14 +614,18 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 			if teamData.ScoreAdjustments == nil {
 				teamData.ScoreAdjustments = make([]webmodels.TeamScoreAdjustmentItem, 0)
 			}
-			teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, webmodels.TeamScoreAdjustmentItem{
+			adjustmentItem := webmodels.TeamScoreAdjustmentItem{
 				AdjustmentID:   adjustment.AdjustmentID,
 				AdjustmentType: string(adjustment.AdjustmentType),
 				ScoreChange:    adjustment.ScoreChange,
 				Reason:         adjustment.Reason,
 				CreatedAt:      adjustment.CreatedAt,
-			})
+			}
+			teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, adjustmentItem)
 			teamDataMap[adjustment.TeamID] = teamData
+
+			// 分数修正算到修正时间所在的阶段
+			stageScores.addAdjustment(stageScores.stageAt(adjustment.CreatedAt), adjustment.TeamID, adjustmentItem, 0)
 		}
 	}
 
@@ -462,32 +635,7 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 		teamRankings = append(teamRankings, teamData)
 	}
 
-	// 使用 sort.Slice 进行多条件排序：
-	// 1. 总分降序（分数高的排前面）
-	// 2. 总分相同时，罚时升序（罚时少的排前面）
-	// 3. 罚时相同时，最后解题时间升序（解题时间早的排前面）
-	// 4. 最后比较队伍名称（升序，字典序小的排前面）... 这个应该不会出现
-	sort.Slice(teamRankings, func(i, j int) bool {
-		teamI, teamJ := teamRankings[i], teamRankings[j]
-
-		// 先比较总分（降序）
-		if teamI.Score != teamJ.Score {
-			return teamI.Score > teamJ.Score
-		}
-
-		// 总分相同时比较罚时（升序，罚时少的排前面）
-		if teamI.Penalty != teamJ.Penalty {
-			return teamI.Penalty < teamJ.Penalty
-		}
-
-		// 罚时相同时比较最后解题时间（升序，解题时间早的排前面）
-		if teamI.LastSolveTime != teamJ.LastSolveTime {
-			return teamI.LastSolveTime < teamJ.LastSolveTime
-		}
-
-		// 比较队伍 ID。。。
-		return teamI.TeamID < teamJ.TeamID
-	})
+	sortTeamRankings(teamRankings)
 
 	processedTeamRankings := make([]webmodels.TeamScoreItem, 0, len(teamDataMap))
 
@@ -505,8 +653,10 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 			Members:          teamData.Members,
 			Penalty:          teamData.Penalty,
 			SolvedChallenges: teamData.SolvedChallenges,
+			PartialSolves:    teamData.PartialSolves,
 			ScoreAdjustments: teamData.ScoreAdjustments,
 			GroupID:          teamData.GroupID,
+			LastSolveTime:    teamData.LastSolveTime,
 		}
 		finalScoreBoardMap[teamData.TeamID] = tmp
 		processedTeamRankings = append(processedTeamRankings, tmp)
@@ -529,8 +679,10 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 			Members:          teamData.Members,
 			Penalty:          teamData.Penalty,
 			SolvedChallenges: teamData.SolvedChallenges,
+			PartialSolves:    teamData.PartialSolves,
 			ScoreAdjustments: teamData.ScoreAdjustments,
 			GroupID:          teamData.GroupID,
+			LastSolveTime:    teamData.LastSolveTime,
 		})
 		// 防止队伍数量少于 10报错
 		idx += 1
@@ -569,6 +721,17 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 
 		// scoreboard.Data = filteredScoreboard
 
+		// 封榜后的积分记录不能出现在时间线上
+		if frozen {
+			frozenData := make(models.ScoreBoardDatas, 0, len(scoreboard.Data))
+			for _, record := range scoreboard.Data {
+				if !record.RecordTime.After(scoreboardEndTime) {
+					frozenData = append(frozenData, record)
+				}
+			}
+			scoreboard.Data = frozenData
+		}
+
 		teamGameScoreboardMap[scoreboard.TeamID] = scoreboard
 	}
 
@@ -692,6 +855,23 @@ func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData,
 		cachedData.AllTimeLines = allTimeLines
 	}
 
+	// 每个阶段单独的排行榜
+	cachedData.StageRankings = stageScores.rankings(teamRankings)
+	cachedData.StageScoreBoardMaps = make(map[string]map[int64]webmodels.TeamScoreItem, len(cachedData.StageRankings))
+	for stageName, stageRankings := range cachedData.StageRankings {
+		stageScoreBoardMap := make(map[int64]webmodels.TeamScoreItem, len(stageRankings))
+		for _, teamData := range stageRankings {
+			stageScoreBoardMap[teamData.TeamID] = teamData
+		}
+		cachedData.StageScoreBoardMaps[stageName] = stageScoreBoardMap
+	}
+
+	cachedData.Frozen = frozen
+	if frozen {
+		cachedData.FreezeTime = game.FreezeTime
+		cachedData.FrozenChallenges = frozenChallenges
+	}
+
 	cachedData.FinalScoreBoardMap = finalScoreBoardMap
 	cachedData.Top10TimeLines = timeLines
 	cachedData.Top10Teams = top10Teams
@@ -722,11 +902,13 @@ func CachedGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, er
 	// zaphelper.Logger.Error("Get scoreboard from cache failed", zap.String("cache_key", cacheKey))
 
 	obj := webmodels.CachedGameScoreBoardData{
-		TeamRankings:       make([]webmodels.TeamScoreItem, 0),
-		AllTimeLines:       make([]webmodels.TimeLineItem, 0),
-		Top10TimeLines:     make([]webmodels.TimeLineItem, 0),
-		Top10Teams:         make([]webmodels.TeamScoreItem, 0),
-		FinalScoreBoardMap: make(map[int64]webmodels.TeamScoreItem),
+		TeamRankings:        make([]webmodels.TeamScoreItem, 0),
+		AllTimeLines:        make([]webmodels.TimeLineItem, 0),
+		Top10TimeLines:      make([]webmodels.TimeLineItem, 0),
+		Top10Teams:          make([]webmodels.TeamScoreItem, 0),
+		FinalScoreBoardMap:  make(map[int64]webmodels.TeamScoreItem),
+		StageRankings:       make(map[string][]webmodels.TeamScoreItem),
+		StageScoreBoardMaps: make(map[string]map[int64]webmodels.TeamScoreItem),
 	}
 
 	return &obj, nil
@@ -898,8 +1080,8 @@ type CachedFilteredGameScoreBoardData struct {
 	TotalCount           int64
 }
 
-// CachedFilteredGameScoreBoard 缓存按分组过滤的排行榜数据
-func CachedFilteredGameScoreBoard(gameID int64, groupID *int64) (*CachedFilteredGameScoreBoardData, error) {
+// CachedFilteredGameScoreBoard 缓存按阶段和分组过滤的排行榜数据
+func CachedFilteredGameScoreBoard(gameID int64, groupID *int64, stageName *string) (*CachedFilteredGameScoreBoardData, error) {
 	var cachedFilteredData CachedFilteredGameScoreBoardData
 
 	// 构建缓存键
@@ -909,6 +1091,9 @@ func CachedFilteredGameScoreBoard(gameID int64, groupID *int64) (*CachedFiltered
 	} else {
 		cacheKey = fmt.Sprintf("filtered_game_scoreboard_%d_all", gameID)
 	}
+	if stageName != nil {
+		cacheKey = fmt.Sprintf("%s_stage_%s", cacheKey, *stageName)
+	}
 
 	obj, err := GetOrCacheSingleFlight(cacheKey, func() (interface{}, error) {
 		// 获取完整的排行榜数据
@@ -917,7 +1102,15 @@ func CachedFilteredGameScoreBoard(gameID int64, groupID *int64) (*CachedFiltered
 			return nil, err
 		}
 
-		if groupID == nil {
+		teamRankings := scoreBoard.TeamRankings
+		if stageName != nil {
+			teamRankings = scoreBoard.StageRankings[*stageName]
+			if teamRankings == nil {
+				teamRankings = make([]webmodels.TeamScoreItem, 0)
+			}
+		}
+
+		if groupID == nil && stageName == nil {
 			// 没有分组过滤，直接返回全部数据
 			cachedFilteredData.FilteredTeamRankings = scoreBoard.TeamRankings
 			cachedFilteredData.FilteredTimeLines = scoreBoard.AllTimeLines
@@ -934,13 +1127,22 @@ func CachedFilteredGameScoreBoard(gameID int64, groupID *int64) (*CachedFiltered
 			}
 
 			// 过滤队伍排名数据
-			for _, team := range scoreBoard.TeamRankings {
-				if team.GroupID != nil && *team.GroupID == *groupID {
-					filteredTeamRankings = append(filteredTeamRankings, team)
-					// 添加对应的时间线数据
-					if timeline, exists := timeLineMap[team.TeamID]; exists {
-						filteredTimeLines = append(filteredTimeLines, timeline)
-					}
+			for _, team := range teamRankings {
+				if groupID != nil && (team.GroupID == nil || *team.GroupID != *groupID) {
+					continue
+				}
+
+				filteredTeamRankings = append(filteredTeamRankings, team)
+				// 添加对应的时间线数据
+				if timeline, exists := timeLineMap[team.TeamID]; exists {
+					filteredTimeLines = append(filteredTimeLines, timeline)
+				} else if stageName != nil {
+					// 阶段排行榜的顺序和总榜不同, 没有时间线的队伍也要占位, 保证分页后两边对得上
+					filteredTimeLines = append(filteredTimeLines, webmodels.TimeLineItem{
+						TeamID:   team.TeamID,
+						TeamName: team.TeamName,
+						Scores:   make([]webmodels.TimeLineScoreItem, 0),
+					})
 				}
 			}
 
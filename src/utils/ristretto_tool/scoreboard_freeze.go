@@ -0,0 +1,167 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	scoringtool "a1ctf/src/utils/scoring_tool"
+	"a1ctf/src/webmodels"
+	"errors"
+)
+
+// 按照封榜前的解题人数重新计算题目分数, solves 只包含封榜前的解题记录
+func frozenChallengeScores(game *models.Game, solves []models.Solve) (map[int64]webmodels.FrozenChallengeScore, error) {
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Where("game_id = ?", game.GameID).Find(&gameChallenges).Error; err != nil {
+		return nil, errors.New("failed to load game challenges")
+	}
+
+	// 和更新题目分数的任务一样, 只统计比赛时间内的正确解题
+	solveCountMap := make(map[int64]int32)
+	for _, solve := range solves {
+		if solve.SolveStatus == models.SolveCorrect && solve.SolveTime.After(game.StartTime) {
+			solveCountMap[solve.IngameID]++
+		}
+	}
+
+	frozenChallenges := make(map[int64]webmodels.FrozenChallengeScore, len(gameChallenges))
+	for _, gc := range gameChallenges {
+		solveCount := solveCountMap[gc.IngameID]
+		frozenChallenges[gc.ChallengeID] = webmodels.FrozenChallengeScore{
+			SolveCount: solveCount,
+			CurScore: scoringtool.Score(scoringtool.Resolve(game, &gc), scoringtool.ScoreParams{
+				TotalScore:   gc.TotalScore,
+				MinimalScore: gc.MinimalScore,
+				Difficulty:   gc.Difficulty,
+			}, solveCount),
+		}
+	}
+
+	return frozenChallenges, nil
+}
+
+// BuildScoreboardRevealSteps 生成从封榜排行榜到真实排行榜的揭晓步骤
+// 每一步揭晓当前排名最靠后、封榜后还有得分变化的队伍, 揭晓后重新排名, 直到所有队伍都揭晓完
+func BuildScoreboardRevealSteps(frozen []webmodels.TeamScoreItem, revealed []webmodels.TeamScoreItem) []webmodels.ScoreboardRevealStep {
+	frozenMap := make(map[int64]webmodels.TeamScoreItem, len(frozen))
+	for _, team := range frozen {
+		frozenMap[team.TeamID] = team
+	}
+
+	current := make([]webmodels.TeamScoreItem, 0, len(revealed))
+	pending := make(map[int64]webmodels.TeamScoreItem)
+	for _, team := range revealed {
+		frozenTeam, ok := frozenMap[team.TeamID]
+		if !ok {
+			frozenTeam = webmodels.TeamScoreItem{
+				TeamID:   team.TeamID,
+				TeamName: team.TeamName,
+			}
+		}
+
+		if frozenTeam.Score != team.Score || frozenTeam.Penalty != team.Penalty ||
+			frozenTeam.LastSolveTime != team.LastSolveTime || len(frozenTeam.SolvedChallenges) != len(team.SolvedChallenges) {
+			pending[team.TeamID] = team
+		}
+		current = append(current, frozenTeam)
+	}
+	sortTeamRankings(current)
+
+	steps := make([]webmodels.ScoreboardRevealStep, 0, len(pending))
+	for len(pending) > 0 {
+		// 从榜底开始找还没有揭晓的队伍
+		idx := len(current) - 1
+		for ; idx >= 0; idx-- {
+			if _, ok := pending[current[idx].TeamID]; ok {
+				break
+			}
+		}
+
+		prevTeam := current[idx]
+		team := pending[prevTeam.TeamID]
+		delete(pending, prevTeam.TeamID)
+
+		current[idx] = team
+		sortTeamRankings(current)
+
+		newRank := int64(0)
+		for i := range current {
+			if current[i].TeamID == team.TeamID {
+				newRank = int64(i + 1)
+				break
+			}
+		}
+
+		steps = append(steps, webmodels.ScoreboardRevealStep{
+			TeamID:        team.TeamID,
+			TeamName:      team.TeamName,
+			PrevRank:      int64(idx + 1),
+			NewRank:       newRank,
+			PrevScore:     prevTeam.Score,
+			NewScore:      team.Score,
+			NewSolves:     newSolvedChallenges(prevTeam, team),
+			PartialSolves: newPartialSolves(prevTeam, team),
+		})
+	}
+
+	for idx := range steps {
+		steps[idx].Step = idx + 1
+		steps[idx].TotalSteps = len(steps)
+	}
+
+	return steps
+}
+
+// 封榜后新解出的题目
+func newSolvedChallenges(prevTeam webmodels.TeamScoreItem, team webmodels.TeamScoreItem) []webmodels.TeamSolveItem {
+	solved := make(map[int64]bool, len(prevTeam.SolvedChallenges))
+	for _, solve := range prevTeam.SolvedChallenges {
+		solved[solve.ChallengeID] = true
+	}
+
+	newSolves := make([]webmodels.TeamSolveItem, 0)
+	for _, solve := range team.SolvedChallenges {
+		if !solved[solve.ChallengeID] {
+			newSolves = append(newSolves, solve)
+		}
+	}
+	return newSolves
+}
+
+// 封榜后有新提交子 flag 的题目
+func newPartialSolves(prevTeam webmodels.TeamScoreItem, team webmodels.TeamScoreItem) []webmodels.TeamPartialSolveItem {
+	subFlagCount := make(map[int64]int, len(prevTeam.PartialSolves))
+	for _, partial := range prevTeam.PartialSolves {
+		subFlagCount[partial.ChallengeID] = len(partial.SubFlags)
+	}
+
+	partialSolves := make([]webmodels.TeamPartialSolveItem, 0)
+	for _, partial := range team.PartialSolves {
+		if subFlagCount[partial.ChallengeID] != len(partial.SubFlags) {
+			partialSolves = append(partialSolves, partial)
+		}
+	}
+	return partialSolves
+}
+
+// FrozenSimpleChallenges 封榜期间题目只显示封榜前的解题人数和分数, 缓存里的切片是共享的, 这里复制一份
+func FrozenSimpleChallenges(gameID int64, challenges []webmodels.UserSimpleGameChallenge) ([]webmodels.UserSimpleGameChallenge, error) {
+	scoreBoard, err := CachedGameScoreBoard(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !scoreBoard.Frozen {
+		return challenges, nil
+	}
+
+	frozenChallenges := make([]webmodels.UserSimpleGameChallenge, 0, len(challenges))
+	for _, challenge := range challenges {
+		if frozenChallenge, ok := scoreBoard.FrozenChallenges[challenge.ChallengeID]; ok {
+			challenge.SolveCount = frozenChallenge.SolveCount
+			challenge.CurScore = frozenChallenge.CurScore
+		}
+		frozenChallenges = append(frozenChallenges, challenge)
+	}
+
+	return frozenChallenges, nil
+}
@@ -0,0 +1,169 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/webmodels"
+	"sort"
+	"time"
+)
+
+// stageScoreCollector 按阶段统计队伍的得分, 用来生成每个阶段单独的排行榜
+type stageScoreCollector struct {
+	// 按开始时间排序的阶段
+	stages models.GameStages
+	// 阶段名 -> 队伍 ID -> 队伍在这个阶段的得分
+	teams map[string]map[int64]*webmodels.TeamScoreItem
+}
+
+func newStageScoreCollector(stages *models.GameStages) *stageScoreCollector {
+	collector := &stageScoreCollector{
+		stages: make(models.GameStages, 0),
+		teams:  make(map[string]map[int64]*webmodels.TeamScoreItem),
+	}
+
+	if stages != nil {
+		collector.stages = append(collector.stages, *stages...)
+		sort.SliceStable(collector.stages, func(i, j int) bool {
+			return collector.stages[i].StartTime.Before(collector.stages[j].StartTime)
+		})
+	}
+
+	return collector
+}
+
+// 队伍在某个阶段的得分, 题目不属于任何阶段时返回 nil
+func (c *stageScoreCollector) team(stageName *string, teamID int64) *webmodels.TeamScoreItem {
+	if stageName == nil || c.stages.Find(*stageName) == nil {
+		return nil
+	}
+
+	stageTeams, ok := c.teams[*stageName]
+	if !ok {
+		stageTeams = make(map[int64]*webmodels.TeamScoreItem)
+		c.teams[*stageName] = stageTeams
+	}
+
+	teamData, ok := stageTeams[teamID]
+	if !ok {
+		teamData = &webmodels.TeamScoreItem{
+			TeamID:           teamID,
+			SolvedChallenges: make([]webmodels.TeamSolveItem, 0),
+			PartialSolves:    make([]webmodels.TeamPartialSolveItem, 0),
+			ScoreAdjustments: make([]webmodels.TeamScoreAdjustmentItem, 0),
+		}
+		stageTeams[teamID] = teamData
+	}
+
+	return teamData
+}
+
+// stageAt 返回某个时间所在的阶段, 用于没有关联题目的分数修正
+func (c *stageScoreCollector) stageAt(t time.Time) *string {
+	for idx := range c.stages {
+		if !t.Before(c.stages[idx].StartTime) && !t.After(c.stages[idx].EndTime) {
+			return &c.stages[idx].StageName
+		}
+	}
+	return nil
+}
+
+func (c *stageScoreCollector) addSolve(stageName *string, teamID int64, solve webmodels.TeamSolveItem, penalty int64, reward *webmodels.TeamScoreAdjustmentItem) {
+	teamData := c.team(stageName, teamID)
+	if teamData == nil {
+		return
+	}
+
+	teamData.Score += solve.Score
+	teamData.Penalty += penalty
+	teamData.SolvedChallenges = append(teamData.SolvedChallenges, solve)
+	if reward != nil {
+		teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, *reward)
+	}
+	if teamData.LastSolveTime < solve.SolveTime.UnixMilli() {
+		teamData.LastSolveTime = solve.SolveTime.UnixMilli()
+	}
+}
+
+func (c *stageScoreCollector) addPartialSolve(stageName *string, teamID int64, partial webmodels.TeamPartialSolveItem) {
+	teamData := c.team(stageName, teamID)
+	if teamData == nil {
+		return
+	}
+
+	teamData.Score += partial.Score
+	teamData.PartialSolves = append(teamData.PartialSolves, partial)
+	if teamData.LastSolveTime < partial.SolveTime.UnixMilli() {
+		teamData.LastSolveTime = partial.SolveTime.UnixMilli()
+	}
+}
+
+func (c *stageScoreCollector) addAdjustment(stageName *string, teamID int64, adjustment webmodels.TeamScoreAdjustmentItem, penalty int64) {
+	teamData := c.team(stageName, teamID)
+	if teamData == nil {
+		return
+	}
+
+	teamData.Score += adjustment.ScoreChange
+	teamData.Penalty += penalty
+	teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, adjustment)
+}
+
+// rankings 生成每个阶段的排行榜
+// 只有可以参加这个阶段的队伍会出现在榜上, 开启 CarryOver 的阶段会累加之前所有阶段的得分
+func (c *stageScoreCollector) rankings(teams []webmodels.TeamScoreItem) map[string][]webmodels.TeamScoreItem {
+	result := make(map[string][]webmodels.TeamScoreItem, len(c.stages))
+
+	for idx, stage := range c.stages {
+		countedStages := c.stages[idx : idx+1]
+		if stage.CarryOver {
+			countedStages = c.stages[:idx+1]
+		}
+
+		stageRankings := make([]webmodels.TeamScoreItem, 0, len(teams))
+		for _, team := range teams {
+			if !stage.TeamEligible(team.TeamID) {
+				continue
+			}
+
+			teamData := webmodels.TeamScoreItem{
+				TeamID:           team.TeamID,
+				TeamName:         team.TeamName,
+				TeamAvatar:       team.TeamAvatar,
+				TeamSlogan:       team.TeamSlogan,
+				TeamDescription:  team.TeamDescription,
+				Members:          team.Members,
+				GroupID:          team.GroupID,
+				SolvedChallenges: make([]webmodels.TeamSolveItem, 0),
+				PartialSolves:    make([]webmodels.TeamPartialSolveItem, 0),
+				ScoreAdjustments: make([]webmodels.TeamScoreAdjustmentItem, 0),
+			}
+
+			for _, countedStage := range countedStages {
+				stageData, ok := c.teams[countedStage.StageName][team.TeamID]
+				if !ok {
+					continue
+				}
+
+				teamData.Score += stageData.Score
+				teamData.Penalty += stageData.Penalty
+				teamData.SolvedChallenges = append(teamData.SolvedChallenges, stageData.SolvedChallenges...)
+				teamData.PartialSolves = append(teamData.PartialSolves, stageData.PartialSolves...)
+				teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, stageData.ScoreAdjustments...)
+				if teamData.LastSolveTime < stageData.LastSolveTime {
+					teamData.LastSolveTime = stageData.LastSolveTime
+				}
+			}
+
+			stageRankings = append(stageRankings, teamData)
+		}
+
+		sortTeamRankings(stageRankings)
+		for i := range stageRankings {
+			stageRankings[i].Rank = int64(i + 1)
+		}
+
+		result[stage.StageName] = stageRankings
+	}
+
+	return result
+}
@@ -0,0 +1,85 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"math"
+	"time"
+)
+
+// SubFlagCredit 队伍在一道多段 flag 题目中已经提交的子 flag，只包含还没有完整解出的题目
+type SubFlagCredit struct {
+	GameID        int64
+	TeamID        int64
+	IngameID      int64
+	ChallengeID   int64
+	SubFlags      []string
+	LastSolveTime time.Time
+}
+
+// 按照比例计算部分分数
+func (credit SubFlagCredit) Score(gameChallenge models.GameChallenge) float64 {
+	return math.Floor(gameChallenge.CurScore * models.SubFlagCreditRatio(gameChallenge.JudgeConfig, credit.SubFlags))
+}
+
+// 加载比赛时间内提交的子 flag，比赛时间内已经完整解出的题目按照正常解题计分，不再计入部分分数
+func LoadSubFlagCredits(gameIDs []int64) ([]SubFlagCredit, error) {
+	return loadSubFlagCredits(gameIDs, nil)
+}
+
+// 只统计 until 之前的提交，封榜时使用，封榜后才完整解出的题目仍然按照部分分数计算
+func LoadSubFlagCreditsBefore(gameID int64, until time.Time) ([]SubFlagCredit, error) {
+	return loadSubFlagCredits([]int64{gameID}, &until)
+}
+
+func loadSubFlagCredits(gameIDs []int64, until *time.Time) ([]SubFlagCredit, error) {
+	credits := make([]SubFlagCredit, 0)
+	if len(gameIDs) == 0 {
+		return credits, nil
+	}
+
+	query := dbtool.DB().Model(&models.SubFlagSolve{}).
+		Joins("JOIN games ON games.game_id = sub_flag_solves.game_id").
+		Where("sub_flag_solves.game_id IN ? AND sub_flag_solves.solve_time BETWEEN games.start_time AND games.end_time", gameIDs)
+
+	if until != nil {
+		query = query.Where("sub_flag_solves.solve_time <= ?", *until).
+			Where(`NOT EXISTS (SELECT 1 FROM solves WHERE solves.team_id = sub_flag_solves.team_id AND solves.ingame_id = sub_flag_solves.ingame_id
+			AND solves.solve_status = ? AND solves.solve_time BETWEEN games.start_time AND games.end_time AND solves.solve_time <= ?)`, models.SolveCorrect, *until)
+	} else {
+		query = query.Where(`NOT EXISTS (SELECT 1 FROM solves WHERE solves.team_id = sub_flag_solves.team_id AND solves.ingame_id = sub_flag_solves.ingame_id
+			AND solves.solve_status = ? AND solves.solve_time BETWEEN games.start_time AND games.end_time)`, models.SolveCorrect)
+	}
+
+	var subFlagSolves []models.SubFlagSolve
+	if err := query.Order("sub_flag_solves.solve_time ASC").Find(&subFlagSolves).Error; err != nil {
+		return nil, err
+	}
+
+	type creditKey struct {
+		teamID   int64
+		ingameID int64
+	}
+
+	creditIndex := make(map[creditKey]int)
+	for _, solve := range subFlagSolves {
+		key := creditKey{teamID: solve.TeamID, ingameID: solve.IngameID}
+		idx, exists := creditIndex[key]
+		if !exists {
+			credits = append(credits, SubFlagCredit{
+				GameID:      solve.GameID,
+				TeamID:      solve.TeamID,
+				IngameID:    solve.IngameID,
+				ChallengeID: solve.ChallengeID,
+				SubFlags:    make([]string, 0),
+			})
+			idx = len(credits) - 1
+			creditIndex[key] = idx
+		}
+
+		credits[idx].SubFlags = append(credits[idx].SubFlags, solve.SubFlag)
+		credits[idx].LastSolveTime = solve.SolveTime
+	}
+
+	return credits, nil
+}
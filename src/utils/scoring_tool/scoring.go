@@ -0,0 +1,121 @@
+package scoringtool
+
+import (
+	"a1ctf/src/db/models"
+	"fmt"
+	"math"
+)
+
+// ScoreParams 计算题目分数需要的参数
+type ScoreParams struct {
+	TotalScore   float64
+	MinimalScore float64
+	// 不同计分方式的衰减参数, 指数衰减为衰减速度, 其他为降到最低分需要的解题次数
+	Difficulty float64
+}
+
+// Strategy 根据解题人数计算题目当前分数
+type Strategy interface {
+	Score(params ScoreParams, solveCount int32) float64
+}
+
+type StrategyFunc func(params ScoreParams, solveCount int32) float64
+
+func (f StrategyFunc) Score(params ScoreParams, solveCount int32) float64 {
+	return f(params, solveCount)
+}
+
+var strategies = map[models.ScoringStrategy]Strategy{
+	models.ScoringStatic:      StrategyFunc(staticScore),
+	models.ScoringExponential: StrategyFunc(exponentialScore),
+	models.ScoringLinear:      StrategyFunc(linearScore),
+	models.ScoringLogarithmic: StrategyFunc(logarithmicScore),
+	models.ScoringQuadratic:   StrategyFunc(quadraticScore),
+}
+
+// Register 注册新的计分方式, 已存在的同名计分方式会被覆盖
+func Register(name models.ScoringStrategy, strategy Strategy) {
+	strategies[name] = strategy
+}
+
+// Valid 检查计分方式是否存在
+func Valid(name models.ScoringStrategy) error {
+	if _, ok := strategies[name]; !ok {
+		return fmt.Errorf("unknown scoring strategy %q", name)
+	}
+	return nil
+}
+
+// Resolve 题目的计分方式, 题目没有设置时使用比赛的, 都没有设置时使用指数衰减
+func Resolve(game *models.Game, gc *models.GameChallenge) models.ScoringStrategy {
+	if gc != nil && gc.ScoringStrategy != nil && *gc.ScoringStrategy != "" {
+		return *gc.ScoringStrategy
+	}
+	if game != nil && game.ScoringStrategy != "" {
+		return game.ScoringStrategy
+	}
+	return models.ScoringExponential
+}
+
+// Score 按照计分方式计算分数, 没有人解出时为总分, 结果向下取整并且不低于最低分
+func Score(name models.ScoringStrategy, params ScoreParams, solveCount int32) float64 {
+	if solveCount <= 0 || params.TotalScore <= 0 {
+		return params.TotalScore
+	}
+
+	strategy, ok := strategies[name]
+	if !ok {
+		strategy = strategies[models.ScoringExponential]
+	}
+
+	score := math.Floor(strategy.Score(params, solveCount))
+	minimal := math.Min(params.MinimalScore, params.TotalScore)
+	if score < minimal {
+		score = minimal
+	}
+	if score > params.TotalScore {
+		score = params.TotalScore
+	}
+	return score
+}
+
+func staticScore(params ScoreParams, solveCount int32) float64 {
+	return params.TotalScore
+}
+
+// 第一个解出的队伍获得总分, 之后按 e^((1-n)/difficulty) 衰减到最低分
+func exponentialScore(params ScoreParams, solveCount int32) float64 {
+	if params.Difficulty <= 0 {
+		return params.TotalScore
+	}
+	minRatio := params.MinimalScore / params.TotalScore
+	dynamicRatio := (1 - minRatio) * math.Exp((1-float64(solveCount))/params.Difficulty)
+	return params.TotalScore * (minRatio + dynamicRatio)
+}
+
+// 衰减进度, 第一个解出为 0, 第 difficulty+1 个解出为 1
+func decayProgress(params ScoreParams, solveCount int32) float64 {
+	if params.Difficulty <= 0 {
+		return 1
+	}
+	return math.Min(float64(solveCount-1)/params.Difficulty, 1)
+}
+
+func linearScore(params ScoreParams, solveCount int32) float64 {
+	return params.TotalScore - (params.TotalScore-params.MinimalScore)*decayProgress(params, solveCount)
+}
+
+// 前期下降快, 后期下降慢
+func logarithmicScore(params ScoreParams, solveCount int32) float64 {
+	if params.Difficulty <= 0 {
+		return params.MinimalScore
+	}
+	progress := math.Log1p(math.Min(float64(solveCount-1), params.Difficulty)) / math.Log1p(params.Difficulty)
+	return params.TotalScore - (params.TotalScore-params.MinimalScore)*progress
+}
+
+// CTFd 的动态分数公式, 前期下降慢, 后期下降快
+func quadraticScore(params ScoreParams, solveCount int32) float64 {
+	progress := decayProgress(params, solveCount)
+	return params.TotalScore - (params.TotalScore-params.MinimalScore)*progress*progress
+}
@@ -50,6 +50,16 @@ type AdminListGamePayload struct {
 	Offset int `json:"offset"`
 }
 
+// 预览题目分数曲线, 没有传的参数使用题目当前的配置
+type AdminScorePreviewPayload struct {
+	ScoringStrategy *models.ScoringStrategy `json:"scoring_strategy"`
+	TotalScore      *float64                `json:"total_score"`
+	MinimalScore    *float64                `json:"minimal_score"`
+	Difficulty      *float64                `json:"difficulty"`
+	// 预览接下来多少次解题, 默认 30
+	Solves int `json:"solves" binding:"min=0,max=1000"`
+}
+
 type AdminAddGameChallengePayload struct {
 	GameID      int64 `json:"game_id" binding:"min=0"`
 	ChallengeID int64 `json:"challenge_id" binding:"min=0"`
@@ -113,6 +123,12 @@ type AdminExtendContainerPayload struct {
 	ContainerID string `json:"container_id" binding:"required"`
 }
 
+// 获取网关令牌请求参数
+type UserGatewayTokenPayload struct {
+	ContainerName string `json:"container_name" binding:"required"`
+	PortName      string `json:"port_name" binding:"required"`
+}
+
 // Team management payloads
 
 type TeamJoinPayload struct {
@@ -173,6 +189,30 @@ type UpdateScoreAdjustmentPayload struct {
 	Reason         string  `json:"reason" binding:"required"`
 }
 
+// 审核作弊记录, 处罚选项只有在确认作弊时生效
+type AdminReviewCheatPayload struct {
+	ReviewStatus string  `json:"review_status" binding:"required,oneof=Pending Confirmed Dismissed"`
+	ReviewNote   *string `json:"review_note"`
+	// 扣除的分数, 大于 0 时创建一条 cheat 类型的分数修正
+	ScorePenalty float64 `json:"score_penalty" binding:"min=0"`
+	// 删除这条作弊记录涉及到的解题记录
+	RevokeSolves bool `json:"revoke_solves"`
+	// 禁赛该队伍
+	BanTeam bool `json:"ban_team"`
+}
+
+type AdminAdvanceStagePayload struct {
+	FromStage string `json:"from_stage" binding:"required"`
+	ToStage   string `json:"to_stage" binding:"required"`
+	// 上一阶段排名前多少的队伍晋级
+	TopN int `json:"top_n" binding:"required,min=1"`
+}
+
+type AdminRevealScoreboardPayload struct {
+	// 每一步之间间隔的秒数, 默认 3 秒
+	StepInterval *int `json:"step_interval" binding:"omitempty,min=0,max=60"`
+}
+
 type SystemResourceType string
 
 const (
@@ -72,7 +72,7 @@ type UserDetailGameChallenge struct {
 	Description         string                        `json:"description"`
 	TotalScore          float64                       `json:"total_score"`
 	CurScore            float64                       `json:"cur_score"`
-	Hints               models.Hints                  `json:"hints"`
+	Hints               []UserHintItem                `json:"hints"`
 	BelongStage         *string                       `json:"belong_stage"`
 	SolveCount          int32                         `json:"solve_count"`
 	Category            models.ChallengeCategory      `json:"category"`
@@ -84,6 +84,16 @@ type UserDetailGameChallenge struct {
 	Visible             bool                          `json:"visible"`
 }
 
+// 需要解锁的提示在队伍解锁前不返回内容
+type UserHintItem struct {
+	HintID         string    `json:"hint_id"`
+	Content        string    `json:"content"`
+	CreateTime     time.Time `json:"create_time"`
+	Cost           float64   `json:"cost"`
+	PenaltySeconds int64     `json:"penalty_seconds"`
+	Locked         bool      `json:"locked"`
+}
+
 type GameNotice struct {
 	NoticeID       int64                 `json:"notice_id"`
 	NoticeCategory models.NoticeCategory `json:"notice_category"`
@@ -101,6 +111,10 @@ type GameScoreboardData struct {
 	SimpleGameChallenges []UserSimpleGameChallenge `json:"challenges"`
 	Groups               []GameGroupSimple         `json:"groups"`
 	CurrentGroup         *GameGroupSimple          `json:"current_group"`
+	Stages               []string                  `json:"stages"`
+	CurrentStage         *string                   `json:"current_stage"`
+	Frozen               bool                      `json:"frozen"`
+	FreezeTime           *time.Time                `json:"freeze_time"`
 	Pagination           *PaginationInfo           `json:"pagination"`
 }
 
@@ -168,6 +182,15 @@ type TeamSolveItem struct {
 	ChallengeName string    `json:"challenge_name"`
 }
 
+// 多段 flag 题目还没有完整解出时已经获得的部分分数
+type TeamPartialSolveItem struct {
+	ChallengeID   int64     `json:"challenge_id"`
+	ChallengeName string    `json:"challenge_name"`
+	SubFlags      []string  `json:"sub_flags"`
+	Score         float64   `json:"score"`
+	SolveTime     time.Time `json:"solve_time"`
+}
+
 type TeamScoreAdjustmentItem struct {
 	AdjustmentID   int64     `json:"adjustment_id"`
 	AdjustmentType string    `json:"adjustment_type"`
@@ -189,6 +212,7 @@ type TeamScoreItem struct {
 	GroupID          *int64                    `json:"group_id"`
 	GroupName        *string                   `json:"group_name"`
 	SolvedChallenges []TeamSolveItem           `json:"solved_challenges"`
+	PartialSolves    []TeamPartialSolveItem    `json:"partial_solves"`
 	ScoreAdjustments []TeamScoreAdjustmentItem `json:"score_adjustments"`
 	LastSolveTime    int64                     `json:"last_solve_time"`
 }
@@ -199,6 +223,71 @@ type CachedGameScoreBoardData struct {
 	Top10Teams         []TeamScoreItem
 	AllTimeLines       []TimeLineItem
 	TeamRankings       []TeamScoreItem
+	// 阶段名 -> 阶段排行榜
+	StageRankings       map[string][]TeamScoreItem
+	StageScoreBoardMaps map[string]map[int64]TeamScoreItem
+	// 封榜时的排行榜只包含封榜前的数据
+	Frozen     bool
+	FreezeTime *time.Time
+	// 封榜时题目的解题人数和分数, 题目 ID -> 封榜前的数据
+	FrozenChallenges map[int64]FrozenChallengeScore
+}
+
+// 封榜前题目的解题人数和分数
+type FrozenChallengeScore struct {
+	SolveCount int32
+	CurScore   float64
+}
+
+// 揭晓排行榜时的一步, 一次揭晓一支队伍封榜后的全部得分
+type ScoreboardRevealStep struct {
+	Step          int                    `json:"step"`
+	TotalSteps    int                    `json:"total_steps"`
+	TeamID        int64                  `json:"team_id"`
+	TeamName      string                 `json:"team_name"`
+	PrevRank      int64                  `json:"prev_rank"`
+	NewRank       int64                  `json:"new_rank"`
+	PrevScore     float64                `json:"prev_score"`
+	NewScore      float64                `json:"new_score"`
+	NewSolves     []TeamSolveItem        `json:"new_solves"`
+	PartialSolves []TeamPartialSolveItem `json:"partial_solves"`
+}
+
+// 第 SolveCount 个队伍解出后题目的分数
+type ScorePreviewPoint struct {
+	SolveCount int32   `json:"solve_count"`
+	Score      float64 `json:"score"`
+}
+
+type AdminScorePreview struct {
+	ScoringStrategy models.ScoringStrategy `json:"scoring_strategy"`
+	TotalScore      float64                `json:"total_score"`
+	MinimalScore    float64                `json:"minimal_score"`
+	Difficulty      float64                `json:"difficulty"`
+	CurSolveCount   int32                  `json:"cur_solve_count"`
+	Points          []ScorePreviewPoint    `json:"points"`
+}
+
+type AdminHintUnlockItem struct {
+	UnlockID       string    `json:"unlock_id"`
+	TeamID         int64     `json:"team_id"`
+	TeamName       string    `json:"team_name"`
+	UserID         string    `json:"user_id"`
+	Username       string    `json:"username"`
+	Cost           float64   `json:"cost"`
+	PenaltySeconds int64     `json:"penalty_seconds"`
+	UnlockTime     time.Time `json:"unlock_time"`
+}
+
+// 每条提示的解锁情况
+type AdminHintUsage struct {
+	HintID         string                `json:"hint_id"`
+	Content        string                `json:"content"`
+	Visible        bool                  `json:"visible"`
+	Cost           float64               `json:"cost"`
+	PenaltySeconds int64                 `json:"penalty_seconds"`
+	UnlockCount    int64                 `json:"unlock_count"`
+	Unlocks        []AdminHintUnlockItem `json:"unlocks"`
 }
 
 // Team management responses
@@ -242,3 +331,25 @@ type AdminContainerItem struct {
 	TeamID              int64                  `json:"team_id"`
 	ChallengeID         int64                  `json:"challenge_id"`
 }
+
+// 宿主机端口分配
+type AdminPortAllocationItem struct {
+	ContainerID     string                 `json:"container_id"`
+	GameID          int64                  `json:"game_id"`
+	TeamID          int64                  `json:"team_id"`
+	TeamHash        string                 `json:"team_hash"`
+	ChallengeName   string                 `json:"challenge_name"`
+	ContainerStatus models.ContainerStatus `json:"container_status"`
+	Ports           models.AllocatedPorts  `json:"ports"`
+}
+
+// 宿主机端口池使用情况
+type AdminPortPoolUsage struct {
+	Backend     string                    `json:"backend"`
+	RangeStart  int32                     `json:"range_start"`
+	RangeEnd    int32                     `json:"range_end"`
+	Total       int                       `json:"total"`
+	Used        int                       `json:"used"`
+	Free        int                       `json:"free"`
+	Allocations []AdminPortAllocationItem `json:"allocations"`
+}